@@ -19,12 +19,16 @@ import (
 	"github.com/spf13/pflag"
 	"k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/logs"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	_ "k8s.io/component-base/logs/json/register" // for the json logging format registration
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 var (
 	KubeconfigPath string
 	nodeNamePolicy cmd.NodeNamePolicy = cmd.NodeNamePolicyServerClaimName
+	driverOptions  metal.Options
+	logOptions     = logsapi.NewLoggingConfiguration()
 )
 
 func main() {
@@ -32,19 +36,38 @@ func main() {
 	s.AddFlags(pflag.CommandLine)
 
 	logs.AddFlags(pflag.CommandLine)
+	AddLoggingFormatFlags(pflag.CommandLine)
 	AddExtraFlags(pflag.CommandLine)
 
 	flag.InitFlags()
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
+	if err := applyLoggingFormat(pflag.CommandLine); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := driverOptions.Validate(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := driverOptions.ValidateNodeNamePolicy(nodeNamePolicy); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
 	clientProvider, namespace, err := mcmclient.NewProviderAndNamespace(ctrl.SetupSignalHandler(), KubeconfigPath)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
-	drv := metal.NewDriver(clientProvider, namespace, nodeNamePolicy)
+	clientProvider.SetRetries(driverOptions.MetalAPIRetries)
+	clientProvider.SetLockTimeout(driverOptions.MetalClientLockTimeout)
+
+	drv := metal.NewDriver(clientProvider, namespace, nodeNamePolicy, driverOptions)
 
 	if err := app.Run(s, drv); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -54,5 +77,82 @@ func main() {
 
 func AddExtraFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&KubeconfigPath, "metal-kubeconfig", "", "Path to the metal cluster kubeconfig.")
-	fs.Var(&nodeNamePolicy, "node-name-policy", fmt.Sprintf("Define the node name policy. Possible values are '%s', '%s' and '%s'.", cmd.NodeNamePolicyBMCName, cmd.NodeNamePolicyServerName, cmd.NodeNamePolicyServerClaimName))
+	fs.IntVar(&driverOptions.MetalAPIRetries, "metal-api-retries", 0, "Number of retries of metal API reads and server-side apply patches failing with a server timeout or too many requests. Other writes are never retried.")
+	fs.DurationVar(&driverOptions.MetalClientLockTimeout, "metal-client-lock-timeout", 0, "Time a metal API operation waits for the client lock held by another operation before failing. Zero waits without a timeout.")
+	fs.Var(&nodeNamePolicy, "node-name-policy", fmt.Sprintf("Define the node name policy. Possible values are '%s', '%s', '%s' and '%s'.", cmd.NodeNamePolicyBMCName, cmd.NodeNamePolicyServerName, cmd.NodeNamePolicyServerClaimName, cmd.NodeNamePolicyServerLabel))
+	fs.StringVar(&driverOptions.NodeNameLabelKey, "node-name-label-key", "", fmt.Sprintf("Key of the Server label whose value is the node name with the '%s' node name policy, e.g. asset-id.", cmd.NodeNamePolicyServerLabel))
+	fs.DurationVar(&driverOptions.IPAddressClaimBindGracePeriod, "ipam-bind-grace-period", 0, "Time an IPAddressClaim may stay unbound before the machine is recreated. Zero disables the recreation.")
+	fs.BoolVar(&driverOptions.ExposeConfig, "expose-driver-config", false, "Expose the effective driver configuration on the /configz endpoint.")
+	fs.BoolVar(&driverOptions.AdoptForeignServerClaims, "adopt-foreign-server-claims", false, "Adopt existing ServerClaims which are not managed by the driver instead of failing the machine creation.")
+	fs.IntVar(&driverOptions.IgnitionCompressionThreshold, "ignition-compression-threshold", 0, "Size in bytes above which file contents are gzip-compressed in the ignition. Zero disables the compression.")
+	fs.BoolVar(&driverOptions.AllowDiskless, "allow-diskless", false, "Allow MachineClasses without an image for servers which boot without a disk.")
+	fs.StringVar(&driverOptions.IgnitionSecretNamePrefixLabel, "ignition-secret-name-prefix-label", "", "Key of the provider spec label whose value prefixes the ignition secret names, e.g. to separate tenants in a shared namespace.")
+	fs.StringVar(&driverOptions.IPAddressClaimNamespace, "ipam-namespace", "", "Namespace of the IPAddressClaims. Defaults to the metal namespace, ServerClaims and ignition secrets always reside in the metal namespace.")
+	fs.BoolVar(&driverOptions.ImageFallback, "image-fallback", false, "Source the image from the 'metal.ironcore.dev/image' MachineClass annotation or the 'image' key of the provider secret if it is not set in the provider spec.")
+	fs.StringVar(&driverOptions.ManagedBy, "managed-by", metal.ManagedByLabelValue, "Value of the 'app.kubernetes.io/managed-by' label set on all objects created by the driver.")
+	fs.StringVar(&driverOptions.FieldOwner, "field-owner", metal.DefaultFieldOwner, "Field owner of the objects applied by the driver. Distinct field owners allow several driver instances to share a metal cluster.")
+	fs.BoolVar(&driverOptions.DeleteOwnedIPAddressClaims, "delete-owned-ipam-claims", false, "Delete the IPAddressClaims owned by the ServerClaim on machine deletion instead of leaving them to the garbage collection.")
+	fs.BoolVar(&driverOptions.DryRun, "dry-run", false, "Only validate the objects of a machine creation with a dry-run apply without persisting them. All subsequent calls of the machine lifecycle fail.")
+	fs.BoolVar(&driverOptions.DeleteDryRun, "delete-dry-run", false, "Only report the objects which would be deleted on machine deletion without deleting them.")
+	fs.BoolVar(&driverOptions.ServerSelectorDiagnostics, "server-selector-diagnostics", false, "Log the number of free servers matching the selector of pending ServerClaims.")
+	fs.DurationVar(&driverOptions.ServerClaimCreateTimeout, "server-claim-create-timeout", 0, "Time the creation of a ServerClaim may take before the machine creation fails. Zero disables the timeout.")
+	fs.BoolVar(&driverOptions.UserMetadataPrecedence, "user-metadata-precedence", false, "Let colliding keys of the provider spec metadata take precedence over the computed server and IPAM metadata.")
+	fs.StringVar(&driverOptions.ReadyConditionType, "ready-condition-type", "", "Type of a condition of the bound Server which has to be true before a powered on machine is reported as ready.")
+	fs.StringToStringVar(&driverOptions.DefaultServerClaimLabels, "default-server-claim-labels", nil, "Labels set on all ServerClaims, e.g. environment=prod,team=infra. Colliding labels of the provider spec take precedence.")
+	fs.StringVar(&driverOptions.ImageAliasConfigMap, "image-alias-configmap", "", "Name of a ConfigMap in the metal namespace mapping image aliases to image references, which resolves the provider spec image on machine creation.")
+	fs.BoolVar(&driverOptions.MetadataEnvFile, "metadata-env-file", false, "Additionally render the metadata as KEY=value lines of the environment file /etc/metal-metadata.env, nested keys are joined with an underscore.")
+	driverOptions.ValidationMode = cmd.ValidationModeLenient
+	fs.Var(&driverOptions.ValidationMode, "validation-mode", fmt.Sprintf("Define whether non-critical provider spec findings fail the validation or are logged as warnings. Possible values are '%s' and '%s'.", cmd.ValidationModeStrict, cmd.ValidationModeLenient))
+	fs.StringSliceVar(&driverOptions.AllowedMetalNamespaces, "allowed-metal-namespaces", nil, "Metal namespaces a Machine may target with the metal.ironcore.dev/metal-namespace annotation instead of the metal namespace of the driver.")
+	fs.BoolVar(&driverOptions.VerifySecretNamespace, "verify-secret-namespace", false, "Reject provider secrets which are neither located in the namespace of the MachineClass nor in an allowed secret namespace.")
+	fs.StringSliceVar(&driverOptions.AllowedSecretNamespaces, "allowed-secret-namespaces", nil, "Further namespaces the provider secret may be located in if the secret namespace is verified.")
+	fs.StringSliceVar(&driverOptions.AllowedMetadataKeys, "allowed-metadata-keys", nil, "Keys which may be used in the provider spec metadata. If empty, all keys which are not denied are allowed.")
+	fs.StringSliceVar(&driverOptions.DeniedMetadataKeys, "denied-metadata-keys", nil, "Keys which must not be used in the provider spec metadata.")
+	fs.BoolVar(&driverOptions.NodeNameFallback, "node-name-fallback", false, "Use the ServerClaim name as node name with a warning if the node name can not be resolved with the node name policy instead of failing.")
+	fs.DurationVar(&driverOptions.ServerReleaseTimeout, "server-release-timeout", 0, "Time a machine deletion waits for the server of the deleted ServerClaim to become available and unclaimed. Zero disables the wait.")
+	fs.StringVar(&driverOptions.ShootHostnameDomain, "shoot-hostname-domain", "", "Domain the hostname of a machine is qualified with together with its shoot name, e.g. <node>.<shoot-name>.<domain>. Empty keeps the plain hostname.")
+	fs.BoolVar(&driverOptions.IgnitionSecretConflictDetection, "ignition-secret-conflict-detection", false, "Report conflicts with other field managers of a co-managed ignition secret instead of forcing the ownership of the conflicting fields.")
+	fs.IntVar(&driverOptions.MaxMetadataSize, "max-metadata-size", 0, "Maximum size in bytes of the serialized metadata rendered into the ignition. Zero disables the limit.")
+	fs.StringVar(&driverOptions.ServerClaimSpecTemplate, "server-claim-spec-template", "", "YAML or JSON template of the ServerClaim spec with the placeholders {{ .Image }}, {{ .ServerSelector }} and {{ .Power }}, e.g. to adapt to the fields accepted by the metal-operator version. Empty uses the built-in spec.")
+	fs.BoolVar(&driverOptions.DetectIgnitionDrift, "detect-ignition-drift", false, "Reinitialize a machine whose ignition secret has drifted from the ignition rendered from the current provider spec.")
+	driverOptions.ImageUpdatePolicy = cmd.ImageUpdatePolicyIgnore
+	fs.Var(&driverOptions.ImageUpdatePolicy, "image-update-policy", fmt.Sprintf("Define whether machines whose ServerClaim image differs from the MachineClass image are kept or recreated. Possible values are '%s' and '%s'.", cmd.ImageUpdatePolicyIgnore, cmd.ImageUpdatePolicyRecreate))
+	fs.BoolVar(&driverOptions.VerifyServerImage, "verify-server-image", false, "Warn about a machine whose bound server boots another image than requested by its ServerClaim.")
+	fs.BoolVar(&driverOptions.VerifyServerSelector, "verify-server-selector", false, "Fail the machine creation if no server matches the server labels of the MachineClass.")
+	fs.BoolVar(&driverOptions.IPAMPoolMetadata, "ipam-pool-metadata", false, "Add the name of the IPAM pool to the metadata entry of each allocated IP address.")
+	fs.IntVar(&driverOptions.MaxConcurrentDeletes, "max-concurrent-deletes", 0, "Maximum number of machine deletions concurrently waiting for their ServerClaim to be deleted, further deletions are retried. Zero does not limit the deletions.")
+	fs.IntVar(&driverOptions.InitializeRetries, "initialize-retries", 0, "Number of in-place retries of a machine initialization step failing with a transient metal API error, e.g. a conflict.")
+	fs.StringToStringVar(&driverOptions.ServerAnnotations, "server-annotations", nil, "Annotations set on the Server bound to a machine on initialization, e.g. provisioned-by=mcm. Requires the permission to patch Servers.")
+	fs.StringVar(&driverOptions.ZoneLabelKey, "zone-label-key", "", "Key of the server label selecting servers in the zone of the MachineClass node template, e.g. topology.kubernetes.io/zone. Disabled if empty.")
+	fs.BoolVar(&driverOptions.ExcludeDeletingServerClaims, "exclude-deleting-server-claims", false, "Leave ServerClaims whose deletion is in progress out of the machines listed to the machine-controller-manager.")
+	driverOptions.UserDataIgnitionPolicy = cmd.UserDataIgnitionPolicyScript
+	fs.Var(&driverOptions.UserDataIgnitionPolicy, "userdata-ignition-policy", fmt.Sprintf("Define whether a userData which is a complete ignition or butane config is rendered as init script or merged into the ignition. Possible values are '%s', '%s' and '%s'.", cmd.UserDataIgnitionPolicyScript, cmd.UserDataIgnitionPolicyMerge, cmd.UserDataIgnitionPolicyOverride))
+	fs.BoolVar(&driverOptions.IgnitionSecretOwnerReference, "ignition-secret-owner-reference", false, "Set an owner reference of the ServerClaim on the ignition secret, so that the ignition secret is garbage collected with its ServerClaim.")
+}
+
+// AddLoggingFormatFlags adds the flags selecting the logging format, e.g. --logging-format=json for structured output.
+// The verbosity flags are already registered by the MCM options and are not added again.
+func AddLoggingFormatFlags(fs *pflag.FlagSet) {
+	loggingFlags := pflag.NewFlagSet("logging", pflag.ContinueOnError)
+	logsapi.AddFlags(logOptions, loggingFlags)
+	loggingFlags.VisitAll(func(f *pflag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.AddFlag(f)
+		}
+	})
+}
+
+// applyLoggingFormat switches klog to the selected logging format while keeping the verbosity set by the klog flags
+func applyLoggingFormat(fs *pflag.FlagSet) error {
+	if v := fs.Lookup("v"); v != nil {
+		if err := logsapi.VerbosityLevelPflag(&logOptions.Verbosity).Set(v.Value.String()); err != nil {
+			return err
+		}
+	}
+	if vmodule := fs.Lookup("vmodule"); vmodule != nil {
+		if err := logsapi.VModuleConfigurationPflag(&logOptions.VModule).Set(vmodule.Value.String()); err != nil {
+			return err
+		}
+	}
+	return logsapi.ValidateAndApply(logOptions, nil)
 }
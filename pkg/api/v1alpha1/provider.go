@@ -5,6 +5,9 @@ package v1alpha1
 
 import (
 	"net/netip"
+
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -14,30 +17,210 @@ const (
 	ProviderName = "ironcore-metal"
 	// LoopbackAddressAnnotation is the annotation used to specify a loopback address for the Machine
 	LoopbackAddressAnnotation = "metal.ironcore.dev/loopback-address"
+	// DefaultIgnitionKey is the key of the ignition content in the ignition Secret if no IgnitionSecretKey is set
+	DefaultIgnitionKey = "ignition"
+)
+
+// HostnameSource is a source the hostname of a Machine can be taken from.
+type HostnameSource string
+
+const (
+	// HostnameSourceProviderSpec takes the hostname from the Hostname field of the ProviderSpec
+	HostnameSourceProviderSpec HostnameSource = "ProviderSpec"
+	// HostnameSourceNodeName takes the hostname from the node name derived by the node name policy
+	HostnameSourceNodeName HostnameSource = "NodeName"
+	// HostnameSourceServerName takes the hostname from the name of the bound Server
+	HostnameSourceServerName HostnameSource = "ServerName"
+)
+
+// IPFamily is the IP address family an IPAM metadata key is expected to allocate.
+type IPFamily string
+
+const (
+	// IPFamilyIPv4 expects IPv4 addresses
+	IPFamilyIPv4 IPFamily = "ipv4"
+	// IPFamilyIPv6 expects IPv6 addresses
+	IPFamilyIPv6 IPFamily = "ipv6"
+)
+
+// MetadataFormat is the serialization format of the metadata file.
+type MetadataFormat string
+
+const (
+	// MetadataFormatJSON serializes the metadata file as JSON
+	MetadataFormatJSON MetadataFormat = "json"
+	// MetadataFormatYAML serializes the metadata file as YAML
+	MetadataFormatYAML MetadataFormat = "yaml"
 )
 
+// DefaultHostnameSources is the priority order of hostname sources used if none is configured
+var DefaultHostnameSources = []HostnameSource{HostnameSourceProviderSpec, HostnameSourceNodeName}
+
 // ProviderSpec is the spec to be used while parsing the calls
 type ProviderSpec struct {
+	// MachineClassName is the name of the MachineClass the provider spec belongs to.
+	MachineClassName string `json:"machineClassName"`
+	// MachinePoolName is the name of the worker pool the MachineClass belongs to.
+	MachinePoolName string `json:"machinePoolName"`
 	// Image is the URL pointing to an OCI registry containing the operating system image which should be used to boot the Machine
+	// If the driver is configured with an image alias ConfigMap, the Image may also be an alias which is resolved on machine creation.
 	Image string `json:"image,omitempty"`
 	// Ignition contains the ignition configuration which should be run on first boot of a Machine.
 	Ignition string `json:"ignition,omitempty"`
 	// By default, if ignition is set it will be merged it with our template
-	// If IgnitionOverride is set to true allows to fully override
+	// Entries of passwd.users with the same name are merged into a single user
+	// If IgnitionOverride is set to true allows to fully override, the overriding ignition must translate to a valid ignition
 	IgnitionOverride bool `json:"ignitionOverride,omitempty"`
+	// AdditionalUserDataKeys are keys of the provider secret which contain additional ignition, e.g. managed by an
+	// operator. The content of each key is merged into the ignition in the given order, missing keys are rejected.
+	AdditionalUserDataKeys []string `json:"additionalUserDataKeys,omitempty"`
 	// IgnitionSecretKey is optional key field used to identify the ignition content in the Secret
 	// If the key is empty, the DefaultIgnitionKey will be used as fallback.
 	IgnitionSecretKey string `json:"ignitionSecretKey,omitempty"`
 	// Labels are used to tag resources which the MCM creates, so they can be identified later.
 	Labels map[string]string `json:"labels,omitempty"`
 	// DnsServers is a list of DNS resolvers which should be configured on the host.
+	// IPv4 and IPv6 addresses can be mixed for dual-stack hosts.
 	DnsServers []netip.Addr `json:"dnsServers,omitempty"`
+	// FallbackDnsServers is a list of DNS resolvers which are configured as FallbackDNS, used if no other DNS server is known.
+	FallbackDnsServers []netip.Addr `json:"fallbackDnsServers,omitempty"`
+	// ResolvConfSymlink links /etc/resolv.conf to the stub resolver of systemd-resolved, as writing the file on hosts
+	// using systemd-resolved may break the name resolution.
+	ResolvConfSymlink bool `json:"resolvConfSymlink,omitempty"`
+	// BindTimeoutSeconds is the time CreateMachine waits for the server of the ServerClaim to be bound before it returns,
+	// unless the ServerClaimName node name policy is used. A zero value returns immediately if the server is not bound.
+	BindTimeoutSeconds int32 `json:"bindTimeoutSeconds,omitempty"`
 	// ServerLabels are passed to the ServerClaim to find a server with certain properties
 	ServerLabels map[string]string `json:"serverLabels,omitempty"`
+	// ServerSelectorExpressions are passed as match expressions of the server selector to the ServerClaim in addition
+	// to the ServerLabels, e.g. to select servers of several instance types.
+	ServerSelectorExpressions []metav1.LabelSelectorRequirement `json:"serverSelectorExpressions,omitempty"`
 	// Metadata is a key-value map of additional data which should be passed to the Machine.
 	Metadata map[string]any `json:"metadata,omitempty"`
+	// MetadataFormat is the format the metadata file is serialized in, either json or yaml. Defaults to json.
+	MetadataFormat MetadataFormat `json:"metadataFormat,omitempty"`
 	// IPAMConfig is a list of references to Network resources that should be used to assign IP addresses to the worker nodes.
 	IPAMConfig []IPAMConfig `json:"ipamConfig,omitempty"`
+	// Hostname is an explicit hostname which should be configured on the Machine.
+	Hostname string `json:"hostname,omitempty"`
+	// HostnameSources is the priority order of the sources the hostname of the Machine is taken from.
+	// The first source providing a non-empty value is used.
+	// If HostnameSources is empty, the DefaultHostnameSources (ProviderSpec, NodeName) will be used as fallback.
+	HostnameSources []HostnameSource `json:"hostnameSources,omitempty"`
+	// AwaitIPAddressBindingOnCreate creates the IPAddressClaims of the IPAMConfig on machine creation and waits until
+	// all of them are bound before the ServerClaim is created, so that a server is only claimed once its IP addresses are allocated.
+	// The wait for the ServerClaim to be bound, required by node name policies other than ServerClaimName, starts afterwards.
+	AwaitIPAddressBindingOnCreate bool `json:"awaitIPAddressBindingOnCreate,omitempty"`
+	// CloudConfigInitDropins are systemd drop-ins which are rendered for the generated cloud-config-init.service,
+	// e.g. to add further After= dependencies without replacing the unit.
+	CloudConfigInitDropins []SystemdDropin `json:"cloudConfigInitDropins,omitempty"`
+	// PropagateCreationTimestamp adds the creation time of the Machine, or of the ServerClaim if the Machine has none,
+	// in RFC3339 format under the createdAt key to the metadata.
+	PropagateCreationTimestamp bool `json:"propagateCreationTimestamp,omitempty"`
+	// LUKS is a list of devices which are encrypted with LUKS on first boot, they are rendered into the storage.luks
+	// section of the ignition.
+	LUKS []LUKSDevice `json:"luks,omitempty"`
+	// Groups is a list of groups which are created on first boot, they are rendered into the passwd.groups section
+	// of the ignition.
+	Groups []IgnitionGroup `json:"groups,omitempty"`
+	// Users is a list of users which are created on first boot, they are rendered into the passwd.users section of
+	// the ignition. Users of the same name in the ignition are merged with them.
+	Users []IgnitionUser `json:"users,omitempty"`
+	// IgnitionPaths overrides the paths of the files rendered into the ignition, e.g. for images using another
+	// cloud-config base directory. Empty paths default to the paths of the ignition template.
+	IgnitionPaths *IgnitionPaths `json:"ignitionPaths,omitempty"`
+	// NodeNamePolicy overrides the node name policy of the driver for the Machines of the MachineClass.
+	// If NodeNamePolicy is empty, the node name policy of the driver is used.
+	NodeNamePolicy cmd.NodeNamePolicy `json:"nodeNamePolicy,omitempty"`
+}
+
+// IgnitionPaths are the paths of the files rendered into the ignition.
+type IgnitionPaths struct {
+	// MetadataPath is the path of the metadata file, defaults to /var/lib/metal-cloud-config/metadata.
+	MetadataPath string `json:"metadataPath,omitempty"`
+	// InitScriptPath is the path of the init script run by the cloud-config-init.service, defaults to
+	// /var/lib/metal-cloud-config/init.sh. The init.done marker of the service is placed next to the init script
+	// unless InitDoneMarkerPath is set.
+	InitScriptPath string `json:"initScriptPath,omitempty"`
+	// InitDoneMarkerPath is the path of the marker file created once the init script succeeded, which prevents the
+	// cloud-config-init.service from running again. Defaults to init.done next to the init script.
+	InitDoneMarkerPath string `json:"initDoneMarkerPath,omitempty"`
+	// HostnamePath is the path of the hostname file, defaults to /etc/hostname.
+	HostnamePath string `json:"hostnamePath,omitempty"`
+}
+
+// IgnitionGroup is a group which is created on first boot.
+type IgnitionGroup struct {
+	// Name is the name of the group.
+	Name string `json:"name"`
+	// GID is the optional ID of the group.
+	GID *int `json:"gid,omitempty"`
+	// System creates a system group, which gets an ID of the system range if no GID is set.
+	System bool `json:"system,omitempty"`
+}
+
+// IgnitionUser is a user which is created on first boot.
+type IgnitionUser struct {
+	// Name is the name of the user.
+	Name string `json:"name"`
+	// UID is the optional ID of the user.
+	UID *int `json:"uid,omitempty"`
+	// PrimaryGroup is the optional name of the primary group of the user.
+	PrimaryGroup string `json:"primaryGroup,omitempty"`
+	// Groups are the names of the supplementary groups of the user, e.g. groups of the Groups list.
+	Groups []string `json:"groups,omitempty"`
+	// HomeDir is the optional absolute path of the home directory of the user.
+	HomeDir string `json:"homeDir,omitempty"`
+	// NoCreateHome skips the creation of the home directory.
+	NoCreateHome bool `json:"noCreateHome,omitempty"`
+	// Shell is the optional absolute path of the login shell of the user.
+	Shell string `json:"shell,omitempty"`
+	// System creates a system user, which gets an ID of the system range if no UID is set.
+	System bool `json:"system,omitempty"`
+	// SSHAuthorizedKeys are the public SSH keys which are authorized to log in as the user.
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+// LUKSDevice is a device which is encrypted with LUKS.
+type LUKSDevice struct {
+	// Name is the name of the LUKS device, the opened device is available at /dev/mapper/<name>.
+	Name string `json:"name"`
+	// Device is the absolute path of the encrypted device, e.g. /dev/disk/by-partlabel/data.
+	Device string `json:"device"`
+	// Label is the optional label of the LUKS device.
+	Label string `json:"label,omitempty"`
+	// WipeVolume wipes an existing LUKS device instead of failing if its configuration does not match.
+	WipeVolume bool `json:"wipeVolume,omitempty"`
+	// Options are additional options passed to cryptsetup luksFormat, e.g. to configure the key slot.
+	Options []string `json:"options,omitempty"`
+	// Clevis is the optional binding of the LUKS device used to unlock it without a key file.
+	Clevis *ClevisBinding `json:"clevis,omitempty"`
+}
+
+// ClevisBinding binds a LUKS device to a TPM2 and/or Tang servers.
+type ClevisBinding struct {
+	// TPM2 binds the LUKS device to the TPM2 of the server.
+	TPM2 bool `json:"tpm2,omitempty"`
+	// Tang is a list of Tang servers the LUKS device is bound to.
+	Tang []TangServer `json:"tang,omitempty"`
+	// Threshold is the number of bindings which have to be satisfied to unlock the device, defaults to 1.
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// TangServer is a Tang server a LUKS device is bound to.
+type TangServer struct {
+	// URL is the URL of the Tang server.
+	URL string `json:"url"`
+	// Thumbprint is the optional thumbprint of a trusted signing key of the Tang server.
+	Thumbprint string `json:"thumbprint,omitempty"`
+}
+
+// SystemdDropin is a drop-in file of a systemd unit.
+type SystemdDropin struct {
+	// Name is the file name of the drop-in, it has to end with .conf.
+	Name string `json:"name"`
+	// Contents is the content of the drop-in.
+	Contents string `json:"contents"`
 }
 
 // IPAMObjectReference is a reference to the IPAM object, which will be used for IP allocation.
@@ -52,8 +235,17 @@ type IPAMObjectReference struct {
 
 // IPAMConfig is a reference to an IPAM resource.
 type IPAMConfig struct {
-	// MetadataKey is the name of metadata key for the network.
+	// MetadataKey is the name of metadata key for the network. It is required as it also names the IPAddressClaim,
+	// so it has to be unique within the provider spec and a valid DNS-1123 label.
 	MetadataKey string `json:"metadataKey"`
 	// IPAMRef is a reference to the IPAM object, which will be used for IP allocation.
 	IPAMRef *IPAMObjectReference `json:"ipamRef"`
+	// IPFamily is the optional IP address family (ipv4 or ipv6) the allocated IPAddress is expected to have.
+	// The initialization of the Machine fails if the allocated IPAddress is of a different family.
+	IPFamily IPFamily `json:"ipFamily,omitempty"`
+	// DefaultGateway is the gateway added to the metadata if the allocated IPAddress does not specify one, e.g. for
+	// pools without a gateway.
+	DefaultGateway string `json:"defaultGateway,omitempty"`
+	// DefaultPrefix is the prefix added to the metadata if the allocated IPAddress does not specify one.
+	DefaultPrefix int `json:"defaultPrefix,omitempty"`
 }
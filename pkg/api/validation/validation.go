@@ -4,13 +4,25 @@
 package validation
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
 	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/ignition"
 
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 )
@@ -18,16 +30,71 @@ import (
 const (
 	LabelKeyServerClaimName      = "metal.ironcore.dev/server-claim-name"
 	LabelKeyServerClaimNamespace = "metal.ironcore.dev/server-claim-namespace"
+	LabelKeyManagedBy            = "app.kubernetes.io/managed-by"
 
-	AnnotationKeyMCMMachineRecreate = "metal.ironcore.dev/mcm-machine-recreate"
+	AnnotationKeyMCMMachineRecreate   = "metal.ironcore.dev/mcm-machine-recreate"
+	AnnotationKeyIPAddresses          = "metal.ironcore.dev/ip-addresses"
+	AnnotationKeyMachineClassName     = "metal.ironcore.dev/machine-class-name"
+	AnnotationKeyImage                = "metal.ironcore.dev/image"
+	AnnotationKeyDeleteDryRun         = "metal.ironcore.dev/delete-dry-run"
+	AnnotationKeyProvisioningStart    = "metal.ironcore.dev/provisioning-start"
+	AnnotationKeyProvisioningFinished = "metal.ironcore.dev/provisioning-finished"
+	AnnotationKeyIgnitionHash         = "metal.ironcore.dev/ignition-hash"
+	AnnotationKeyPendingIPAMPools     = "metal.ironcore.dev/pending-ipam-pool"
+	AnnotationKeyMaintenance          = "metal.ironcore.dev/maintenance"
+	AnnotationKeyMetalNamespace       = "metal.ironcore.dev/metal-namespace"
+
+	SecretKeyImage = "image"
 )
 
+// Options contains the optional settings of the provider spec validation
+type Options struct {
+	// AllowDiskless allows an empty image for servers which boot without a disk
+	AllowDiskless bool
+	// AllowedMetadataKeys are the only metadata keys which may be used if set
+	AllowedMetadataKeys []string
+	// DeniedMetadataKeys are metadata keys which must not be used
+	DeniedMetadataKeys []string
+	// NodeNameLabelKey is the node name label key of the driver, which is required by the ServerLabel node name policy
+	NodeNameLabelKey string
+}
+
 // ValidateProviderSpecAndSecret validates the provider spec and provider secret
-func ValidateProviderSpecAndSecret(spec *v1alpha1.ProviderSpec, secret *corev1.Secret, fldPath *field.Path) field.ErrorList {
+func ValidateProviderSpecAndSecret(spec *v1alpha1.ProviderSpec, secret *corev1.Secret, fldPath *field.Path, opts Options) field.ErrorList {
 	var allErrs field.ErrorList
 
-	allErrs = validateMachineClassSpec(spec, field.NewPath("spec"))
+	allErrs = validateMachineClassSpec(spec, field.NewPath("spec"), opts)
 	allErrs = append(allErrs, validateSecret(secret, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateAdditionalUserData(spec.AdditionalUserDataKeys, secret)...)
+
+	return allErrs
+}
+
+// ReservedKeyPrefix is the prefix of label and annotation keys which are set by the driver or the metal-operator
+const ReservedKeyPrefix = "metal.ironcore.dev/"
+
+// ValidateProviderSpecFindings returns non-critical findings of the provider spec, which do not prevent the creation of
+// a machine but hint at a misconfiguration, e.g. a server selector matching any server
+func ValidateProviderSpecFindings(spec *v1alpha1.ProviderSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(spec.ServerLabels) == 0 && len(spec.ServerSelectorExpressions) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("serverLabels"), "an empty server selector matches any free server"))
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(spec.Labels)) {
+		if key == LabelKeyManagedBy || strings.HasPrefix(key, ReservedKeyPrefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("labels").Key(key), spec.Labels[key], "label key is reserved by the driver"))
+		}
+	}
+
+	seen := make(map[netip.Addr]bool, len(spec.DnsServers))
+	for i, ip := range spec.DnsServers {
+		if seen[ip] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("dnsServers").Index(i), ip))
+		}
+		seen[ip] = true
+	}
 
 	return allErrs
 }
@@ -48,23 +115,497 @@ func validateSecret(secret *corev1.Secret, fldPath *field.Path) field.ErrorList
 	return allErrs
 }
 
-// validateMachineClassSpec validates if image is set and if DNS servers are valid IP addresses
-func validateMachineClassSpec(spec *v1alpha1.ProviderSpec, fldPath *field.Path) field.ErrorList {
+// validateAdditionalUserData checks if the secret contains all additional user data keys and that each of them is a
+// valid ignition fragment
+func validateAdditionalUserData(keys []string, secret *corev1.Secret) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if secret == nil {
+		return allErrs
+	}
+
+	for _, key := range keys {
+		data, ok := secret.Data[key]
+		if !ok {
+			allErrs = append(allErrs, field.Required(field.NewPath(key), fmt.Sprintf("additional user data key %q is required", key)))
+			continue
+		}
+		if err := ignition.ValidateAdditional(string(data)); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath(key), field.OmitValueType{}, fmt.Sprintf("additional user data is no valid ignition: %v", err)))
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateSecretForMachineClass checks if the secret is intended for the MachineClass.
+// The check is only performed if the secret is annotated with the name of a MachineClass.
+func ValidateSecretForMachineClass(secret *corev1.Secret, machineClassName string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if secret == nil {
+		return allErrs
+	}
+
+	expectedName, ok := secret.Annotations[AnnotationKeyMachineClassName]
+	if ok && expectedName != machineClassName {
+		allErrs = append(allErrs, field.Invalid(
+			fldPath.Child("metadata", "annotations").Key(AnnotationKeyMachineClassName),
+			expectedName,
+			fmt.Sprintf("secret is not intended for MachineClass %q", machineClassName),
+		))
+	}
+
+	return allErrs
+}
+
+// ValidateSecretNamespace checks if the secret is located in the expected namespace or in one of the allowed
+// namespaces, so that a misrouted secret of another namespace is not used.
+func ValidateSecretNamespace(secret *corev1.Secret, expectedNamespace string, allowedNamespaces []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if secret == nil {
+		return allErrs
+	}
+
+	if secret.Namespace != expectedNamespace && !slices.Contains(allowedNamespaces, secret.Namespace) {
+		allErrs = append(allErrs, field.Invalid(
+			fldPath.Child("metadata", "namespace"),
+			secret.Namespace,
+			fmt.Sprintf("secret is not located in the namespace %q of the MachineClass or an allowed namespace", expectedNamespace),
+		))
+	}
+
+	return allErrs
+}
+
+var supportedHostnameSources = []v1alpha1.HostnameSource{
+	v1alpha1.HostnameSourceProviderSpec,
+	v1alpha1.HostnameSourceNodeName,
+	v1alpha1.HostnameSourceServerName,
+}
+
+// supportedNodeNamePolicies are the node name policies a MachineClass can override the driver policy with
+var supportedNodeNamePolicies = []cmd.NodeNamePolicy{
+	cmd.NodeNamePolicyBMCName,
+	cmd.NodeNamePolicyServerName,
+	cmd.NodeNamePolicyServerClaimName,
+	cmd.NodeNamePolicyServerLabel,
+}
+
+// supportedIPFamilies are the IP families an IPAMConfig can expect
+var supportedIPFamilies = []v1alpha1.IPFamily{
+	v1alpha1.IPFamilyIPv4,
+	v1alpha1.IPFamilyIPv6,
+}
+
+// supportedMetadataFormats are the formats the metadata file can be serialized in
+var supportedMetadataFormats = []v1alpha1.MetadataFormat{
+	v1alpha1.MetadataFormatJSON,
+	v1alpha1.MetadataFormatYAML,
+}
+
+// supportedIPAMAPIGroups are the API groups of IPAM objects for which the provider creates CAPI IPAddressClaims
+var supportedIPAMAPIGroups = []string{
+	capiv1beta1.GroupVersion.Group,
+}
+
+// validateMachineClassSpec validates if image is set unless diskless servers are allowed, if DNS servers are valid IP addresses,
+// if the hostname configuration is valid, if the IPAM references use a supported API group, if the metadata keys are
+// allowed, if the metadata values can be rendered as JSON and if the drop-in names and LUKS devices are valid
+func validateMachineClassSpec(spec *v1alpha1.ProviderSpec, fldPath *field.Path, opts Options) field.ErrorList {
 	var allErrs field.ErrorList
 
-	if spec.Image == "" {
+	allErrs = append(allErrs, validateName(spec.MachineClassName, fldPath.Child("machineClassName"))...)
+	allErrs = append(allErrs, validateName(spec.MachinePoolName, fldPath.Child("machinePoolName"))...)
+
+	if spec.Image == "" && !opts.AllowDiskless {
 		allErrs = append(allErrs, field.Required(fldPath.Child("image"), "image is required"))
 	}
 
-	for i, ip := range spec.DnsServers {
-		if !netip.Addr.IsValid(ip) {
-			allErrs = append(allErrs, field.Invalid(fldPath.Child("dnsServers").Index(i), ip, "ip is invalid"))
+	allErrs = append(allErrs, validateDnsServers(spec.DnsServers, fldPath.Child("dnsServers"))...)
+	allErrs = append(allErrs, validateDnsServers(spec.FallbackDnsServers, fldPath.Child("fallbackDnsServers"))...)
+
+	// the overriding ignition replaces parts of the template, so it must form a valid ignition on its own
+	if spec.IgnitionOverride && spec.Ignition != "" {
+		if err := ignition.Validate(spec.Ignition, true); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ignition"), field.OmitValueType{}, fmt.Sprintf("overriding ignition is invalid: %v", err)))
+		}
+	}
+
+	if spec.IgnitionSecretKey != "" {
+		for _, msg := range utilvalidation.IsConfigMapKey(spec.IgnitionSecretKey) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ignitionSecretKey"), spec.IgnitionSecretKey, msg))
+		}
+	}
+
+	seenUserDataKeys := make(map[string]bool, len(spec.AdditionalUserDataKeys))
+	for i, key := range spec.AdditionalUserDataKeys {
+		keyPath := fldPath.Child("additionalUserDataKeys").Index(i)
+		for _, msg := range utilvalidation.IsConfigMapKey(key) {
+			allErrs = append(allErrs, field.Invalid(keyPath, key, msg))
+		}
+		if key == "userData" {
+			allErrs = append(allErrs, field.Invalid(keyPath, key, "userData is rendered as init script and can not be merged as ignition"))
+		}
+		if seenUserDataKeys[key] {
+			allErrs = append(allErrs, field.Duplicate(keyPath, key))
+		}
+		seenUserDataKeys[key] = true
+	}
+
+	for i, requirement := range spec.ServerSelectorExpressions {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelectorRequirement(requirement, metav1validation.LabelSelectorValidationOptions{}, fldPath.Child("serverSelectorExpressions").Index(i))...)
+	}
+
+	if spec.BindTimeoutSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("bindTimeoutSeconds"), spec.BindTimeoutSeconds, "must not be negative"))
+	}
+
+	allErrs = append(allErrs, validateHostname(spec, fldPath)...)
+
+	if spec.NodeNamePolicy != "" && !slices.Contains(supportedNodeNamePolicies, spec.NodeNamePolicy) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("nodeNamePolicy"), spec.NodeNamePolicy, supportedNodeNamePolicies))
+	} else if spec.NodeNamePolicy == cmd.NodeNamePolicyServerLabel && opts.NodeNameLabelKey == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("nodeNamePolicy"), spec.NodeNamePolicy, "node name policy requires a node name label key of the driver"))
+	}
+
+	// the metadata key is part of the IPAddressClaim name, so it has to be unique and a valid DNS-1123 label
+	seenMetadataKeys := make(map[string]bool, len(spec.IPAMConfig))
+	for i, ipamConfig := range spec.IPAMConfig {
+		metadataKeyPath := fldPath.Child("ipamConfig").Index(i).Child("metadataKey")
+		if ipamConfig.MetadataKey == "" {
+			allErrs = append(allErrs, field.Required(metadataKeyPath, "metadataKey is required"))
+		} else {
+			for _, msg := range utilvalidation.IsDNS1123Label(ipamConfig.MetadataKey) {
+				allErrs = append(allErrs, field.Invalid(metadataKeyPath, ipamConfig.MetadataKey, msg))
+			}
+			if seenMetadataKeys[ipamConfig.MetadataKey] {
+				allErrs = append(allErrs, field.Duplicate(metadataKeyPath, ipamConfig.MetadataKey))
+			}
+			seenMetadataKeys[ipamConfig.MetadataKey] = true
+		}
+		if ipamConfig.IPAMRef != nil && !slices.Contains(supportedIPAMAPIGroups, ipamConfig.IPAMRef.APIGroup) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("ipamConfig").Index(i).Child("ipamRef", "apiGroup"), ipamConfig.IPAMRef.APIGroup, supportedIPAMAPIGroups))
+		}
+		if ipamConfig.IPFamily != "" && !slices.Contains(supportedIPFamilies, ipamConfig.IPFamily) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("ipamConfig").Index(i).Child("ipFamily"), ipamConfig.IPFamily, supportedIPFamilies))
+		}
+		if ipamConfig.DefaultGateway != "" {
+			if _, err := netip.ParseAddr(ipamConfig.DefaultGateway); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("ipamConfig").Index(i).Child("defaultGateway"), ipamConfig.DefaultGateway, "default gateway is no valid IP address"))
+			}
+		}
+		if ipamConfig.DefaultPrefix < 0 || ipamConfig.DefaultPrefix > 128 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ipamConfig").Index(i).Child("defaultPrefix"), ipamConfig.DefaultPrefix, "default prefix must be in the range 0-128"))
+		}
+	}
+
+	allErrs = append(allErrs, validateMetadataKeys(spec.Metadata, fldPath.Child("metadata"), opts)...)
+	for _, key := range slices.Sorted(maps.Keys(spec.Metadata)) {
+		allErrs = append(allErrs, validateMetadataValue(spec.Metadata[key], fldPath.Child("metadata").Key(key))...)
+	}
+	if spec.MetadataFormat != "" && !slices.Contains(supportedMetadataFormats, spec.MetadataFormat) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("metadataFormat"), spec.MetadataFormat, supportedMetadataFormats))
+	}
+	allErrs = append(allErrs, validateSystemdDropins(spec.CloudConfigInitDropins, fldPath.Child("cloudConfigInitDropins"))...)
+	allErrs = append(allErrs, validateLUKSDevices(spec.LUKS, fldPath.Child("luks"))...)
+	allErrs = append(allErrs, validateIgnitionGroups(spec.Groups, fldPath.Child("groups"))...)
+	allErrs = append(allErrs, validateIgnitionUsers(spec.Users, fldPath.Child("users"))...)
+	if spec.IgnitionPaths != nil {
+		allErrs = append(allErrs, validateIgnitionPaths(spec.IgnitionPaths, fldPath.Child("ignitionPaths"))...)
+	}
+
+	return allErrs
+}
+
+// validateName validates that the name is set and a DNS-1123 subdomain
+func validateName(name string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if name == "" {
+		return append(allErrs, field.Required(fldPath, "name is required"))
+	}
+	for _, msg := range utilvalidation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+
+	return allErrs
+}
+
+// validateDnsServers validates that all DNS servers are valid IPv4 or IPv6 addresses
+func validateDnsServers(dnsServers []netip.Addr, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, ip := range dnsServers {
+		if !ip.IsValid() {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), ip, "ip is invalid"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateMetadataKeys validates that no denied metadata key is used and, if an allowlist is set, that only allowed keys are used
+func validateMetadataKeys(metadata map[string]any, fldPath *field.Path, opts Options) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		switch {
+		case slices.Contains(opts.DeniedMetadataKeys, key):
+			allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), "metadata key is denied"))
+		case len(opts.AllowedMetadataKeys) > 0 && !slices.Contains(opts.AllowedMetadataKeys, key):
+			allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), fmt.Sprintf("metadata key is not allowed, allowed keys are %v", opts.AllowedMetadataKeys)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateMetadataValue validates that the metadata value only consists of JSON scalars, maps and lists, so that it can
+// be rendered into the metadata file of the ignition
+func validateMetadataValue(value any, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch v := value.(type) {
+	case nil, string, bool, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			allErrs = append(allErrs, field.Invalid(fldPath, field.OmitValueType{}, "metadata value must be a finite number"))
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			allErrs = append(allErrs, field.Invalid(fldPath, field.OmitValueType{}, "metadata value must be a finite number"))
+		}
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			allErrs = append(allErrs, validateMetadataValue(v[key], fldPath.Key(key))...)
+		}
+	case []any:
+		for i, item := range v {
+			allErrs = append(allErrs, validateMetadataValue(item, fldPath.Index(i))...)
+		}
+	default:
+		allErrs = append(allErrs, field.Invalid(fldPath, field.OmitValueType{}, fmt.Sprintf("metadata value of type %T can not be rendered as JSON", value)))
+	}
+
+	return allErrs
+}
+
+// validateSystemdDropins validates that the drop-in names are unique .conf file names
+func validateSystemdDropins(dropins []v1alpha1.SystemdDropin, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool, len(dropins))
+	for i, dropin := range dropins {
+		namePath := fldPath.Index(i).Child("name")
+		switch {
+		case dropin.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "drop-in name is required"))
+		case strings.ContainsRune(dropin.Name, '/') || !strings.HasSuffix(dropin.Name, ".conf") || dropin.Name == ".conf":
+			allErrs = append(allErrs, field.Invalid(namePath, dropin.Name, "drop-in name must be a file name ending with .conf"))
+		case seen[dropin.Name]:
+			allErrs = append(allErrs, field.Duplicate(namePath, dropin.Name))
+		}
+		seen[dropin.Name] = true
+	}
+
+	return allErrs
+}
+
+// validateLUKSDevices validates that the LUKS devices have unique names, absolute device paths and valid clevis bindings
+func validateLUKSDevices(devices []v1alpha1.LUKSDevice, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool, len(devices))
+	for i, device := range devices {
+		idxPath := fldPath.Index(i)
+
+		switch {
+		case device.Name == "":
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "LUKS device name is required"))
+		case strings.ContainsRune(device.Name, '/'):
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), device.Name, "LUKS device name must not contain '/'"))
+		case seen[device.Name]:
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), device.Name))
+		}
+		seen[device.Name] = true
+
+		if device.Device == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("device"), "device is required"))
+		} else if !strings.HasPrefix(device.Device, "/dev/") || path.Clean(device.Device) != device.Device {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("device"), device.Device, "device must be a clean absolute path below /dev/"))
+		}
+
+		if device.Clevis != nil {
+			allErrs = append(allErrs, validateClevisBinding(device.Clevis, idxPath.Child("clevis"))...)
+		}
+	}
+
+	return allErrs
+}
+
+// maxPasswdNameLength is the maximum length of user and group names
+const maxPasswdNameLength = 32
+
+// passwdNameRegexp matches the user and group names accepted by useradd and groupadd
+var passwdNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+// validatePasswdName validates that the name is a valid user or group name
+func validatePasswdName(name string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch {
+	case name == "":
+		allErrs = append(allErrs, field.Required(fldPath, "name is required"))
+	case len(name) > maxPasswdNameLength:
+		allErrs = append(allErrs, field.TooLong(fldPath, name, maxPasswdNameLength))
+	case !passwdNameRegexp.MatchString(name):
+		allErrs = append(allErrs, field.Invalid(fldPath, name, fmt.Sprintf("name must match the regex %s", passwdNameRegexp.String())))
+	}
+
+	return allErrs
+}
+
+// validateIgnitionGroups validates that the groups have unique valid names and non-negative IDs
+func validateIgnitionGroups(groups []v1alpha1.IgnitionGroup, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool, len(groups))
+	for i, group := range groups {
+		idxPath := fldPath.Index(i)
+
+		allErrs = append(allErrs, validatePasswdName(group.Name, idxPath.Child("name"))...)
+		if seen[group.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), group.Name))
+		}
+		seen[group.Name] = true
+
+		if group.GID != nil && *group.GID < 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("gid"), *group.GID, "must not be negative"))
 		}
 	}
 
 	return allErrs
 }
 
+// validateIgnitionUsers validates that the users have unique valid names, valid group names, non-negative IDs and
+// clean absolute home directory and shell paths
+func validateIgnitionUsers(users []v1alpha1.IgnitionUser, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := make(map[string]bool, len(users))
+	for i, user := range users {
+		idxPath := fldPath.Index(i)
+
+		allErrs = append(allErrs, validatePasswdName(user.Name, idxPath.Child("name"))...)
+		if seen[user.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), user.Name))
+		}
+		seen[user.Name] = true
+
+		if user.UID != nil && *user.UID < 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("uid"), *user.UID, "must not be negative"))
+		}
+		if user.PrimaryGroup != "" {
+			allErrs = append(allErrs, validatePasswdName(user.PrimaryGroup, idxPath.Child("primaryGroup"))...)
+		}
+		for j, group := range user.Groups {
+			allErrs = append(allErrs, validatePasswdName(group, idxPath.Child("groups").Index(j))...)
+		}
+
+		for _, p := range []struct {
+			name  string
+			value string
+		}{
+			{"homeDir", user.HomeDir},
+			{"shell", user.Shell},
+		} {
+			if p.value != "" && (!path.IsAbs(p.value) || path.Clean(p.value) != p.value) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child(p.name), p.value, "path must be a clean absolute path"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateClevisBinding validates that the binding has at least as many TPM2 and Tang pins as its threshold requires
+func validateClevisBinding(clevis *v1alpha1.ClevisBinding, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	pins := len(clevis.Tang)
+	if clevis.TPM2 {
+		pins++
+	}
+	if pins == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "clevis binding requires tpm2 or at least one tang server"))
+	}
+	if clevis.Threshold < 0 || clevis.Threshold > pins {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("threshold"), clevis.Threshold, fmt.Sprintf("threshold must be between 0 and the number of bindings (%d)", pins)))
+	}
+
+	for i, tang := range clevis.Tang {
+		if u, err := url.Parse(tang.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("tang").Index(i).Child("url"), tang.URL, "tang URL must be an absolute http or https URL"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateIgnitionPaths validates that the overridden ignition paths are clean absolute paths
+func validateIgnitionPaths(paths *v1alpha1.IgnitionPaths, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, p := range []struct {
+		name  string
+		value string
+	}{
+		{"metadataPath", paths.MetadataPath},
+		{"initScriptPath", paths.InitScriptPath},
+		{"initDoneMarkerPath", paths.InitDoneMarkerPath},
+		{"hostnamePath", paths.HostnamePath},
+	} {
+		if p.value != "" && (!path.IsAbs(p.value) || path.Clean(p.value) != p.value) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(p.name), p.value, "path must be a clean absolute path"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateHostname validates the explicit hostname and the priority order of the hostname sources
+func validateHostname(spec *v1alpha1.ProviderSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.Hostname != "" {
+		for _, msg := range utilvalidation.IsDNS1123Subdomain(spec.Hostname) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("hostname"), spec.Hostname, msg))
+		}
+	}
+
+	seen := make(map[v1alpha1.HostnameSource]bool, len(spec.HostnameSources))
+	for i, source := range spec.HostnameSources {
+		if !slices.Contains(supportedHostnameSources, source) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("hostnameSources").Index(i), source, supportedHostnameSources))
+			continue
+		}
+		if seen[source] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("hostnameSources").Index(i), source))
+		}
+		seen[source] = true
+	}
+
+	// the ProviderSpec source can only provide a hostname if the hostname is set
+	if spec.Hostname == "" && len(seen) == 1 && seen[v1alpha1.HostnameSourceProviderSpec] {
+		allErrs = append(allErrs, field.Required(fldPath.Child("hostname"), "hostname is required if ProviderSpec is the only hostname source"))
+	}
+
+	return allErrs
+}
+
 // ValidateIPAddressClaim validates the IPAddressClaim for a given machine
 func ValidateIPAddressClaim(ipClaim *capiv1beta1.IPAddressClaim, serverClaim *metalv1alpha1.ServerClaim, serverClaimName, serverClaimNamespace string) field.ErrorList {
 	var allErrs field.ErrorList
@@ -99,6 +640,11 @@ func ValidateIPAddressClaim(ipClaim *capiv1beta1.IPAddressClaim, serverClaim *me
 		))
 	}
 
+	// owner references can not cross namespaces, IPAddressClaims in a separate namespace are only bound by labels
+	if ipClaim.Namespace != serverClaim.Namespace {
+		return allErrs
+	}
+
 	if len(ipClaim.OwnerReferences) == 0 {
 		allErrs = append(allErrs, field.Required(field.NewPath("metadata").Child("ownerReferences"), "IPAddressClaim must have an owner reference"))
 	} else {
@@ -5,9 +5,11 @@ package validation
 
 import (
 	"fmt"
+	"math"
 	"net/netip"
 
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -26,7 +28,7 @@ var _ = Describe("Machine", func() {
 
 	DescribeTable("ValidateProviderSpecAndSecret",
 		func(spec *v1alpha1.ProviderSpec, secret *corev1.Secret, fldPath *field.Path, match types.GomegaMatcher) {
-			errList := ValidateProviderSpecAndSecret(spec, secret, fldPath)
+			errList := ValidateProviderSpecAndSecret(spec, secret, fldPath, Options{})
 			Expect(errList).To(match)
 		},
 		Entry("no secret",
@@ -61,6 +63,70 @@ var _ = Describe("Machine", func() {
 			fldPath,
 			ContainElement(field.Invalid(fldPath.Child("spec.dnsServers[0]"), invalidIP, "ip is invalid")),
 		),
+		Entry("unsupported server selector expression operator",
+			&v1alpha1.ProviderSpec{
+				ServerSelectorExpressions: []metav1.LabelSelectorRequirement{{Key: "zone", Operator: "Near", Values: []string{"x"}}},
+			},
+			&corev1.Secret{},
+			fldPath,
+			ContainElement(field.Invalid(fldPath.Child("spec.serverSelectorExpressions[0].operator"), metav1.LabelSelectorOperator("Near"), "not a valid selector operator")),
+		),
+		Entry("server selector expression without values",
+			&v1alpha1.ProviderSpec{
+				ServerSelectorExpressions: []metav1.LabelSelectorRequirement{{Key: "instance-type", Operator: metav1.LabelSelectorOpIn}},
+			},
+			&corev1.Secret{},
+			fldPath,
+			ContainElement(field.Required(fldPath.Child("spec.serverSelectorExpressions[0].values"), "must be specified when `operator` is 'In' or 'NotIn'")),
+		),
+		Entry("negative bind timeout",
+			&v1alpha1.ProviderSpec{
+				BindTimeoutSeconds: -1,
+			},
+			&corev1.Secret{},
+			fldPath,
+			ContainElement(field.Invalid(fldPath.Child("spec.bindTimeoutSeconds"), int32(-1), "must not be negative")),
+		),
+		Entry("duplicate additional user data key",
+			&v1alpha1.ProviderSpec{
+				AdditionalUserDataKeys: []string{"extraUserData", "extraUserData"},
+			},
+			&corev1.Secret{},
+			fldPath,
+			ContainElement(field.Duplicate(fldPath.Child("spec.additionalUserDataKeys[1]"), "extraUserData")),
+		),
+		Entry("userData as additional user data key",
+			&v1alpha1.ProviderSpec{
+				AdditionalUserDataKeys: []string{"userData"},
+			},
+			&corev1.Secret{},
+			fldPath,
+			ContainElement(field.Invalid(fldPath.Child("spec.additionalUserDataKeys[0]"), "userData", "userData is rendered as init script and can not be merged as ignition")),
+		),
+	)
+
+	DescribeTable("ValidateProviderSpecAndSecret with diskless servers",
+		func(spec *v1alpha1.ProviderSpec, opts Options, match types.GomegaMatcher) {
+			errList := ValidateProviderSpecAndSecret(spec, &corev1.Secret{}, fldPath, opts)
+			Expect(errList).To(match)
+		},
+		Entry("no image by default",
+			&v1alpha1.ProviderSpec{},
+			Options{},
+			ContainElement(field.Required(fldPath.Child("spec.image"), "image is required")),
+		),
+		Entry("no image with diskless servers allowed",
+			&v1alpha1.ProviderSpec{},
+			Options{AllowDiskless: true},
+			Not(ContainElement(HaveField("Field", "spec.image"))),
+		),
+		Entry("image with diskless servers allowed",
+			&v1alpha1.ProviderSpec{
+				Image: "my-image",
+			},
+			Options{AllowDiskless: true},
+			Not(ContainElement(HaveField("Field", "spec.image"))),
+		),
 	)
 })
 
@@ -83,25 +149,513 @@ var _ = Describe("validateSecret", func() {
 	})
 })
 
+var _ = Describe("validateAdditionalUserData", func() {
+	It("should return error if an additional user data key is missing", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"userData": []byte("data")}}
+		errs := validateAdditionalUserData([]string{"extraUserData"}, secret)
+		Expect(errs).To(ConsistOf(field.Required(field.NewPath("extraUserData"), `additional user data key "extraUserData" is required`)))
+	})
+
+	It("should return error if the additional user data is no valid ignition", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"extraUserData": []byte("storage: [")}}
+		errs := validateAdditionalUserData([]string{"extraUserData"}, secret)
+		Expect(errs).To(ConsistOf(HaveField("Field", "extraUserData")))
+	})
+
+	It("should not return error if the additional user data is valid ignition", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"extraUserData": []byte("storage:\n  files:\n  - path: /etc/extra\n")}}
+		errs := validateAdditionalUserData([]string{"extraUserData"}, secret)
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should not interpret the additional user data as template", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"extraUserData": []byte("storage:\n  files:\n  - path: /etc/extra\n    contents:\n      inline: '{{ .NotATemplate'\n")}}
+		errs := validateAdditionalUserData([]string{"extraUserData"}, secret)
+		Expect(errs).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ValidateSecretForMachineClass", func() {
+	It("should not return error if the secret is not annotated", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"userData": []byte("data")}}
+		errs := ValidateSecretForMachineClass(secret, "foo", field.NewPath("secret"))
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should not return error if the secret is intended for the MachineClass", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{AnnotationKeyMachineClassName: "foo"},
+		}}
+		errs := ValidateSecretForMachineClass(secret, "foo", field.NewPath("secret"))
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error if the secret is intended for another MachineClass", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{AnnotationKeyMachineClassName: "bar"},
+		}}
+		errs := ValidateSecretForMachineClass(secret, "foo", field.NewPath("secret"))
+		Expect(errs).To(ConsistOf(field.Invalid(
+			field.NewPath("secret", "metadata", "annotations").Key(AnnotationKeyMachineClassName),
+			"bar",
+			`secret is not intended for MachineClass "foo"`,
+		)))
+	})
+})
+
+var _ = Describe("ValidateSecretNamespace", func() {
+	It("should not return error if the secret is located in the namespace of the MachineClass", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "foo"}}
+		errs := ValidateSecretNamespace(secret, "foo", nil, field.NewPath("secret"))
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should not return error if the secret is located in an allowed namespace", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "bar"}}
+		errs := ValidateSecretNamespace(secret, "foo", []string{"bar"}, field.NewPath("secret"))
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error if the secret is located in another namespace", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "baz"}}
+		errs := ValidateSecretNamespace(secret, "foo", []string{"bar"}, field.NewPath("secret"))
+		Expect(errs).To(ConsistOf(field.Invalid(
+			field.NewPath("secret", "metadata", "namespace"),
+			"baz",
+			`secret is not located in the namespace "foo" of the MachineClass or an allowed namespace`,
+		)))
+	})
+})
+
 var _ = Describe("validateMachineClassSpec", func() {
 	It("should return error if image is empty", func() {
 		spec := &v1alpha1.ProviderSpec{Image: ""}
-		errs := validateMachineClassSpec(spec, field.NewPath("spec"))
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
 		Expect(errs).To(ContainElement(field.Required(field.NewPath("spec.image"), "image is required")))
 	})
 
+	It("should return error if the MachineClass and pool names are empty", func() {
+		spec := &v1alpha1.ProviderSpec{Image: "img"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Required(field.NewPath("spec.machineClassName"), "name is required"),
+			field.Required(field.NewPath("spec.machinePoolName"), "name is required"),
+		))
+	})
+
+	It("should return error for invalid MachineClass and pool names", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "Foo", MachinePoolName: "foo_bar", Image: "img"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.machineClassName"), "Foo", "a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')"),
+			field.Invalid(field.NewPath("spec.machinePoolName"), "foo_bar", "a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')"),
+		))
+	})
+
 	It("should return error for invalid dnsServers", func() {
-		spec := &v1alpha1.ProviderSpec{Image: "img", DnsServers: []netip.Addr{{}}}
-		errs := validateMachineClassSpec(spec, field.NewPath("spec"))
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", DnsServers: []netip.Addr{{}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
 		Expect(errs).To(ContainElement(field.Invalid(field.NewPath("spec.dnsServers").Index(0), netip.Addr{}, "ip is invalid")))
 	})
 
+	It("should return error for the invalid entry of mixed dnsServers and fallbackDnsServers", func() {
+		spec := &v1alpha1.ProviderSpec{
+			MachineClassName:   "foo",
+			MachinePoolName:    "foo",
+			Image:              "img",
+			DnsServers:         []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2001:db8::53"), {}},
+			FallbackDnsServers: []netip.Addr{{}, netip.MustParseAddr("9.9.9.9")},
+		}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.dnsServers").Index(2), netip.Addr{}, "ip is invalid"),
+			field.Invalid(field.NewPath("spec.fallbackDnsServers").Index(0), netip.Addr{}, "ip is invalid"),
+		))
+	})
+
 	It("should not return error for valid image and dnsServers", func() {
 		addr := netip.MustParseAddr("8.8.8.8")
-		spec := &v1alpha1.ProviderSpec{Image: "img", DnsServers: []netip.Addr{addr}}
-		errs := validateMachineClassSpec(spec, field.NewPath("spec"))
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", DnsServers: []netip.Addr{addr}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should not return error for a valid overriding ignition", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionOverride: true, Ignition: `storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+      contents:
+        inline: hello`}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for a malformed overriding ignition", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionOverride: true, Ignition: "storage: [files"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(SatisfyAll(
+			HaveField("Type", field.ErrorTypeInvalid),
+			HaveField("Field", "spec.ignition"),
+			HaveField("BadValue", field.OmitValueType{}),
+		)))
+	})
+
+	It("should return error for an overriding ignition with an unsupported version", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionOverride: true, Ignition: "version: 0.0.1"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(SatisfyAll(
+			HaveField("Field", "spec.ignition"),
+			HaveField("Detail", ContainSubstring("overriding ignition is invalid")),
+		)))
+	})
+
+	It("should return error for an invalid ignition secret key", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionSecretKey: "config/ign"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.Invalid(field.NewPath("spec.ignitionSecretKey"), "config/ign", "a valid config key must consist of alphanumeric characters, '-', '_' or '.' (e.g. 'key.name',  or 'KEY_NAME',  or 'key-name', regex used for validation is '[-._a-zA-Z0-9]+')")))
+	})
+
+	It("should not return error for valid ignition paths", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionPaths: &v1alpha1.IgnitionPaths{
+			MetadataPath:   "/opt/cloud-config/metadata",
+			InitScriptPath: "/opt/cloud-config/init.sh",
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
 		Expect(errs).To(BeEmpty())
 	})
+
+	It("should return error for relative and unclean ignition paths", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IgnitionPaths: &v1alpha1.IgnitionPaths{
+			InitScriptPath:     "cloud-config/init.sh",
+			HostnamePath:       "/etc/../hostname",
+			InitDoneMarkerPath: "run/init.done",
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.ignitionPaths.initScriptPath"), "cloud-config/init.sh", "path must be a clean absolute path"),
+			field.Invalid(field.NewPath("spec.ignitionPaths.hostnamePath"), "/etc/../hostname", "path must be a clean absolute path"),
+			field.Invalid(field.NewPath("spec.ignitionPaths.initDoneMarkerPath"), "run/init.done", "path must be a clean absolute path"),
+		))
+	})
+
+	It("should not return error for an IPAM reference with the CAPI IPAM API group", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			MetadataKey: "foo",
+			IPAMRef:     &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"},
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for an IPAM reference with an unsupported API group", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			MetadataKey: "foo",
+			IPAMRef:     &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.example.com", Kind: "IPPool"},
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.NotSupported(field.NewPath("spec.ipamConfig").Index(0).Child("ipamRef", "apiGroup"), "ipam.example.com", supportedIPAMAPIGroups)))
+	})
+
+	It("should return error for an IPAM config without a metadata key", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			IPAMRef: &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"},
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.Required(field.NewPath("spec.ipamConfig").Index(0).Child("metadataKey"), "metadataKey is required")))
+	})
+
+	It("should return error for an invalid default gateway and prefix", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			MetadataKey:    "foo",
+			IPAMRef:        &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"},
+			DefaultGateway: "10.0.0",
+			DefaultPrefix:  129,
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.ipamConfig").Index(0).Child("defaultGateway"), "10.0.0", "default gateway is no valid IP address"),
+			field.Invalid(field.NewPath("spec.ipamConfig").Index(0).Child("defaultPrefix"), 129, "default prefix must be in the range 0-128"),
+		))
+	})
+
+	It("should return error for duplicate metadata keys", func() {
+		ipamRef := &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"}
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{
+			{MetadataKey: "foo", IPAMRef: ipamRef},
+			{MetadataKey: "bar", IPAMRef: ipamRef},
+			{MetadataKey: "foo", IPAMRef: ipamRef},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.Duplicate(field.NewPath("spec.ipamConfig").Index(2).Child("metadataKey"), "foo")))
+	})
+
+	It("should return error for a metadata key which is no DNS-1123 label", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			MetadataKey: "Foo_Bar",
+			IPAMRef:     &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"},
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(HaveField("Field", "spec.ipamConfig[0].metadataKey")))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+	})
+
+	It("should return error for an unsupported IP family", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", IPAMConfig: []v1alpha1.IPAMConfig{{
+			MetadataKey: "foo",
+			IPAMRef:     &v1alpha1.IPAMObjectReference{Name: "pool", APIGroup: "ipam.cluster.x-k8s.io", Kind: "GlobalInClusterIPPool"},
+			IPFamily:    "IPv4",
+		}}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.NotSupported(field.NewPath("spec.ipamConfig").Index(0).Child("ipFamily"), v1alpha1.IPFamily("IPv4"), supportedIPFamilies)))
+	})
+
+	It("should return error for an invalid hostname", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Hostname: "Invalid_Hostname"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ContainElement(HaveField("Field", "spec.hostname")))
+	})
+
+	It("should return error for an unsupported node name policy", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", NodeNamePolicy: "Hostname"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.NotSupported(field.NewPath("spec.nodeNamePolicy"), cmd.NodeNamePolicy("Hostname"), supportedNodeNamePolicies)))
+	})
+
+	It("should return error for the ServerLabel node name policy without a node name label key", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", NodeNamePolicy: cmd.NodeNamePolicyServerLabel}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.Invalid(field.NewPath("spec.nodeNamePolicy"), cmd.NodeNamePolicyServerLabel, "node name policy requires a node name label key of the driver")))
+		Expect(validateMachineClassSpec(spec, field.NewPath("spec"), Options{NodeNameLabelKey: "asset-id"})).To(BeEmpty())
+	})
+
+	It("should return error for an unsupported hostname source", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", HostnameSources: []v1alpha1.HostnameSource{"foo"}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ContainElement(field.NotSupported(field.NewPath("spec.hostnameSources").Index(0), v1alpha1.HostnameSource("foo"), supportedHostnameSources)))
+	})
+
+	It("should return error for a duplicate hostname source", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", HostnameSources: []v1alpha1.HostnameSource{v1alpha1.HostnameSourceNodeName, v1alpha1.HostnameSourceNodeName}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ContainElement(field.Duplicate(field.NewPath("spec.hostnameSources").Index(1), v1alpha1.HostnameSourceNodeName)))
+	})
+
+	It("should return error if ProviderSpec is the only hostname source and hostname is empty", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", HostnameSources: []v1alpha1.HostnameSource{v1alpha1.HostnameSourceProviderSpec}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ContainElement(field.Required(field.NewPath("spec.hostname"), "hostname is required if ProviderSpec is the only hostname source")))
+	})
+
+	It("should return error for invalid drop-in names", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", CloudConfigInitDropins: []v1alpha1.SystemdDropin{
+			{Name: "", Contents: "[Unit]"},
+			{Name: "10-foo", Contents: "[Unit]"},
+			{Name: "../10-foo.conf", Contents: "[Unit]"},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Required(field.NewPath("spec.cloudConfigInitDropins").Index(0).Child("name"), "drop-in name is required"),
+			field.Invalid(field.NewPath("spec.cloudConfigInitDropins").Index(1).Child("name"), "10-foo", "drop-in name must be a file name ending with .conf"),
+			field.Invalid(field.NewPath("spec.cloudConfigInitDropins").Index(2).Child("name"), "../10-foo.conf", "drop-in name must be a file name ending with .conf"),
+		))
+	})
+
+	It("should return error for a duplicate drop-in name", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", CloudConfigInitDropins: []v1alpha1.SystemdDropin{
+			{Name: "10-foo.conf", Contents: "[Unit]"},
+			{Name: "10-foo.conf", Contents: "[Service]"},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.Duplicate(field.NewPath("spec.cloudConfigInitDropins").Index(1).Child("name"), "10-foo.conf")))
+	})
+
+	It("should not return error for valid LUKS devices", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", LUKS: []v1alpha1.LUKSDevice{
+			{Name: "root", Device: "/dev/disk/by-partlabel/root", Clevis: &v1alpha1.ClevisBinding{TPM2: true}},
+			{Name: "data", Device: "/dev/sdb", Clevis: &v1alpha1.ClevisBinding{
+				TPM2:      true,
+				Tang:      []v1alpha1.TangServer{{URL: "https://tang.example.com", Thumbprint: "abc"}},
+				Threshold: 2,
+			}},
+			{Name: "swap", Device: "/dev/sdc"},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for invalid LUKS devices", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", LUKS: []v1alpha1.LUKSDevice{
+			{Name: "root", Device: "disk/by-partlabel/root"},
+			{Name: "root", Device: "/dev/../etc/passwd"},
+			{Name: "", Device: ""},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.luks").Index(0).Child("device"), "disk/by-partlabel/root", "device must be a clean absolute path below /dev/"),
+			field.Duplicate(field.NewPath("spec.luks").Index(1).Child("name"), "root"),
+			field.Invalid(field.NewPath("spec.luks").Index(1).Child("device"), "/dev/../etc/passwd", "device must be a clean absolute path below /dev/"),
+			field.Required(field.NewPath("spec.luks").Index(2).Child("name"), "LUKS device name is required"),
+			field.Required(field.NewPath("spec.luks").Index(2).Child("device"), "device is required"),
+		))
+	})
+
+	It("should not return error for valid groups and users", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img",
+			Groups: []v1alpha1.IgnitionGroup{{Name: "metal-agents", System: true}},
+			Users: []v1alpha1.IgnitionUser{{
+				Name:         "metal-agent",
+				PrimaryGroup: "metal-agents",
+				Groups:       []string{"wheel"},
+				HomeDir:      "/var/lib/metal-agent",
+				Shell:        "/sbin/nologin",
+			}},
+		}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for invalid groups and users", func() {
+		gid := -1
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img",
+			Groups: []v1alpha1.IgnitionGroup{
+				{Name: "agents", GID: &gid},
+				{Name: "agents"},
+			},
+			Users: []v1alpha1.IgnitionUser{
+				{Name: "Agent", Groups: []string{"1wheel"}, Shell: "bash"},
+				{Name: "", HomeDir: "/home/../root"},
+			},
+		}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.groups").Index(0).Child("gid"), -1, "must not be negative"),
+			field.Duplicate(field.NewPath("spec.groups").Index(1).Child("name"), "agents"),
+			field.Invalid(field.NewPath("spec.users").Index(0).Child("name"), "Agent", `name must match the regex ^[a-z_][a-z0-9_-]*\$?$`),
+			field.Invalid(field.NewPath("spec.users").Index(0).Child("groups").Index(0), "1wheel", `name must match the regex ^[a-z_][a-z0-9_-]*\$?$`),
+			field.Invalid(field.NewPath("spec.users").Index(0).Child("shell"), "bash", "path must be a clean absolute path"),
+			field.Required(field.NewPath("spec.users").Index(1).Child("name"), "name is required"),
+			field.Invalid(field.NewPath("spec.users").Index(1).Child("homeDir"), "/home/../root", "path must be a clean absolute path"),
+		))
+	})
+
+	It("should return error for invalid clevis bindings", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", LUKS: []v1alpha1.LUKSDevice{
+			{Name: "root", Device: "/dev/sda", Clevis: &v1alpha1.ClevisBinding{}},
+			{Name: "data", Device: "/dev/sdb", Clevis: &v1alpha1.ClevisBinding{
+				TPM2:      true,
+				Tang:      []v1alpha1.TangServer{{URL: "tang.example.com"}},
+				Threshold: 3,
+			}},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Required(field.NewPath("spec.luks").Index(0).Child("clevis"), "clevis binding requires tpm2 or at least one tang server"),
+			field.Invalid(field.NewPath("spec.luks").Index(1).Child("clevis", "threshold"), 3, "threshold must be between 0 and the number of bindings (2)"),
+			field.Invalid(field.NewPath("spec.luks").Index(1).Child("clevis", "tang").Index(0).Child("url"), "tang.example.com", "tang URL must be an absolute http or https URL"),
+		))
+	})
+
+	It("should not return error for metadata keys if no list is configured", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{"foo": "bar", "token": "secret"}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should not return error for an allowed metadata key", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{"foo": "bar"}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{AllowedMetadataKeys: []string{"foo"}, DeniedMetadataKeys: []string{"token"}})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for a denied metadata key", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{"foo": "bar", "token": "secret"}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{DeniedMetadataKeys: []string{"token"}})
+		Expect(errs).To(ConsistOf(field.Forbidden(field.NewPath("spec.metadata").Key("token"), "metadata key is denied")))
+	})
+
+	It("should return error for a metadata key which is not allowed", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{"foo": "bar", "baz": "qux"}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{AllowedMetadataKeys: []string{"foo"}})
+		Expect(errs).To(ConsistOf(field.Forbidden(field.NewPath("spec.metadata").Key("baz"), "metadata key is not allowed, allowed keys are [foo]")))
+	})
+
+	It("should not return error for nested JSON metadata values", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{
+			"foo": map[string]any{
+				"bar":  []any{"baz", 1.5, true, nil},
+				"nums": map[string]any{"count": float64(3)},
+			},
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should return error for metadata values which can not be rendered as JSON", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", Metadata: map[string]any{
+			"foo": map[string]any{
+				"bar": []any{"baz", make(chan int)},
+			},
+			"ratio": math.NaN(),
+		}}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(
+			field.Invalid(field.NewPath("spec.metadata").Key("foo").Key("bar").Index(1), field.OmitValueType{}, "metadata value of type chan int can not be rendered as JSON"),
+			field.Invalid(field.NewPath("spec.metadata").Key("ratio"), field.OmitValueType{}, "metadata value must be a finite number"),
+		))
+	})
+
+	It("should return error for an unsupported metadata format", func() {
+		spec := &v1alpha1.ProviderSpec{MachineClassName: "foo", MachinePoolName: "foo", Image: "img", MetadataFormat: "toml"}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(ConsistOf(field.NotSupported(field.NewPath("spec.metadataFormat"), v1alpha1.MetadataFormat("toml"), []v1alpha1.MetadataFormat{v1alpha1.MetadataFormatJSON, v1alpha1.MetadataFormatYAML})))
+	})
+
+	It("should not return error for a valid hostname configuration", func() {
+		spec := &v1alpha1.ProviderSpec{
+			MachineClassName: "foo",
+			MachinePoolName:  "foo",
+			Image:            "img",
+			Hostname:         "node.example.com",
+			HostnameSources:  []v1alpha1.HostnameSource{v1alpha1.HostnameSourceServerName, v1alpha1.HostnameSourceProviderSpec, v1alpha1.HostnameSourceNodeName},
+		}
+		errs := validateMachineClassSpec(spec, field.NewPath("spec"), Options{})
+		Expect(errs).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ValidateProviderSpecFindings", func() {
+	It("should not return findings for a well configured provider spec", func() {
+		spec := &v1alpha1.ProviderSpec{
+			MachineClassName: "foo",
+			MachinePoolName:  "foo",
+			Image:            "img",
+			ServerLabels:     map[string]string{"instance-type": "bar"},
+			Labels:           map[string]string{"shoot-name": "my-shoot"},
+		}
+		Expect(ValidateProviderSpecFindings(spec, field.NewPath("spec"))).To(BeEmpty())
+	})
+
+	It("should return findings for suspicious settings", func() {
+		dnsServer := netip.MustParseAddr("1.1.1.1")
+		spec := &v1alpha1.ProviderSpec{
+			MachineClassName: "foo",
+			MachinePoolName:  "foo",
+			Image:            "img",
+			Labels: map[string]string{
+				"shoot-name":              "my-shoot",
+				"metal.ironcore.dev/rack": "r1",
+				LabelKeyManagedBy:         "someone",
+			},
+			DnsServers: []netip.Addr{dnsServer, dnsServer},
+		}
+		Expect(ValidateProviderSpecFindings(spec, field.NewPath("spec"))).To(ConsistOf(
+			field.Required(field.NewPath("spec.serverLabels"), "an empty server selector matches any free server"),
+			field.Invalid(field.NewPath("spec.labels").Key(LabelKeyManagedBy), "someone", "label key is reserved by the driver"),
+			field.Invalid(field.NewPath("spec.labels").Key("metal.ironcore.dev/rack"), "r1", "label key is reserved by the driver"),
+			field.Duplicate(field.NewPath("spec.dnsServers").Index(1), dnsServer),
+		))
+	})
 })
 
 var _ = Describe("ValidateIPAddressClaim", func() {
@@ -118,6 +672,7 @@ var _ = Describe("ValidateIPAddressClaim", func() {
 				AddressRef: corev1.LocalObjectReference{Name: "ipref"},
 			},
 			ObjectMeta: metav1.ObjectMeta{
+				Namespace: metalNamespace,
 				Labels: map[string]string{
 					LabelKeyServerClaimName:      machineName,
 					LabelKeyServerClaimNamespace: metalNamespace,
@@ -189,6 +744,21 @@ var _ = Describe("ValidateIPAddressClaim", func() {
 		Expect(errs).To(BeEmpty())
 	})
 
+	It("should not require ownerReferences for a claim in a separate namespace", func() {
+		ipClaim.Namespace = "ipam-ns"
+		ipClaim.OwnerReferences = nil
+		errs := ValidateIPAddressClaim(ipClaim, serverClaim, machineName, metalNamespace)
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should validate the labels of a claim in a separate namespace", func() {
+		ipClaim.Namespace = "ipam-ns"
+		ipClaim.OwnerReferences = nil
+		ipClaim.Labels[LabelKeyServerClaimName] = "other"
+		errs := ValidateIPAddressClaim(ipClaim, serverClaim, machineName, metalNamespace)
+		Expect(errs).To(ContainElement(HaveField("Field", "metadata.labels")))
+	})
+
 	It("should return error if ownerReferences are empty", func() {
 		ipClaim.OwnerReferences = nil
 		errs := ValidateIPAddressClaim(ipClaim, serverClaim, machineName, metalNamespace)
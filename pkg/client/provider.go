@@ -6,32 +6,79 @@ package client
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/scale/scheme"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-type syncClientFunc func(client client.Client) error
+type syncClientFunc = func(client client.Client) error
+
+// ClientProvider provides synchronized access to the metal client. The driver only depends on this interface, so that
+// a fake implementation can be injected in tests.
+type ClientProvider interface {
+	// SyncClient calls fn with the current metal client while holding the client lock
+	SyncClient(fn func(client client.Client) error) error
+	// GetClientScheme returns the scheme of the current metal client
+	GetClientScheme() *runtime.Scheme
+}
+
+var _ ClientProvider = &Provider{}
+
+// watcherRestartBackoff is the backoff between the restarts of a failed kubeconfig watcher
+var watcherRestartBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      time.Minute,
+}
+
+// newWatcher creates the file system watcher of the kubeconfig, it is replaced in tests to inject watcher errors
+var newWatcher = fsnotify.NewWatcher
+
+// retryBackoff is the backoff between the retries of transient metal API errors
+var retryBackoff = wait.Backoff{
+	Duration: 200 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
 
 type Provider struct {
 	client         client.Client
 	mu             sync.Mutex
 	s              *runtime.Scheme
 	kubeconfigPath string
+	// retries is the number of retries of idempotent operations failing with a transient metal API error
+	retries int
+	// lockTimeout is the time an operation waits for the client lock, a zero value waits without a timeout
+	lockTimeout time.Duration
+
+	// watcherMu guards the lifecycle of the kubeconfig watcher goroutine
+	watcherMu     sync.Mutex
+	watcherCancel context.CancelFunc
+	watcherDone   chan struct{}
 }
 
 func NewProviderAndNamespace(ctx context.Context, kubeconfigPath string) (*Provider, string, error) {
@@ -48,12 +95,15 @@ func NewProviderAndNamespace(ctx context.Context, kubeconfigPath string) (*Provi
 
 	clientConfig, err := cp.getClientConfig()
 	if err != nil {
+		cp.StopWatcher()
 		return nil, "", err
 	} else if err := cp.setMetalClient(clientConfig); err != nil {
+		cp.StopWatcher()
 		return nil, "", err
 	}
 	namespace, err := getNamespace(clientConfig)
 	if err != nil {
+		cp.StopWatcher()
 		return nil, "", err
 	}
 
@@ -61,13 +111,105 @@ func NewProviderAndNamespace(ctx context.Context, kubeconfigPath string) (*Provi
 	return cp, namespace, nil
 }
 
+// SyncClient calls fn with the current metal client. Reads and server-side apply patches failing with a transient
+// metal API error, like a server timeout or too many requests, are retried with backoff up to the configured number of
+// retries. Other writes are not idempotent and are never retried.
 func (p *Provider) SyncClient(fn syncClientFunc) error {
-	p.mu.Lock()
+	if err := p.lock(); err != nil {
+		return err
+	}
 	defer p.mu.Unlock()
 	if p.client == nil {
 		return fmt.Errorf("client is not initialized")
 	}
-	return fn(p.client)
+	if p.retries == 0 {
+		return fn(p.client)
+	}
+
+	backoff := retryBackoff
+	backoff.Steps = p.retries + 1
+	return fn(&retryingClient{Client: p.client, backoff: backoff})
+}
+
+// retryingClient retries the idempotent calls of the wrapped client failing with a transient metal API error
+type retryingClient struct {
+	client.Client
+	backoff wait.Backoff
+}
+
+func (c *retryingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return retry.OnError(c.backoff, isRetryable, func() error {
+		return c.Client.Get(ctx, key, obj, opts...)
+	})
+}
+
+func (c *retryingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return retry.OnError(c.backoff, isRetryable, func() error {
+		return c.Client.List(ctx, list, opts...)
+	})
+}
+
+// Patch only retries server-side apply patches, other patches may not be idempotent, e.g. JSON patches
+func (c *retryingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	return retry.OnError(c.backoff, isRetryable, func() error {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+// SetRetries sets the number of retries of idempotent operations failing with a transient metal API error
+func (p *Provider) SetRetries(retries int) {
+	p.retries = max(retries, 0)
+}
+
+// SetLockTimeout sets the time an operation waits for the client lock, a zero value waits without a timeout
+func (p *Provider) SetLockTimeout(timeout time.Duration) {
+	p.lockTimeout = max(timeout, 0)
+}
+
+// lock acquires the client lock within the lock timeout, so that an operation stuck while holding the lock does not
+// block all other operations. It fails with codes.ResourceExhausted if the lock can not be acquired in time.
+func (p *Provider) lock() error {
+	if p.lockTimeout == 0 {
+		p.mu.Lock()
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.lockTimeout)
+	defer cancel()
+	return p.lockContext(ctx)
+}
+
+// lockContext acquires the client lock unless the context is done first
+func (p *Provider) lockContext(ctx context.Context) error {
+	if p.mu.TryLock() {
+		return nil
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		p.mu.Lock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		// the lock is released as soon as the pending acquisition succeeds
+		go func() {
+			<-acquired
+			p.mu.Unlock()
+		}()
+		return status.Error(codes.ResourceExhausted, fmt.Sprintf("failed to acquire the metal client lock: %v", ctx.Err()))
+	}
+}
+
+// isRetryable checks if the error is a transient metal API error
+func isRetryable(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err)
 }
 
 func (p *Provider) GetClientScheme() *runtime.Scheme {
@@ -118,53 +260,138 @@ func (p *Provider) setMetalClient(clientConfig clientcmd.OverridingClientConfig)
 	return nil
 }
 
+// RestartWatcher stops the running kubeconfig watcher, if any, and starts a new one bound to the given context
+func (p *Provider) RestartWatcher(ctx context.Context) error {
+	p.StopWatcher()
+	return p.reloadMetalClientOnConfigChange(ctx)
+}
+
+// StopWatcher stops the kubeconfig watcher and waits until its goroutine has exited
+func (p *Provider) StopWatcher() {
+	p.watcherMu.Lock()
+	defer p.watcherMu.Unlock()
+	if p.watcherCancel == nil {
+		return
+	}
+	p.watcherCancel()
+	<-p.watcherDone
+	p.watcherCancel = nil
+	p.watcherDone = nil
+}
+
+// WatcherDone returns a channel which is closed once the kubeconfig watcher goroutine has exited
+func (p *Provider) WatcherDone() <-chan struct{} {
+	p.watcherMu.Lock()
+	defer p.watcherMu.Unlock()
+	return p.watcherDone
+}
+
 func (p *Provider) reloadMetalClientOnConfigChange(ctx context.Context) error {
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := p.newKubeconfigWatcher()
 	if err != nil {
-		return fmt.Errorf("unable to create kubeconfig watcher: %w", err)
+		return err
 	}
 
-	if err = watcher.Add(path.Dir(p.kubeconfigPath)); err != nil {
-		watcher.Close()
-		return fmt.Errorf("unable to add kubeconfig \"%s\" to watcher: %v", p.kubeconfigPath, err)
-	}
+	p.watcherMu.Lock()
+	defer p.watcherMu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	p.watcherCancel = cancel
+	p.watcherDone = done
 
 	// Because kubeconfig is mounted from a secret and updated by kubernetes it is a symbolic link and
 	// there will be no events with kubeconfig name. So we need to check if a target file has changed.
 	targetKubeconfigPath, _ := filepath.EvalSymlinks(p.kubeconfigPath)
 	go func() {
 		defer func() {
-			watcher.Close()
+			close(done)
 			klog.V(3).Infof("Watcher loop ended for %s", path.Dir(p.kubeconfigPath))
 		}()
 		klog.V(3).Infof("Watcher loop started for %s", path.Dir(p.kubeconfigPath))
 
+		backoff := watcherRestartBackoff
 		for {
-			select {
-			case err := <-watcher.Errors:
-				klog.Fatalf("Watcher returned an error: %v", err)
-			case event := <-watcher.Events:
-				klog.V(3).Infof("Event: %s", event.String())
-				newTargetKubeconfigPath, _ := filepath.EvalSymlinks(p.kubeconfigPath)
-				if newTargetKubeconfigPath == targetKubeconfigPath {
-					continue
-				}
-				targetKubeconfigPath = newTargetKubeconfigPath
+			err := p.watchKubeconfig(ctx, watcher, &targetKubeconfigPath)
+			watcher.Close()
+			if err == nil {
+				return
+			}
+			klog.Errorf("Watcher returned an error, restarting the watcher: %v", err)
 
-				clientConfig, err := p.getClientConfig()
-				if err != nil {
-					klog.Warningf("Couldn't get client config when config changed: %v", err)
-					continue
+			// a failed watcher is restarted with backoff, as the metal client would otherwise not be updated on
+			// kubeconfig rotations anymore
+			for {
+				select {
+				case <-time.After(backoff.Step()):
+				case <-ctx.Done():
+					return
 				}
-				if err := p.setMetalClient(clientConfig); err != nil {
-					klog.Warningf("Couldn't update metal client when config changed: %v", err)
-					continue
+				if watcher, err = p.newKubeconfigWatcher(); err == nil {
+					break
 				}
-				klog.V(3).Infof("Change of kubeconfig was handled successfully")
-			case <-ctx.Done():
-				return
+				klog.Errorf("Failed to restart the watcher: %v", err)
 			}
+			klog.V(3).Infof("Watcher restarted for %s", path.Dir(p.kubeconfigPath))
+
+			// the kubeconfig may have changed while no watcher was running
+			p.reloadMetalClientOnTargetChange(&targetKubeconfigPath)
 		}
 	}()
 	return nil
 }
+
+// newKubeconfigWatcher creates a watcher of the directory of the kubeconfig
+func (p *Provider) newKubeconfigWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := newWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubeconfig watcher: %w", err)
+	}
+
+	if err = watcher.Add(path.Dir(p.kubeconfigPath)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("unable to add kubeconfig \"%s\" to watcher: %v", p.kubeconfigPath, err)
+	}
+	return watcher, nil
+}
+
+// watchKubeconfig updates the metal client on changes of the kubeconfig target until the context is done. It returns
+// an error if the watcher fails, so that the watcher is restarted.
+func (p *Provider) watchKubeconfig(ctx context.Context, watcher *fsnotify.Watcher, targetKubeconfigPath *string) error {
+	for {
+		select {
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("watcher error channel closed")
+			}
+			return err
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("watcher event channel closed")
+			}
+			klog.V(3).Infof("Event: %s", event.String())
+			p.reloadMetalClientOnTargetChange(targetKubeconfigPath)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// reloadMetalClientOnTargetChange updates the metal client if the target of the kubeconfig has changed
+func (p *Provider) reloadMetalClientOnTargetChange(targetKubeconfigPath *string) {
+	newTargetKubeconfigPath, _ := filepath.EvalSymlinks(p.kubeconfigPath)
+	if newTargetKubeconfigPath == *targetKubeconfigPath {
+		return
+	}
+	*targetKubeconfigPath = newTargetKubeconfigPath
+
+	clientConfig, err := p.getClientConfig()
+	if err != nil {
+		klog.Warningf("Couldn't get client config when config changed: %v", err)
+		return
+	}
+	if err := p.setMetalClient(clientConfig); err != nil {
+		klog.Warningf("Couldn't update metal client when config changed: %v", err)
+		return
+	}
+	klog.V(3).Infof("Change of kubeconfig was handled successfully")
+}
@@ -5,14 +5,27 @@ package client
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gleak"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 const kubeconfigStr = `apiVersion: v1
@@ -99,6 +112,230 @@ var _ = Describe("Provider", func() {
 				}).Should(Succeed())
 			}))
 		})
+
+		When("the context is cancelled", func() {
+			It("stops the watcher goroutine", func() {
+				goods := Goroutines()
+				ctx, cancel := context.WithCancel(context.TODO())
+				dirName := GinkgoT().TempDir()
+				atomicWrite(dirName, "kubeconfig", []byte(kubeconfigStr))
+
+				cp, _, err := NewProviderAndNamespace(ctx, path.Join(dirName, "kubeconfig"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cp.WatcherDone()).NotTo(BeClosed())
+
+				cancel()
+				Eventually(cp.WatcherDone()).Should(BeClosed())
+				Eventually(Goroutines).ShouldNot(HaveLeaked(goods))
+			})
+		})
+
+		When("the watcher is restarted", func() {
+			It("stops the old watcher and updates the client with the new one", wrap(func(dirName string, ctx context.Context) {
+				atomicWrite(dirName, "kubeconfig", []byte(kubeconfigStr))
+
+				cp, _, err := NewProviderAndNamespace(ctx, path.Join(dirName, "kubeconfig"))
+				Expect(err).ShouldNot(HaveOccurred())
+				DeferCleanup(cp.StopWatcher)
+
+				oldDone := cp.WatcherDone()
+				Expect(cp.RestartWatcher(ctx)).To(Succeed())
+				Expect(oldDone).To(BeClosed())
+				Expect(cp.WatcherDone()).NotTo(BeClosed())
+
+				cp.mu.Lock()
+				oldClient := cp.client
+				cp.mu.Unlock()
+
+				newKubeconfigStr := strings.Replace(kubeconfigStr, "123", "321", 1)
+				atomicWrite(dirName, "kubeconfig", []byte(newKubeconfigStr))
+
+				Eventually(func(g Gomega) {
+					cp.mu.Lock()
+					newClient := cp.client
+					cp.mu.Unlock()
+					g.Expect(newClient).NotTo(Equal(oldClient))
+				}).Should(Succeed())
+			}))
+		})
+
+		When("the watcher returns an error", func() {
+			It("restarts the watcher and updates the client on a later change", wrap(func(dirName string, ctx context.Context) {
+				By("capturing the created watchers")
+				watchers := make(chan *fsnotify.Watcher, 10)
+				DeferCleanup(func(backoff wait.Backoff, create func() (*fsnotify.Watcher, error)) {
+					watcherRestartBackoff, newWatcher = backoff, create
+				}, watcherRestartBackoff, newWatcher)
+				watcherRestartBackoff = wait.Backoff{Duration: 10 * time.Millisecond}
+				newWatcher = func() (*fsnotify.Watcher, error) {
+					watcher, err := fsnotify.NewWatcher()
+					if err == nil {
+						watchers <- watcher
+					}
+					return watcher, err
+				}
+
+				atomicWrite(dirName, "kubeconfig", []byte(kubeconfigStr))
+				cp, _, err := NewProviderAndNamespace(ctx, path.Join(dirName, "kubeconfig"))
+				Expect(err).ShouldNot(HaveOccurred())
+				DeferCleanup(cp.StopWatcher)
+
+				By("injecting a watcher error")
+				var watcher *fsnotify.Watcher
+				Expect(watchers).To(Receive(&watcher))
+				watcher.Errors <- errors.New("injected watcher error")
+
+				By("ensuring that the watcher is restarted")
+				Eventually(watchers).Should(Receive())
+				Expect(cp.WatcherDone()).NotTo(BeClosed())
+
+				cp.mu.Lock()
+				oldClient := cp.client
+				cp.mu.Unlock()
+
+				By("changing the kubeconfig")
+				newKubeconfigStr := strings.Replace(kubeconfigStr, "123", "321", 1)
+				atomicWrite(dirName, "kubeconfig", []byte(newKubeconfigStr))
+
+				Eventually(func(g Gomega) {
+					cp.mu.Lock()
+					newClient := cp.client
+					cp.mu.Unlock()
+					g.Expect(newClient).NotTo(Equal(oldClient))
+				}).Should(Succeed())
+			}))
+		})
+	})
+})
+
+var _ = Describe("SyncClient", func() {
+	var cp *Provider
+	var calls int
+
+	// failOnce returns the error on the first intercepted call and succeeds on all further calls
+	failOnce := func(err error) error {
+		calls++
+		if calls == 1 {
+			return err
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		calls = 0
+		cp = &Provider{}
+		cp.SetClient(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return failOnce(apierrors.NewTooManyRequests("slow down", 1))
+			},
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				return failOnce(apierrors.NewServerTimeout(schema.GroupResource{Resource: "configmaps"}, "create", 1))
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				return failOnce(apierrors.NewServerTimeout(schema.GroupResource{Resource: "configmaps"}, "patch", 1))
+			},
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				return failOnce(apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, obj.GetName()))
+			},
+		}).Build())
+	})
+
+	configMap := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+	}
+
+	It("should succeed on the second attempt of a read after a too many requests error", func(ctx SpecContext) {
+		cp.SetRetries(1)
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "foo"}, configMap())
+		})).To(Succeed())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("should succeed on the second attempt of a server-side apply after a server timeout error", func(ctx SpecContext) {
+		cp.SetRetries(1)
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Patch(ctx, configMap(), client.Apply, client.FieldOwner("test"))
+		})).To(Succeed())
+		Expect(calls).To(Equal(2))
+	})
+
+	It("should not retry a create after a server timeout error", func(ctx SpecContext) {
+		cp.SetRetries(3)
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Create(ctx, configMap())
+		})).To(Satisfy(apierrors.IsServerTimeout))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should not retry a merge patch after a server timeout error", func(ctx SpecContext) {
+		cp.SetRetries(3)
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Patch(ctx, configMap(), client.MergeFrom(configMap()))
+		})).To(Satisfy(apierrors.IsServerTimeout))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should not retry if no retries are configured", func(ctx SpecContext) {
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "foo"}, configMap())
+		})).To(Satisfy(apierrors.IsTooManyRequests))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should not retry errors which are not transient", func(ctx SpecContext) {
+		cp.SetRetries(3)
+		Expect(cp.SyncClient(func(c client.Client) error {
+			return c.Delete(ctx, configMap())
+		})).To(Satisfy(apierrors.IsNotFound))
+		Expect(calls).To(Equal(1))
+	})
+})
+
+var _ = Describe("SyncClient with a lock timeout", func() {
+	var cp *Provider
+
+	BeforeEach(func() {
+		cp = &Provider{}
+		cp.SetClient(fake.NewClientBuilder().Build())
+		cp.SetLockTimeout(100 * time.Millisecond)
+	})
+
+	It("should fail with ResourceExhausted while another operation holds the lock", func() {
+		By("holding the lock with a long running operation")
+		locked := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- cp.SyncClient(func(client.Client) error {
+				close(locked)
+				<-release
+				return nil
+			})
+		}()
+		Eventually(locked).Should(BeClosed())
+
+		By("ensuring that a second operation times out")
+		calls := 0
+		err := cp.SyncClient(func(client.Client) error {
+			calls++
+			return nil
+		})
+		Expect(err).To(MatchError(status.Error(codes.ResourceExhausted, "failed to acquire the metal client lock: context deadline exceeded")))
+		Expect(calls).To(BeZero())
+
+		By("releasing the lock")
+		close(release)
+		Eventually(done).Should(Receive(BeNil()))
+
+		By("ensuring that the next operation acquires the lock")
+		Eventually(func() error {
+			return cp.SyncClient(func(client.Client) error {
+				calls++
+				return nil
+			})
+		}).Should(Succeed())
+		Expect(calls).To(Equal(1))
 	})
 })
 
@@ -11,6 +11,8 @@ const (
 	NodeNamePolicyBMCName         NodeNamePolicy = "BMCName"
 	NodeNamePolicyServerName      NodeNamePolicy = "ServerName"
 	NodeNamePolicyServerClaimName NodeNamePolicy = "ServerClaimName"
+	// NodeNamePolicyServerLabel uses the value of the configured label of the bound Server, e.g. an asset id
+	NodeNamePolicyServerLabel NodeNamePolicy = "ServerLabel"
 )
 
 // String returns the string representation of the NodeNamePolicy value
@@ -25,10 +27,103 @@ func (n *NodeNamePolicy) Type() string {
 // Set validates and sets the NodeNamePolicy value
 func (n *NodeNamePolicy) Set(value string) error {
 	switch NodeNamePolicy(value) {
-	case NodeNamePolicyBMCName, NodeNamePolicyServerName, NodeNamePolicyServerClaimName:
+	case NodeNamePolicyBMCName, NodeNamePolicyServerName, NodeNamePolicyServerClaimName, NodeNamePolicyServerLabel:
 		*n = NodeNamePolicy(value)
 		return nil
 	default:
-		return fmt.Errorf("invalid NodeNamePolicy value: %s (must be '%s', '%s' or '%s')", value, NodeNamePolicyBMCName, NodeNamePolicyServerName, NodeNamePolicyServerClaimName)
+		return fmt.Errorf("invalid NodeNamePolicy value: %s (must be '%s', '%s', '%s' or '%s')", value, NodeNamePolicyBMCName, NodeNamePolicyServerName, NodeNamePolicyServerClaimName, NodeNamePolicyServerLabel)
+	}
+}
+
+// ValidationMode controls whether non-critical findings of the provider spec validation are errors or warnings
+type ValidationMode string
+
+const (
+	// ValidationModeStrict fails the validation on non-critical findings
+	ValidationModeStrict ValidationMode = "strict"
+	// ValidationModeLenient logs non-critical findings as warnings
+	ValidationModeLenient ValidationMode = "lenient"
+)
+
+// String returns the string representation of the ValidationMode value
+func (v *ValidationMode) String() string {
+	return string(*v)
+}
+
+func (v *ValidationMode) Type() string {
+	return string(*v)
+}
+
+// Set validates and sets the ValidationMode value
+func (v *ValidationMode) Set(value string) error {
+	switch ValidationMode(value) {
+	case ValidationModeStrict, ValidationModeLenient:
+		*v = ValidationMode(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid ValidationMode value: %s (must be '%s' or '%s')", value, ValidationModeStrict, ValidationModeLenient)
+	}
+}
+
+// ImageUpdatePolicy controls how machines react to a changed image of their MachineClass
+type ImageUpdatePolicy string
+
+const (
+	// ImageUpdatePolicyIgnore keeps the image of existing machines
+	ImageUpdatePolicyIgnore ImageUpdatePolicy = "Ignore"
+	// ImageUpdatePolicyRecreate deletes the ServerClaim of machines whose ServerClaim image differs from the MachineClass
+	// image, so that it is created again with the image of the MachineClass
+	ImageUpdatePolicyRecreate ImageUpdatePolicy = "Recreate"
+)
+
+// String returns the string representation of the ImageUpdatePolicy value
+func (i *ImageUpdatePolicy) String() string {
+	return string(*i)
+}
+
+func (i *ImageUpdatePolicy) Type() string {
+	return string(*i)
+}
+
+// Set validates and sets the ImageUpdatePolicy value
+func (i *ImageUpdatePolicy) Set(value string) error {
+	switch ImageUpdatePolicy(value) {
+	case ImageUpdatePolicyIgnore, ImageUpdatePolicyRecreate:
+		*i = ImageUpdatePolicy(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid ImageUpdatePolicy value: %s (must be '%s' or '%s')", value, ImageUpdatePolicyIgnore, ImageUpdatePolicyRecreate)
+	}
+}
+
+// UserDataIgnitionPolicy controls how a userData which is a complete ignition or butane config is rendered
+type UserDataIgnitionPolicy string
+
+const (
+	// UserDataIgnitionPolicyScript renders the userData as init script regardless of its content
+	UserDataIgnitionPolicyScript UserDataIgnitionPolicy = "Script"
+	// UserDataIgnitionPolicyMerge appends a userData ignition to the ignition
+	UserDataIgnitionPolicyMerge UserDataIgnitionPolicy = "Merge"
+	// UserDataIgnitionPolicyOverride lets a userData ignition override colliding fields of the ignition
+	UserDataIgnitionPolicyOverride UserDataIgnitionPolicy = "Override"
+)
+
+// String returns the string representation of the UserDataIgnitionPolicy value
+func (u *UserDataIgnitionPolicy) String() string {
+	return string(*u)
+}
+
+func (u *UserDataIgnitionPolicy) Type() string {
+	return string(*u)
+}
+
+// Set validates and sets the UserDataIgnitionPolicy value
+func (u *UserDataIgnitionPolicy) Set(value string) error {
+	switch UserDataIgnitionPolicy(value) {
+	case UserDataIgnitionPolicyScript, UserDataIgnitionPolicyMerge, UserDataIgnitionPolicyOverride:
+		*u = UserDataIgnitionPolicy(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid UserDataIgnitionPolicy value: %s (must be '%s', '%s' or '%s')", value, UserDataIgnitionPolicyScript, UserDataIgnitionPolicyMerge, UserDataIgnitionPolicyOverride)
 	}
 }
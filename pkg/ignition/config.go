@@ -5,10 +5,16 @@ package ignition
 
 import (
 	"bytes"
+	"compress/gzip"
 	_ "embed"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/netip"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -16,6 +22,7 @@ import (
 	buconfig "github.com/coreos/butane/config"
 	"github.com/coreos/butane/config/common"
 	"github.com/imdario/mergo"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
 )
 
@@ -25,22 +32,142 @@ var (
 )
 
 const (
-	dnsConfFile    = "/etc/systemd/resolved.conf.d/dns.conf"
-	dnsEqualString = "DNS="
-	metaDataFile   = "/var/lib/metal-cloud-config/metadata"
-	fileMode       = 0644
+	dnsConfFile            = "/etc/systemd/resolved.conf.d/dns.conf"
+	dnsEqualString         = "DNS="
+	fallbackDnsEqualString = "FallbackDNS="
+	resolvConfFile         = "/etc/resolv.conf"
+	resolvedStubResolvConf = "../run/systemd/resolve/stub-resolv.conf"
+	metaDataFile           = "/var/lib/metal-cloud-config/metadata"
+	initScriptFile         = "/var/lib/metal-cloud-config/init.sh"
+	hostnameFile           = "/etc/hostname"
+	initDoneFile           = "init.done"
+	metaDataEnv            = "/etc/metal-metadata.env"
+	fileMode               = 0644
+	initService            = "cloud-config-init.service"
+	// noopInitScript replaces the init script if the userData is merged as ignition
+	noopInitScript = "#!/bin/sh\n"
 )
 
+// Dropin is a systemd drop-in of the cloud-config-init.service
+type Dropin struct {
+	Name     string
+	Contents string
+}
+
+// LUKSDevice is a LUKS device rendered into the storage.luks section
+type LUKSDevice struct {
+	Name       string   `json:"name"`
+	Device     string   `json:"device"`
+	Label      string   `json:"label,omitempty"`
+	WipeVolume bool     `json:"wipe_volume,omitempty"`
+	Options    []string `json:"options,omitempty"`
+	Clevis     *Clevis  `json:"clevis,omitempty"`
+}
+
+// Clevis is the clevis binding of a LUKS device
+type Clevis struct {
+	Tpm2      bool   `json:"tpm2,omitempty"`
+	Tang      []Tang `json:"tang,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+}
+
+// Tang is a Tang server of a clevis binding
+type Tang struct {
+	URL        string `json:"url"`
+	Thumbprint string `json:"thumbprint,omitempty"`
+}
+
+// Group is a group rendered into the passwd.groups section
+type Group struct {
+	Name   string `json:"name"`
+	Gid    *int   `json:"gid,omitempty"`
+	System bool   `json:"system,omitempty"`
+}
+
+// User is a user rendered into the passwd.users section
+type User struct {
+	Name              string   `json:"name"`
+	Uid               *int     `json:"uid,omitempty"`
+	PrimaryGroup      string   `json:"primary_group,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	HomeDir           string   `json:"home_dir,omitempty"`
+	NoCreateHome      bool     `json:"no_create_home,omitempty"`
+	Shell             string   `json:"shell,omitempty"`
+	System            bool     `json:"system,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys,omitempty"`
+}
+
 type Config struct {
 	Hostname         string
 	UserData         string
 	MetaData         map[string]any
 	Ignition         string
 	IgnitionOverride bool
-	DnsServers       []netip.Addr
+	// UserDataIgnition merges a userData which is a complete ignition or butane config into the ignition instead of
+	// rendering it as init script, the init script is rendered as no-op then. Any other userData is rendered as init script.
+	UserDataIgnition bool
+	// UserDataIgnitionOverride lets the merged userData override colliding fields instead of appending to them
+	UserDataIgnitionOverride bool
+	// AdditionalIgnitions are ignition fragments which are appended to the ignition after Ignition was merged, they are
+	// taken verbatim and not executed as template
+	AdditionalIgnitions []string
+	DnsServers          []netip.Addr
+	// FallbackDnsServers are rendered as FallbackDNS of systemd-resolved
+	FallbackDnsServers []netip.Addr
+	// ResolvConfSymlink links /etc/resolv.conf to the stub resolver of systemd-resolved instead of keeping the file
+	ResolvConfSymlink bool
+	// CompressionThreshold is the size in bytes above which inline file contents are gzip-compressed.
+	// A zero value disables the compression.
+	CompressionThreshold int
+	// InitServiceDropins are rendered as drop-ins of the cloud-config-init.service
+	InitServiceDropins []Dropin
+	// MetaDataEnvFile additionally renders the MetaData as KEY=value lines of an environment file, nested maps are flattened
+	MetaDataEnvFile bool
+	// LUKS are rendered into the storage.luks section
+	LUKS []LUKSDevice
+	// Groups are rendered into the passwd.groups section
+	Groups []Group
+	// Users are rendered into the passwd.users section, users of the same name in the ignition are merged with them
+	Users []User
+	// MetaDataYAML renders the metadata file as YAML instead of JSON, e.g. for images which only parse YAML
+	MetaDataYAML bool
+	// MetaDataPath is the path of the metadata file, which defaults to /var/lib/metal-cloud-config/metadata
+	MetaDataPath string
+	// InitScriptPath is the path of the init script, which defaults to /var/lib/metal-cloud-config/init.sh
+	InitScriptPath string
+	// HostnamePath is the path of the hostname file, which defaults to /etc/hostname
+	HostnamePath string
+	// InitDoneMarkerPath is the path of the marker file created once the init script succeeded, which defaults to
+	// init.done next to the init script
+	InitDoneMarkerPath string
+}
+
+// withDefaultPaths returns a copy of the config with the default paths set for all empty paths
+func (c Config) withDefaultPaths() *Config {
+	if c.MetaDataPath == "" {
+		c.MetaDataPath = metaDataFile
+	}
+	if c.InitScriptPath == "" {
+		c.InitScriptPath = initScriptFile
+	}
+	if c.HostnamePath == "" {
+		c.HostnamePath = hostnameFile
+	}
+	return &c
+}
+
+// InitDonePath returns the path of the marker file which is created once the init script succeeded, it is placed
+// next to the init script unless a marker path is configured
+func (c *Config) InitDonePath() string {
+	if c.InitDoneMarkerPath != "" {
+		return c.InitDoneMarkerPath
+	}
+	return path.Join(path.Dir(c.InitScriptPath), initDoneFile)
 }
 
 func Render(config *Config) (string, error) {
+	config = config.withDefaultPaths()
+
 	ignitionBase := &map[string]any{}
 	if err := yaml.Unmarshal([]byte(IgnitionTemplate), ignitionBase); err != nil {
 		return "", err
@@ -69,12 +196,108 @@ func Render(config *Config) (string, error) {
 		}
 	}
 
-	if len(config.DnsServers) > 0 {
+	// the userData is parsed before the template is executed as a merged userData replaces the init script
+	var userDataIgnition map[string]any
+	mergedUserData := false
+	if config.UserDataIgnition {
+		if parsed, ok := parseIgnition(config.UserData); ok {
+			userDataIgnition = parsed
+			config.UserData = noopInitScript
+			mergedUserData = true
+		}
+	}
+
+	// the template is executed before the userData, the additional ignitions and the generated content are merged,
+	// their content is taken verbatim and must not be interpreted as template
+	ignitionBase, err := executeTemplate(*ignitionBase, config)
+	if err != nil {
+		return "", err
+	}
+
+	if mergedUserData {
+		opt := mergo.WithAppendSlice
+		if config.UserDataIgnitionOverride {
+			opt = mergo.WithOverride
+		}
+		if err := mergo.Merge(ignitionBase, userDataIgnition, opt); err != nil {
+			return "", fmt.Errorf("failed to merge userData ignition: %w", err)
+		}
+	}
+
+	for i, fragment := range config.AdditionalIgnitions {
+		additional := map[string]any{}
+
+		if err := yaml.Unmarshal([]byte(fragment), &additional); err != nil {
+			return "", fmt.Errorf("failed to unmarshal additional ignition %d: %w", i, err)
+		}
+
+		if err := mergo.Merge(ignitionBase, additional, mergo.WithAppendSlice); err != nil {
+			return "", fmt.Errorf("failed to merge additional ignition %d: %w", i, err)
+		}
+	}
+
+	if len(config.Groups) > 0 || len(config.Users) > 0 {
+		passwd := map[string]any{}
+		if len(config.Groups) > 0 {
+			groups, err := toList(config.Groups)
+			if err != nil {
+				return "", fmt.Errorf("failed to convert groups: %w", err)
+			}
+			passwd["groups"] = groups
+		}
+		if len(config.Users) > 0 {
+			users, err := toList(config.Users)
+			if err != nil {
+				return "", fmt.Errorf("failed to convert users: %w", err)
+			}
+			passwd["users"] = users
+		}
+
+		// merge groups and users with ignition content
+		if err := mergo.Merge(ignitionBase, map[string]any{"passwd": passwd}, mergo.WithAppendSlice); err != nil {
+			return "", fmt.Errorf("failed to merge groups and users with ignition content: %w", err)
+		}
+	}
+
+	if config.Ignition != "" || mergedUserData || len(config.AdditionalIgnitions) > 0 || len(config.Users) > 0 {
+		// merge users with the same name instead of duplicating them
+		if err := mergePasswdUsers(*ignitionBase); err != nil {
+			return "", fmt.Errorf("failed to merge passwd users: %w", err)
+		}
+	}
+
+	if len(config.InitServiceDropins) > 0 {
+		addInitServiceDropins(*ignitionBase, config.InitServiceDropins)
+	}
+
+	if len(config.LUKS) > 0 {
+		luks, err := toList(config.LUKS)
+		if err != nil {
+			return "", fmt.Errorf("failed to convert LUKS devices: %w", err)
+		}
+
+		// merge LUKS devices with ignition content
+		if err := mergo.Merge(ignitionBase, map[string]any{
+			"storage": map[string]any{"luks": luks},
+		}, mergo.WithAppendSlice); err != nil {
+			return "", fmt.Errorf("failed to merge LUKS devices with ignition content: %w", err)
+		}
+	}
+
+	if len(config.DnsServers) > 0 || len(config.FallbackDnsServers) > 0 {
+		// IPv4 and IPv6 addresses are written verbatim, resolved.conf expects IPv6 addresses without brackets
 		dnsServers := []string{"[Resolve]"}
 		for _, v := range config.DnsServers {
 			dnsEntry := fmt.Sprintf("%s%s", dnsEqualString, v.String())
 			dnsServers = append(dnsServers, dnsEntry)
 		}
+		if len(config.FallbackDnsServers) > 0 {
+			fallbackServers := make([]string, 0, len(config.FallbackDnsServers))
+			for _, v := range config.FallbackDnsServers {
+				fallbackServers = append(fallbackServers, v.String())
+			}
+			dnsServers = append(dnsServers, fallbackDnsEqualString+strings.Join(fallbackServers, " "))
+		}
 
 		dnsConf := map[string]any{
 			"storage": map[string]any{
@@ -94,19 +317,36 @@ func Render(config *Config) (string, error) {
 		}
 	}
 
+	if config.ResolvConfSymlink {
+		resolvConfLink := map[string]any{
+			"storage": map[string]any{
+				"links": []any{map[string]any{
+					"path":      resolvConfFile,
+					"target":    resolvedStubResolvConf,
+					"overwrite": true,
+				}},
+			},
+		}
+
+		// merge resolv.conf symlink with ignition content
+		if err := mergo.Merge(ignitionBase, resolvConfLink, mergo.WithAppendSlice); err != nil {
+			return "", fmt.Errorf("failed to merge resolv.conf symlink with ignition content: %w", err)
+		}
+	}
+
 	if len(config.MetaData) > 0 {
-		metaDataJSON, err := json.Marshal(config.MetaData)
+		metaData, err := marshalMetaData(config)
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal MetaData to JSON: %w", err)
+			return "", err
 		}
 
 		metaDataConf := map[string]any{
 			"storage": map[string]any{
 				"files": []any{map[string]any{
-					"path": metaDataFile,
+					"path": config.MetaDataPath,
 					"mode": fileMode,
 					"contents": map[string]any{
-						"inline": string(metaDataJSON),
+						"inline": string(metaData),
 					},
 				}},
 			},
@@ -116,6 +356,25 @@ func Render(config *Config) (string, error) {
 		if err := mergo.Merge(ignitionBase, metaDataConf, mergo.WithAppendSlice); err != nil {
 			return "", fmt.Errorf("failed to merge metaData configuration with ignition content: %w", err)
 		}
+
+		if config.MetaDataEnvFile {
+			metaDataEnvConf := map[string]any{
+				"storage": map[string]any{
+					"files": []any{map[string]any{
+						"path": metaDataEnv,
+						"mode": fileMode,
+						"contents": map[string]any{
+							"inline": renderEnvFile(config.MetaData),
+						},
+					}},
+				},
+			}
+
+			// merge metaData environment file with ignition content
+			if err := mergo.Merge(ignitionBase, metaDataEnvConf, mergo.WithAppendSlice); err != nil {
+				return "", fmt.Errorf("failed to merge metaData environment file with ignition content: %w", err)
+			}
+		}
 	}
 
 	mergedIgnition, err := yaml.Marshal(ignitionBase)
@@ -123,23 +382,248 @@ func Render(config *Config) (string, error) {
 		return "", err
 	}
 
-	tmpl, err := template.New("ignition").Funcs(sprig.HermeticTxtFuncMap()).Parse(string(mergedIgnition))
+	butane, err := compressFiles(mergedIgnition, config.CompressionThreshold)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress ignition files: %w", err)
+	}
+
+	ignition, err := renderButane(butane)
+	if err != nil {
+		return "", err
+	}
+
+	return ignition, nil
+}
+
+// executeTemplate executes the ignition content as template with the config and returns the resulting ignition content
+func executeTemplate(ignition map[string]any, config *Config) (*map[string]any, error) {
+	content, err := yaml.Marshal(ignition)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("ignition").Funcs(sprig.HermeticTxtFuncMap()).Parse(string(content))
 	if err != nil {
-		return "", fmt.Errorf("failed creating ignition file: %w", err)
+		return nil, fmt.Errorf("failed creating ignition file: %w", err)
 	}
 
 	buf := bytes.NewBufferString("")
-	err = tmpl.Execute(buf, config)
+	if err := tmpl.Execute(buf, config); err != nil {
+		return nil, fmt.Errorf("failed creating ignition file while executing template: %w", err)
+	}
+
+	executed := &map[string]any{}
+	if err := yaml.Unmarshal(buf.Bytes(), executed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the executed ignition template: %w", err)
+	}
+	return executed, nil
+}
+
+// marshalMetaData serializes the metadata as JSON or, if configured, as YAML
+func marshalMetaData(config *Config) ([]byte, error) {
+	if config.MetaDataYAML {
+		data, err := yaml.Marshal(config.MetaData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal MetaData to YAML: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := json.Marshal(config.MetaData)
 	if err != nil {
-		return "", fmt.Errorf("failed creating ignition file while executing template: %w", err)
+		return nil, fmt.Errorf("failed to marshal MetaData to JSON: %w", err)
+	}
+	return data, nil
+}
+
+// Validate checks that the ignition content merged into the ignition template translates to a valid ignition for the
+// configured butane version
+func Validate(content string, override bool) error {
+	_, err := Render(&Config{Ignition: content, IgnitionOverride: override})
+	return err
+}
+
+// ValidateAdditional checks that the ignition fragment merged verbatim into the rendered ignition translates to a valid
+// ignition for the configured butane version
+func ValidateAdditional(content string) error {
+	_, err := Render(&Config{AdditionalIgnitions: []string{content}})
+	return err
+}
+
+// parseIgnition returns the content as ignition fragment if it is a complete ignition or butane config, i.e. it
+// declares an ignition version or a butane variant and version. The version fields are removed as the fragment is
+// merged into the butane config of the template.
+func parseIgnition(content string) (map[string]any, bool) {
+	parsed := map[string]any{}
+	if err := yaml.Unmarshal([]byte(content), &parsed); err != nil {
+		return nil, false
 	}
 
-	ignition, err := renderButane(buf.Bytes())
+	if ign, ok := parsed["ignition"].(map[string]any); ok {
+		if _, ok := ign["version"].(string); ok {
+			delete(ign, "version")
+			if len(ign) == 0 {
+				delete(parsed, "ignition")
+			}
+			return parsed, true
+		}
+	}
+
+	_, hasVariant := parsed["variant"].(string)
+	_, hasVersion := parsed["version"].(string)
+	if hasVariant && hasVersion {
+		delete(parsed, "variant")
+		delete(parsed, "version")
+		return parsed, true
+	}
+
+	return nil, false
+}
+
+// toList converts the items to a generic list which can be merged with the ignition content
+func toList[T any](items []T) ([]any, error) {
+	data, err := json.Marshal(items)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	var list []any
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
 	}
+	return list, nil
+}
 
-	return ignition, nil
+// addInitServiceDropins adds the drop-ins to the cloud-config-init.service unit, the unit is added if it was overridden
+func addInitServiceDropins(ignition map[string]any, dropins []Dropin) {
+	systemd, ok := ignition["systemd"].(map[string]any)
+	if !ok {
+		systemd = map[string]any{}
+		ignition["systemd"] = systemd
+	}
+	units, _ := systemd["units"].([]any)
+
+	var unit map[string]any
+	for _, u := range units {
+		if candidate, ok := u.(map[string]any); ok && candidate["name"] == initService {
+			unit = candidate
+			break
+		}
+	}
+	if unit == nil {
+		unit = map[string]any{"name": initService}
+		units = append(units, unit)
+		systemd["units"] = units
+	}
+
+	unitDropins, _ := unit["dropins"].([]any)
+	for _, dropin := range dropins {
+		unitDropins = append(unitDropins, map[string]any{
+			"name":     dropin.Name,
+			"contents": dropin.Contents,
+		})
+	}
+	unit["dropins"] = unitDropins
+}
+
+// mergePasswdUsers merges all passwd.users entries with the same name into the first entry of that name.
+// Scalar fields of later entries take precedence, lists like ssh_authorized_keys and groups are appended.
+func mergePasswdUsers(ignition map[string]any) error {
+	passwd, _ := ignition["passwd"].(map[string]any)
+	users, _ := passwd["users"].([]any)
+	if len(users) == 0 {
+		return nil
+	}
+
+	merged := make([]any, 0, len(users))
+	byName := map[string]map[string]any{}
+	for _, u := range users {
+		user, ok := u.(map[string]any)
+		name, _ := user["name"].(string)
+		if !ok || name == "" {
+			merged = append(merged, u)
+			continue
+		}
+
+		existing, ok := byName[name]
+		if !ok {
+			byName[name] = user
+			merged = append(merged, user)
+			continue
+		}
+
+		if err := mergo.Merge(&existing, user, mergo.WithOverride, mergo.WithAppendSlice); err != nil {
+			return err
+		}
+		for key, value := range existing {
+			if list, ok := value.([]any); ok {
+				existing[key] = uniqueValues(list)
+			}
+		}
+	}
+
+	passwd["users"] = merged
+	return nil
+}
+
+// uniqueValues removes duplicate values from the list while keeping the order
+func uniqueValues(list []any) []any {
+	unique := make([]any, 0, len(list))
+	for _, value := range list {
+		if !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+var (
+	envNameRegex  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envValueRegex = regexp.MustCompile(`^[A-Za-z0-9_./:,@%+=-]*$`)
+)
+
+// renderEnvFile renders the metadata as sorted KEY=value lines. Keys of nested maps are joined with an underscore,
+// entries which can not be represented in an environment file are skipped with a warning.
+func renderEnvFile(metaData map[string]any) string {
+	env := map[string]string{}
+	flattenEnv(env, "", metaData)
+
+	var lines []string
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, env[key]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// flattenEnv adds the values of the map to the environment, prefixing the keys of nested maps
+func flattenEnv(env map[string]string, prefix string, values map[string]any) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if !envNameRegex.MatchString(key) {
+			klog.Warningf("Skipping metadata key %q in the environment file, it is no valid variable name", key)
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			flattenEnv(env, key, v)
+		case []any:
+			klog.Warningf("Skipping metadata key %q in the environment file, lists are not supported", key)
+		case nil:
+			env[key] = ""
+		default:
+			str := fmt.Sprint(v)
+			switch {
+			case envValueRegex.MatchString(str):
+				env[key] = str
+			case !strings.ContainsAny(str, "'\n"):
+				env[key] = "'" + str + "'"
+			default:
+				klog.Warningf("Skipping metadata key %q in the environment file, its value contains a quote or newline", key)
+			}
+		}
+	}
 }
 
 func renderButane(dataIn []byte) (string, error) {
@@ -155,3 +639,46 @@ func renderButane(dataIn []byte) (string, error) {
 	}
 	return string(dataOut), nil
 }
+
+// compressFiles gzip-compresses the inline contents of all files exceeding the threshold
+func compressFiles(dataIn []byte, threshold int) ([]byte, error) {
+	if threshold <= 0 {
+		return dataIn, nil
+	}
+
+	butane := map[string]any{}
+	if err := yaml.Unmarshal(dataIn, &butane); err != nil {
+		return nil, err
+	}
+
+	storage, _ := butane["storage"].(map[string]any)
+	files, _ := storage["files"].([]any)
+	compressed := false
+	for _, f := range files {
+		file, _ := f.(map[string]any)
+		contents, _ := file["contents"].(map[string]any)
+		inline, ok := contents["inline"].(string)
+		if !ok || len(inline) <= threshold {
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write([]byte(inline)); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		delete(contents, "inline")
+		contents["source"] = "data:;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		contents["compression"] = "gzip"
+		compressed = true
+	}
+
+	if !compressed {
+		return dataIn, nil
+	}
+	return yaml.Marshal(butane)
+}
@@ -0,0 +1,579 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ignition
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// renderedFile is the subset of an ignition file which is relevant for the tests
+type renderedFile struct {
+	Path     string `json:"path"`
+	Contents struct {
+		Compression string `json:"compression"`
+		Source      string `json:"source"`
+	} `json:"contents"`
+}
+
+// renderFiles renders the config and returns the contained files by path
+func renderFiles(config *Config) map[string]renderedFile {
+	out, err := Render(config)
+	Expect(err).NotTo(HaveOccurred())
+
+	rendered := struct {
+		Storage struct {
+			Files []renderedFile `json:"files"`
+		} `json:"storage"`
+	}{}
+	Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+
+	files := map[string]renderedFile{}
+	for _, file := range rendered.Storage.Files {
+		files[file.Path] = file
+	}
+	return files
+}
+
+// decodeContents returns the decoded inline contents of the rendered file
+func decodeContents(file renderedFile) string {
+	if encoded, ok := strings.CutPrefix(file.Contents.Source, "data:;base64,"); ok {
+		content, err := base64.StdEncoding.DecodeString(encoded)
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+	content, err := url.PathUnescape(strings.TrimPrefix(file.Contents.Source, "data:,"))
+	Expect(err).NotTo(HaveOccurred())
+	return content
+}
+
+// renderedLink is an ignition link
+type renderedLink struct {
+	Path      string `json:"path"`
+	Target    string `json:"target"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// renderLinks renders the config and returns the contained links
+func renderLinks(config *Config) []renderedLink {
+	out, err := Render(config)
+	Expect(err).NotTo(HaveOccurred())
+
+	rendered := struct {
+		Storage struct {
+			Links []renderedLink `json:"links"`
+		} `json:"storage"`
+	}{}
+	Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+	return rendered.Storage.Links
+}
+
+var _ = Describe("Render", func() {
+	newConfig := func(threshold int) *Config {
+		return &Config{
+			Hostname:             "my-host",
+			UserData:             "#!/bin/bash\n" + strings.Repeat("echo hello world\n", 100),
+			CompressionThreshold: threshold,
+		}
+	}
+
+	It("should not compress any file if the compression threshold is disabled", func() {
+		files := renderFiles(newConfig(0))
+		Expect(files).To(HaveKey("/etc/hostname"))
+		Expect(files).To(HaveKey("/var/lib/metal-cloud-config/init.sh"))
+		for _, file := range files {
+			Expect(file.Contents.Compression).To(BeEmpty())
+		}
+	})
+
+	It("should only compress files exceeding the compression threshold", func() {
+		files := renderFiles(newConfig(100))
+		Expect(files["/etc/hostname"].Contents.Compression).To(BeEmpty())
+		Expect(files["/etc/hostname"].Contents.Source).To(Equal("data:,my-host%0A"))
+		Expect(files["/var/lib/metal-cloud-config/init.sh"].Contents.Compression).To(Equal("gzip"))
+		Expect(files["/var/lib/metal-cloud-config/init.sh"].Contents.Source).To(HavePrefix("data:;base64,"))
+	})
+
+	It("should compress all files exceeding a low compression threshold", func() {
+		files := renderFiles(newConfig(1))
+		Expect(files["/etc/hostname"].Contents.Compression).To(Equal("gzip"))
+		Expect(files["/var/lib/metal-cloud-config/init.sh"].Contents.Compression).To(Equal("gzip"))
+	})
+})
+
+// renderedUser is the subset of an ignition user which is relevant for the tests
+type renderedUser struct {
+	Name              string   `json:"name"`
+	PasswordHash      string   `json:"passwordHash"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys"`
+	Groups            []string `json:"groups"`
+}
+
+// renderUsers renders the config and returns the contained users
+func renderUsers(config *Config) []renderedUser {
+	out, err := Render(config)
+	Expect(err).NotTo(HaveOccurred())
+
+	rendered := struct {
+		Passwd struct {
+			Users []renderedUser `json:"users"`
+		} `json:"passwd"`
+	}{}
+	Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+	return rendered.Passwd.Users
+}
+
+var _ = Describe("Render passwd users", func() {
+	It("should merge users with the same name", func() {
+		users := renderUsers(&Config{
+			Hostname: "my-host",
+			Ignition: `passwd:
+  users:
+    - name: core
+      password_hash: foo
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA1
+      groups:
+        - wheel
+    - name: core
+      password_hash: bar
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA1
+        - ssh-ed25519 AAAA2
+      groups:
+        - docker
+`,
+		})
+		Expect(users).To(ConsistOf(renderedUser{
+			Name:              "core",
+			PasswordHash:      "bar",
+			SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA1", "ssh-ed25519 AAAA2"},
+			Groups:            []string{"wheel", "docker"},
+		}))
+	})
+
+	It("should keep users with different names", func() {
+		users := renderUsers(&Config{
+			Hostname: "my-host",
+			Ignition: `passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA1
+    - name: admin
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA2
+`,
+		})
+		Expect(users).To(Equal([]renderedUser{
+			{Name: "core", SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA1"}},
+			{Name: "admin", SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA2"}},
+		}))
+	})
+
+	It("should merge users with the same name which are not adjacent", func() {
+		ignitionBase := map[string]any{
+			"passwd": map[string]any{
+				"users": []any{
+					map[string]any{"name": "core", "groups": []any{"wheel"}},
+					map[string]any{"name": "admin"},
+					map[string]any{"name": "core", "groups": []any{"wheel", "docker"}, "password_hash": "foo"},
+				},
+			},
+		}
+		Expect(mergePasswdUsers(ignitionBase)).To(Succeed())
+		Expect(ignitionBase["passwd"]).To(HaveKeyWithValue("users", []any{
+			map[string]any{"name": "core", "groups": []any{"wheel", "docker"}, "password_hash": "foo"},
+			map[string]any{"name": "admin"},
+		}))
+	})
+})
+
+// renderedUnit is the subset of an ignition systemd unit which is relevant for the tests
+type renderedUnit struct {
+	Name     string `json:"name"`
+	Contents string `json:"contents"`
+	Dropins  []struct {
+		Name     string `json:"name"`
+		Contents string `json:"contents"`
+	} `json:"dropins"`
+}
+
+// renderUnits renders the config and returns the contained systemd units by name
+func renderUnits(config *Config) map[string]renderedUnit {
+	out, err := Render(config)
+	Expect(err).NotTo(HaveOccurred())
+
+	rendered := struct {
+		Systemd struct {
+			Units []renderedUnit `json:"units"`
+		} `json:"systemd"`
+	}{}
+	Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+
+	units := map[string]renderedUnit{}
+	for _, unit := range rendered.Systemd.Units {
+		units[unit.Name] = unit
+	}
+	return units
+}
+
+var _ = Describe("Render cloud-config-init drop-ins", func() {
+	It("should render the drop-ins alongside the base unit", func() {
+		units := renderUnits(&Config{
+			Hostname: "my-host",
+			InitServiceDropins: []Dropin{
+				{Name: "10-network.conf", Contents: "[Unit]\nAfter=network-online.target\n"},
+				{Name: "20-env.conf", Contents: "[Service]\nEnvironment=FOO=bar\n"},
+			},
+		})
+		Expect(units).To(HaveKey(initService))
+		unit := units[initService]
+		Expect(unit.Contents).To(ContainSubstring("ExecStart="))
+		Expect(unit.Dropins).To(HaveLen(2))
+		Expect(unit.Dropins[0].Name).To(Equal("10-network.conf"))
+		Expect(unit.Dropins[0].Contents).To(Equal("[Unit]\nAfter=network-online.target\n"))
+		Expect(unit.Dropins[1].Name).To(Equal("20-env.conf"))
+	})
+
+	It("should not render drop-ins if none are configured", func() {
+		units := renderUnits(&Config{Hostname: "my-host"})
+		Expect(units).To(HaveKey(initService))
+		Expect(units[initService].Dropins).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Render ignition paths", func() {
+	It("should render the files at the default paths", func() {
+		config := &Config{Hostname: "my-host", MetaData: map[string]any{"foo": "bar"}}
+		Expect(renderFiles(config)).To(SatisfyAll(
+			HaveKey("/etc/hostname"),
+			HaveKey("/var/lib/metal-cloud-config/init.sh"),
+			HaveKey("/var/lib/metal-cloud-config/metadata"),
+		))
+		Expect(renderUnits(config)[initService].Contents).To(SatisfyAll(
+			ContainSubstring("ConditionPathExists=!/var/lib/metal-cloud-config/init.done\n"),
+			ContainSubstring("ExecStart=/var/lib/metal-cloud-config/init.sh\n"),
+			ContainSubstring("ExecStopPost=touch /var/lib/metal-cloud-config/init.done\n"),
+		))
+	})
+
+	It("should render the files and the init service with the overridden paths", func() {
+		config := &Config{
+			Hostname:       "my-host",
+			MetaData:       map[string]any{"foo": "bar"},
+			MetaDataPath:   "/opt/cloud-config/metadata.json",
+			InitScriptPath: "/opt/cloud-config/bin/init.sh",
+			HostnamePath:   "/etc/conf.d/hostname",
+		}
+		files := renderFiles(config)
+		Expect(files).To(SatisfyAll(
+			HaveKey("/etc/conf.d/hostname"),
+			HaveKey("/opt/cloud-config/bin/init.sh"),
+			HaveKey("/opt/cloud-config/metadata.json"),
+			Not(HaveKey("/etc/hostname")),
+			Not(HaveKey("/var/lib/metal-cloud-config/init.sh")),
+			Not(HaveKey("/var/lib/metal-cloud-config/metadata")),
+		))
+		Expect(files["/etc/conf.d/hostname"].Contents.Source).To(Equal("data:,my-host%0A"))
+		Expect(renderUnits(config)[initService].Contents).To(SatisfyAll(
+			ContainSubstring("ConditionPathExists=!/opt/cloud-config/bin/init.done\n"),
+			ContainSubstring("ExecStart=/opt/cloud-config/bin/init.sh\n"),
+			ContainSubstring("ExecStopPost=touch /opt/cloud-config/bin/init.done\n"),
+		))
+	})
+
+	It("should render the init service with a custom marker path", func() {
+		config := &Config{
+			Hostname:           "my-host",
+			InitScriptPath:     "/opt/cloud-config/bin/init.sh",
+			InitDoneMarkerPath: "/run/cloud-config/init.done",
+		}
+		Expect(renderUnits(config)[initService].Contents).To(SatisfyAll(
+			ContainSubstring("ConditionPathExists=!/run/cloud-config/init.done\n"),
+			ContainSubstring("ExecStart=/opt/cloud-config/bin/init.sh\n"),
+			ContainSubstring("ExecStopPost=touch /run/cloud-config/init.done\n"),
+			Not(ContainSubstring("/opt/cloud-config/bin/init.done")),
+		))
+	})
+})
+
+var _ = Describe("Render metadata format", func() {
+	metaData := map[string]any{
+		"zone":     "a",
+		"loopback": map[string]any{"ip": "10.0.0.1"},
+	}
+
+	renderMetaData := func(config *Config) string {
+		files := renderFiles(config)
+		Expect(files).To(HaveKey("/var/lib/metal-cloud-config/metadata"))
+		source := files["/var/lib/metal-cloud-config/metadata"].Contents.Source
+		Expect(source).To(HavePrefix("data:;base64,"))
+		contents, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(source, "data:;base64,"))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	It("should render the metadata as JSON by default", func() {
+		Expect(renderMetaData(&Config{Hostname: "my-host", MetaData: metaData})).To(Equal(`{"loopback":{"ip":"10.0.0.1"},"zone":"a"}`))
+	})
+
+	It("should render the metadata as YAML if configured", func() {
+		Expect(renderMetaData(&Config{Hostname: "my-host", MetaData: metaData, MetaDataYAML: true})).To(Equal("loopback:\n  ip: 10.0.0.1\nzone: a\n"))
+	})
+})
+
+var _ = Describe("Render metadata environment file", func() {
+	It("should render the flat metadata as KEY=value lines", func() {
+		files := renderFiles(&Config{
+			Hostname: "my-host",
+			MetaData: map[string]any{
+				"REGION":  "eu-de-1",
+				"zone":    "a",
+				"enabled": true,
+				"SIZE":    3,
+			},
+			MetaDataEnvFile: true,
+		})
+		Expect(files).To(HaveKey("/var/lib/metal-cloud-config/metadata"))
+		Expect(files).To(HaveKey("/etc/metal-metadata.env"))
+		contents, err := url.PathUnescape(strings.TrimPrefix(files["/etc/metal-metadata.env"].Contents.Source, "data:,"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(Equal("REGION=eu-de-1\nSIZE=3\nenabled=true\nzone=a\n"))
+	})
+
+	It("should not render the environment file if disabled", func() {
+		files := renderFiles(&Config{
+			Hostname: "my-host",
+			MetaData: map[string]any{"zone": "a"},
+		})
+		Expect(files).NotTo(HaveKey("/etc/metal-metadata.env"))
+	})
+
+	It("should flatten nested maps and skip entries which can not be represented", func() {
+		Expect(renderEnvFile(map[string]any{
+			"loopback": map[string]any{
+				"ip":     "10.0.0.1",
+				"prefix": 32,
+			},
+			"description": "my server",
+			"quoted":      "it's",
+			"invalid-key": "foo",
+			"list":        []any{"a", "b"},
+		})).To(Equal("description='my server'\nloopback_ip=10.0.0.1\nloopback_prefix=32\n"))
+	})
+})
+
+var _ = Describe("Render LUKS devices", func() {
+	It("should render a TPM bound LUKS device into the storage section", func() {
+		out, err := Render(&Config{
+			Hostname: "my-host",
+			LUKS: []LUKSDevice{{
+				Name:       "data",
+				Device:     "/dev/disk/by-partlabel/data",
+				Label:      "luks-data",
+				WipeVolume: true,
+				Options:    []string{"--cipher", "aes-xts-plain64"},
+				Clevis:     &Clevis{Tpm2: true},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		rendered := struct {
+			Storage struct {
+				Luks []map[string]any `json:"luks"`
+			} `json:"storage"`
+		}{}
+		Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+		Expect(rendered.Storage.Luks).To(ConsistOf(map[string]any{
+			"name":       "data",
+			"device":     "/dev/disk/by-partlabel/data",
+			"label":      "luks-data",
+			"wipeVolume": true,
+			"options":    []any{"--cipher", "aes-xts-plain64"},
+			"clevis":     map[string]any{"tpm2": true},
+		}))
+	})
+})
+
+var _ = Describe("Render groups and users", func() {
+	It("should render a group and a user referencing it into the passwd section", func() {
+		gid := 1500
+		out, err := Render(&Config{
+			Hostname: "my-host",
+			Groups:   []Group{{Name: "metal-agents", Gid: &gid}},
+			Users: []User{{
+				Name:              "metal-agent",
+				PrimaryGroup:      "metal-agents",
+				Groups:            []string{"wheel"},
+				HomeDir:           "/var/lib/metal-agent",
+				Shell:             "/sbin/nologin",
+				System:            true,
+				SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA"},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		rendered := struct {
+			Passwd struct {
+				Groups []map[string]any `json:"groups"`
+				Users  []map[string]any `json:"users"`
+			} `json:"passwd"`
+		}{}
+		Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+		Expect(rendered.Passwd.Groups).To(ConsistOf(map[string]any{
+			"name": "metal-agents",
+			"gid":  float64(1500),
+		}))
+		Expect(rendered.Passwd.Users).To(ConsistOf(map[string]any{
+			"name":              "metal-agent",
+			"primaryGroup":      "metal-agents",
+			"groups":            []any{"wheel"},
+			"homeDir":           "/var/lib/metal-agent",
+			"shell":             "/sbin/nologin",
+			"system":            true,
+			"sshAuthorizedKeys": []any{"ssh-ed25519 AAAA"},
+		}))
+	})
+
+	It("should merge a user with the user of the same name in the ignition", func() {
+		out, err := Render(&Config{
+			Hostname: "my-host",
+			Ignition: "passwd:\n  users:\n    - name: core\n      ssh_authorized_keys:\n        - ssh-ed25519 BBBB\n",
+			Users:    []User{{Name: "core", Groups: []string{"wheel"}}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		rendered := struct {
+			Passwd struct {
+				Users []map[string]any `json:"users"`
+			} `json:"passwd"`
+		}{}
+		Expect(json.Unmarshal([]byte(out), &rendered)).To(Succeed())
+		Expect(rendered.Passwd.Users).To(ConsistOf(map[string]any{
+			"name":              "core",
+			"groups":            []any{"wheel"},
+			"sshAuthorizedKeys": []any{"ssh-ed25519 BBBB"},
+		}))
+	})
+})
+
+var _ = Describe("Render DNS servers", func() {
+	// renderDnsConf renders the config and returns the unescaped content of the resolved.conf drop-in
+	renderDnsConf := func(config *Config) string {
+		files := renderFiles(config)
+		Expect(files).To(HaveKey(dnsConfFile))
+		content, err := url.PathUnescape(strings.TrimPrefix(files[dnsConfFile].Contents.Source, "data:,"))
+		Expect(err).NotTo(HaveOccurred())
+		return content
+	}
+
+	It("should render IPv4 and IPv6 DNS servers verbatim", func() {
+		Expect(renderDnsConf(&Config{
+			DnsServers: []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2001:db8::53")},
+		})).To(Equal("[Resolve]\nDNS=1.2.3.4\nDNS=2001:db8::53"))
+	})
+
+	It("should render the fallback DNS servers", func() {
+		Expect(renderDnsConf(&Config{
+			DnsServers:         []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+			FallbackDnsServers: []netip.Addr{netip.MustParseAddr("9.9.9.9"), netip.MustParseAddr("2620:fe::fe")},
+		})).To(Equal("[Resolve]\nDNS=1.2.3.4\nFallbackDNS=9.9.9.9 2620:fe::fe"))
+	})
+
+	It("should render the fallback DNS servers without DNS servers", func() {
+		Expect(renderDnsConf(&Config{
+			FallbackDnsServers: []netip.Addr{netip.MustParseAddr("2620:fe::fe")},
+		})).To(Equal("[Resolve]\nFallbackDNS=2620:fe::fe"))
+	})
+
+	It("should not render the resolved.conf drop-in without DNS servers", func() {
+		Expect(renderFiles(&Config{})).NotTo(HaveKey(dnsConfFile))
+	})
+
+	It("should append the additional ignitions", func() {
+		Expect(renderFiles(&Config{
+			Ignition:            "storage:\n  files:\n  - path: /etc/base\n",
+			AdditionalIgnitions: []string{"storage:\n  files:\n  - path: /etc/extra\n"},
+		})).To(SatisfyAll(HaveKey("/etc/base"), HaveKey("/etc/extra"), HaveKey(hostnameFile)))
+	})
+
+	It("should not interpret the additional ignitions as template", func() {
+		files := renderFiles(&Config{
+			Hostname:            "my-host",
+			AdditionalIgnitions: []string{"storage:\n  files:\n  - path: /etc/extra\n    contents:\n      inline: '{{ .Hostname }} {{ broken'\n"},
+		})
+		Expect(files).To(HaveKey("/etc/extra"))
+		Expect(decodeContents(files["/etc/extra"])).To(Equal("{{ .Hostname }} {{ broken"))
+	})
+
+	It("should link resolv.conf to the stub resolver if enabled", func() {
+		Expect(renderLinks(&Config{
+			DnsServers:        []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+			ResolvConfSymlink: true,
+		})).To(ConsistOf(renderedLink{Path: resolvConfFile, Target: resolvedStubResolvConf, Overwrite: true}))
+	})
+
+	It("should not link resolv.conf if disabled", func() {
+		Expect(renderLinks(&Config{
+			DnsServers: []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		})).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Render userData ignition", func() {
+	// initScript returns the decoded content of the init script
+	initScript := func(files map[string]renderedFile) string {
+		Expect(files).To(HaveKey(initScriptFile))
+		return decodeContents(files[initScriptFile])
+	}
+
+	butaneUserData := "variant: fcos\nversion: 1.3.0\nstorage:\n  files:\n  - path: /etc/from-userdata\n"
+	ignitionUserData := `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"path":"/etc/from-userdata"}]}}`
+
+	It("should render an opaque userData as init script", func() {
+		files := renderFiles(&Config{UserData: "#!/bin/bash\necho hello", UserDataIgnition: true})
+		Expect(initScript(files)).To(Equal("#!/bin/bash\necho hello\n"))
+	})
+
+	It("should render a userData ignition as init script if merging is disabled", func() {
+		files := renderFiles(&Config{UserData: butaneUserData})
+		Expect(files).NotTo(HaveKey("/etc/from-userdata"))
+		Expect(initScript(files)).To(ContainSubstring("/etc/from-userdata"))
+	})
+
+	It("should merge a butane userData and render a no-op init script", func() {
+		files := renderFiles(&Config{UserData: butaneUserData, UserDataIgnition: true})
+		Expect(files).To(SatisfyAll(HaveKey("/etc/from-userdata"), HaveKey(hostnameFile)))
+		Expect(initScript(files)).To(Equal(noopInitScript))
+	})
+
+	It("should merge an ignition userData and render a no-op init script", func() {
+		files := renderFiles(&Config{UserData: ignitionUserData, UserDataIgnition: true})
+		Expect(files).To(SatisfyAll(HaveKey("/etc/from-userdata"), HaveKey(hostnameFile)))
+		Expect(initScript(files)).To(Equal(noopInitScript))
+	})
+
+	It("should let a userData ignition override the colliding fields if configured", func() {
+		files := renderFiles(&Config{UserData: ignitionUserData, UserDataIgnition: true, UserDataIgnitionOverride: true})
+		Expect(files).To(HaveKey("/etc/from-userdata"))
+		Expect(files).NotTo(HaveKey(hostnameFile))
+	})
+
+	It("should not interpret a merged userData as template", func() {
+		files := renderFiles(&Config{
+			Hostname:         "my-host",
+			UserData:         "variant: fcos\nversion: 1.3.0\nstorage:\n  files:\n  - path: /etc/from-userdata\n    contents:\n      inline: '{{ .Hostname }} {{ broken'\n",
+			UserDataIgnition: true,
+		})
+		Expect(files).To(HaveKey("/etc/from-userdata"))
+		Expect(decodeContents(files["/etc/from-userdata"])).To(Equal("{{ .Hostname }} {{ broken"))
+	})
+})
@@ -5,7 +5,11 @@ package metal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"strings"
+	"time"
 
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
@@ -13,18 +17,31 @@ import (
 
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 
+	machinev1alpha1 "github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
+	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // CreateMachine handles a machine creation request
-func (d *metalDriver) CreateMachine(ctx context.Context, req *driver.CreateMachineRequest) (*driver.CreateMachineResponse, error) {
+func (d *metalDriver) CreateMachine(ctx context.Context, req *driver.CreateMachineRequest) (_ *driver.CreateMachineResponse, err error) {
+	var providerSpec *apiv1alpha1.ProviderSpec
+	defer func(start time.Time) {
+		// the node name policy of the provider spec overrides the one of the driver once the provider spec is parsed
+		d.observeOperation(OperationCreate, start, d.getNodeNamePolicy(providerSpec), err)
+	}(time.Now())
+
 	if isEmptyCreateRequest(req) {
 		return nil, status.Error(codes.InvalidArgument, "received empty CreateMachineRequest")
 	}
@@ -33,52 +50,144 @@ func (d *metalDriver) CreateMachine(ctx context.Context, req *driver.CreateMachi
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("requested provider %q is not supported by the driver %q", req.MachineClass.Provider, apiv1alpha1.ProviderName))
 	}
 
-	klog.V(3).Info("Machine creation request has been received", "name", req.Machine.Name)
-	defer klog.V(3).Info("Machine creation request has been processed", "name", req.Machine.Name)
+	ctx, err = d.withMachineNamespace(ctx, req.Machine)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	providerSpec, err := GetProviderSpec(req.MachineClass, req.Secret)
+	klog.V(3).InfoS("Machine creation request has been received", "name", req.Machine.Name)
+	defer klog.V(3).InfoS("Machine creation request has been processed", "name", req.Machine.Name)
+
+	providerSpec, err = GetProviderSpec(req.MachineClass, req.Secret, d.options)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get provider spec: %v", err))
 	}
 
+	if !d.options.AdoptForeignServerClaims {
+		foreign, err := d.isForeignServerClaim(ctx, req.Machine.Name)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check existing ServerClaim: %v", err))
+		}
+		if foreign {
+			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("ServerClaim %q in namespace %q already exists and is not managed by the driver", req.Machine.Name, d.getMetalNamespace(ctx)))
+		}
+	}
+
+	if d.options.VerifyServerSelector {
+		matching, err := d.serversMatchSelector(ctx, providerSpec)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to list servers matching the server selector: %v", err))
+		}
+		if !matching {
+			// the selector has been parsed successfully to list the servers
+			selector, _ := getServerSelector(providerSpec)
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("no server matches the server selector %q of the provider spec", selector))
+		}
+	}
+
+	if d.options.DryRun {
+		return d.createMachineDryRun(ctx, req, providerSpec)
+	}
+
+	if providerSpec.AwaitIPAddressBindingOnCreate && len(providerSpec.IPAMConfig) > 0 {
+		if err := d.createIPAddressClaims(ctx, req.Machine.Name, nil, providerSpec); err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create IPAddressClaims: %v", err))
+		}
+
+		bound, err := d.ipAddressClaimsBound(ctx, req.Machine.Name, providerSpec)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check if IPAddressClaims are bound: %v", err))
+		}
+		if !bound {
+			klog.V(3).InfoS("IPAddressClaims are still not bound, postponing the ServerClaim creation", "name", req.Machine.Name, "namespace", d.getIPAddressClaimNamespace(ctx))
+			// MCM provider retry with codes.Unavailable will ensure a short retry in 5 seconds
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("IPAddressClaims of machine %q in namespace %q are still not bound", req.Machine.Name, d.getIPAddressClaimNamespace(ctx)))
+		}
+	}
+
+	image, err := d.resolveImageAlias(ctx, providerSpec.Image)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to resolve image alias: %v", err))
+	}
+	providerSpec.Image = image
+
 	serverClaim, err := d.createServerClaim(ctx, req, providerSpec)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			// will be retried with short retry by machine controller
+			return nil, status.Error(codes.DeadlineExceeded, fmt.Sprintf("failed to create ServerClaim within %s: %v", d.options.ServerClaimCreateTimeout, err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create ServerClaim: %v", err))
 	}
 
 	// we need the server to be bound if not the ServerClaimName policy in order to get the node name
-	if d.nodeNamePolicy != cmd.NodeNamePolicyServerClaimName {
-		serverBound, err := d.ServerIsBound(ctx, serverClaim)
+	if d.getNodeNamePolicy(providerSpec) != cmd.NodeNamePolicyServerClaimName {
+		serverBound, err := d.awaitServerBound(ctx, serverClaim, providerSpec)
 		if err != nil {
 			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check if server is bound: %v", err))
 		}
 
+		setServerClaimPending(client.ObjectKeyFromObject(serverClaim), !serverBound)
+
 		if serverBound {
-			klog.V(3).Info("Server is already bound, removing recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
-			err = d.patchServerClaimWithRecreateAnnotation(ctx, serverClaim, false)
-			if err != nil {
-				return nil, status.Error(codes.Internal, fmt.Sprintf("failed to patch ServerClaim without recreate annotation: %v", err))
+			klog.V(3).InfoS("Server is already bound, removing recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
+			// the server is bound, so a failed removal must not fail the creation. A remaining annotation makes
+			// GetMachineStatus retrigger the creation flow, which retries the removal.
+			if err := d.patchServerClaimWithRecreateAnnotation(ctx, serverClaim, false); err != nil {
+				klog.Warningf("Failed to remove the recreate annotation of ServerClaim %s: %v", client.ObjectKeyFromObject(serverClaim), err)
 			}
 		} else {
-			klog.V(3).Info("Server is still not bound, adding recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
+			klog.V(3).InfoS("Server is still not bound, adding recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
 			err = d.patchServerClaimWithRecreateAnnotation(ctx, serverClaim, true)
 			if err != nil {
 				return nil, status.Error(codes.Internal, fmt.Sprintf("failed to patch ServerClaim with recreate annotation: %v", err))
 			}
+			d.logServerSelectorDiagnostics(ctx, serverClaim, providerSpec)
 			// MCM provider retry with codes.Unavailable will ensure a short retry in 5 seconds
-			return nil, status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", req.Machine.Name, d.metalNamespace))
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", req.Machine.Name, d.getMetalNamespace(ctx)))
 		}
 	}
 
-	nodeName, err := getNodeName(ctx, d.nodeNamePolicy, serverClaim, d.metalNamespace, d.clientProvider)
+	nodeName, err := d.resolveNodeName(ctx, d.getNodeNamePolicy(providerSpec), serverClaim)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get node name: %v", err))
 	}
 
 	if d.nodeExistsByName(ctx, nodeName) {
-		klog.V(3).Info("Node with the same name already exists in cluster, MCM may terminate and recreate machine", "name", nodeName)
+		klog.V(3).InfoS("Node with the same name already exists in cluster, MCM may terminate and recreate machine", "name", nodeName)
+	}
+
+	return &driver.CreateMachineResponse{
+		ProviderID: getProviderIDForServerClaim(serverClaim),
+		NodeName:   nodeName,
+	}, nil
+}
+
+// createMachineDryRun applies the IPAddressClaims and the ServerClaim of the machine in dry-run mode, so that they are
+// validated by the metal API without being persisted. The node name is only known for the ServerClaimName node name
+// policy, as the ServerClaim is never bound to a server.
+func (d *metalDriver) createMachineDryRun(ctx context.Context, req *driver.CreateMachineRequest, providerSpec *apiv1alpha1.ProviderSpec) (*driver.CreateMachineResponse, error) {
+	image, err := d.resolveImageAlias(ctx, providerSpec.Image)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to resolve image alias: %v", err))
 	}
+	providerSpec.Image = image
 
+	if err := d.createIPAddressClaims(ctx, req.Machine.Name, nil, providerSpec, client.DryRunAll); err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create IPAddressClaims in dry-run: %v", err))
+	}
+
+	serverClaim, err := d.createServerClaim(ctx, req, providerSpec, client.DryRunAll)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create ServerClaim in dry-run: %v", err))
+	}
+
+	var nodeName string
+	if d.getNodeNamePolicy(providerSpec) == cmd.NodeNamePolicyServerClaimName {
+		nodeName = serverClaim.Name
+	}
+
+	klog.V(3).InfoS("Machine creation has been validated in dry-run", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx))
 	return &driver.CreateMachineResponse{
 		ProviderID: getProviderIDForServerClaim(serverClaim),
 		NodeName:   nodeName,
@@ -90,9 +199,82 @@ func isEmptyCreateRequest(req *driver.CreateMachineRequest) bool {
 	return req == nil || req.MachineClass == nil || req.Machine == nil || req.Secret == nil
 }
 
-// createServerClaim creates and applies a ServerClaim object with proper ignition data
-func (d *metalDriver) createServerClaim(ctx context.Context, req *driver.CreateMachineRequest, providerSpec *apiv1alpha1.ProviderSpec) (*metalv1alpha1.ServerClaim, error) {
-	klog.V(3).Info("Creating ServerClaim", "name", req.Machine.Name, "namespace", d.metalNamespace)
+// ipAddressClaimsBound checks if all IPAddressClaims of the ipam config are bound to an IPAddress
+func (d *metalDriver) ipAddressClaimsBound(ctx context.Context, machineName string, providerSpec *apiv1alpha1.ProviderSpec) (bool, error) {
+	for _, ipamConfig := range providerSpec.IPAMConfig {
+		ipClaim := &capiv1beta1.IPAddressClaim{}
+		if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+			return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getIPAddressClaimNamespace(ctx), Name: getIPAddressClaimName(machineName, ipamConfig.MetadataKey)}, ipClaim)
+		}); err != nil {
+			return false, fmt.Errorf("failed to get IPAddressClaim: %w", err)
+		}
+		if ipClaim.Status.AddressRef.Name == "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resolveImageAlias resolves the image through the image alias ConfigMap if configured, an image without a matching
+// alias is returned unchanged
+func (d *metalDriver) resolveImageAlias(ctx context.Context, image string) (string, error) {
+	if d.options.ImageAliasConfigMap == "" || image == "" {
+		return image, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: d.options.ImageAliasConfigMap}, configMap)
+	}); err != nil {
+		return "", fmt.Errorf("failed to get image alias ConfigMap: %w", err)
+	}
+
+	resolved, ok := configMap.Data[image]
+	if !ok || resolved == "" {
+		return image, nil
+	}
+
+	klog.V(3).InfoS("Resolved image alias", "alias", image, "image", resolved)
+	return resolved, nil
+}
+
+// createServerClaim creates and applies a ServerClaim object with proper ignition data, the apply options are passed
+// to the apply, e.g. to apply in dry-run mode
+func (d *metalDriver) createServerClaim(ctx context.Context, req *driver.CreateMachineRequest, providerSpec *apiv1alpha1.ProviderSpec, applyOpts ...client.PatchOption) (*metalv1alpha1.ServerClaim, error) {
+	klog.V(3).InfoS("Creating ServerClaim", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx))
+
+	// we will power on the server later, an already powered on ServerClaim of the machine is not powered off again
+	// as this would reboot a possibly running node
+	power := metalv1alpha1.PowerOff
+	existing, err := d.getExistingServerClaim(ctx, req.Machine.Name)
+	if err != nil {
+		return nil, err
+	}
+	managed := existing != nil && d.isManagedObject(existing)
+	if managed && existing.Spec.Power == metalv1alpha1.PowerOn {
+		klog.V(3).InfoS("ServerClaim is already powered on, keeping its power state", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx))
+		power = metalv1alpha1.PowerOn
+	}
+
+	// the image of an existing ServerClaim, e.g. an adopted ServerClaim without or with a stale image, is reconciled
+	// to the image of the provider spec by the apply, as the node would boot the wrong image otherwise
+	if existing != nil && existing.Spec.Image != providerSpec.Image {
+		klog.V(3).InfoS("Reconciling the image of the existing ServerClaim", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx), "currentImage", existing.Spec.Image, "image", providerSpec.Image)
+	}
+
+	// the provisioning start of a ServerClaim created again is kept to observe the full provisioning duration
+	provisioningStart := time.Now().UTC().Format(time.RFC3339)
+	if managed && existing.Annotations[validation.AnnotationKeyProvisioningStart] != "" {
+		provisioningStart = existing.Annotations[validation.AnnotationKeyProvisioningStart]
+	}
+
+	labels := make(map[string]string, len(d.options.DefaultServerClaimLabels)+len(providerSpec.Labels)+1)
+	maps.Copy(labels, d.options.DefaultServerClaimLabels)
+	maps.Copy(labels, providerSpec.Labels)
+	labels[validation.LabelKeyManagedBy] = d.getManagedByLabelValue()
+
+	annotations := getNodeTemplateAnnotations(req.Machine)
+	annotations[validation.AnnotationKeyProvisioningStart] = provisioningStart
 
 	serverClaim := &metalv1alpha1.ServerClaim{
 		TypeMeta: metav1.TypeMeta{
@@ -100,33 +282,119 @@ func (d *metalDriver) createServerClaim(ctx context.Context, req *driver.CreateM
 			Kind:       "ServerClaim",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      req.Machine.Name,
-			Namespace: d.metalNamespace,
-			Labels:    providerSpec.Labels,
+			Name:        req.Machine.Name,
+			Namespace:   d.getMetalNamespace(ctx),
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Spec: metalv1alpha1.ServerClaimSpec{
-			Power: metalv1alpha1.PowerOff, // we will power on the server later
+			Power: power,
 			ServerSelector: &metav1.LabelSelector{
 				MatchLabels:      providerSpec.ServerLabels,
-				MatchExpressions: nil,
+				MatchExpressions: providerSpec.ServerSelectorExpressions,
 			},
 			Image: providerSpec.Image,
 		},
 	}
 
+	if timeout := d.options.ServerClaimCreateTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// the ServerClaim spec template allows to adapt the spec to the fields accepted by the metal-operator version
+	var obj client.Object = serverClaim
+	if d.options.ServerClaimSpecTemplate != "" {
+		if obj, err = applyServerClaimSpecTemplate(serverClaim, d.options.ServerClaimSpecTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Patch(ctx, obj, client.Apply, append([]client.PatchOption{d.getFieldOwner(), client.ForceOwnership}, applyOpts...)...)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create ServerClaim: %w", err)
+	}
+
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, serverClaim); err != nil {
+			return nil, fmt.Errorf("failed to convert ServerClaim: %w", err)
+		}
+	}
+
+	klog.V(3).InfoS("Successfully created ServerClaim", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
+	return serverClaim, nil
+}
+
+// mcmAnnotationDomain is the domain of the annotation keys used internally by the machine-controller-manager
+const mcmAnnotationDomain = "machine.sapcloud.io"
+
+// getNodeTemplateAnnotations returns the annotations of the NodeTemplateSpec of the machine to be mirrored on its
+// ServerClaim. Keys of the machine-controller-manager and keys reserved by the driver, e.g. the recreate annotation,
+// are left out.
+func getNodeTemplateAnnotations(machine *machinev1alpha1.Machine) map[string]string {
+	annotations := make(map[string]string, len(machine.Spec.NodeTemplateSpec.Annotations)+1)
+	for key, value := range machine.Spec.NodeTemplateSpec.Annotations {
+		if strings.HasPrefix(key, validation.ReservedKeyPrefix) {
+			continue
+		}
+		if prefix, _, ok := strings.Cut(key, "/"); ok && (prefix == mcmAnnotationDomain || strings.HasSuffix(prefix, "."+mcmAnnotationDomain)) {
+			continue
+		}
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// isForeignServerClaim checks if a ServerClaim with the given name exists which is not managed by the driver.
+// ServerClaims created before the managed-by label was introduced are recognized by the field owner of the driver.
+func (d *metalDriver) isForeignServerClaim(ctx context.Context, name string) (bool, error) {
+	serverClaim := &metalv1alpha1.ServerClaim{}
 	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
-		return metalClient.Patch(ctx, serverClaim, client.Apply, fieldOwner, client.ForceOwnership)
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: name}, serverClaim)
 	}); err != nil {
-		return nil, fmt.Errorf("failed to create ServerClaim: %s", err.Error())
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get ServerClaim %q: %v", name, err)
 	}
 
-	klog.V(3).Info("Successfully created ServerClaim", "name", serverClaim.Name, "namespace", serverClaim.Namespace)
+	return !d.isManagedObject(serverClaim), nil
+}
+
+// isManagedObject checks if the object is managed by the driver by its managed-by label or the field owner of the
+// driver, as objects created before the managed-by label was introduced are only applied by the field owner
+func (d *metalDriver) isManagedObject(obj client.Object) bool {
+	if obj.GetLabels()[validation.LabelKeyManagedBy] == d.getManagedByLabelValue() {
+		return true
+	}
+	for _, managedField := range obj.GetManagedFields() {
+		if managedField.Manager == string(d.getFieldOwner()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getExistingServerClaim returns the ServerClaim of the machine if it already exists, e.g. if the machine is created again
+// after its creation response got lost or a foreign ServerClaim is adopted
+func (d *metalDriver) getExistingServerClaim(ctx context.Context, name string) (*metalv1alpha1.ServerClaim, error) {
+	serverClaim := &metalv1alpha1.ServerClaim{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: name}, serverClaim)
+	}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ServerClaim %q: %w", name, err)
+	}
 	return serverClaim, nil
 }
 
 // patchServerClaimWithRecreateAnnotation patches the ServerClaim with an annotation to trigger a machine recreation
 func (d *metalDriver) patchServerClaimWithRecreateAnnotation(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, addAnnotation bool) error {
-	klog.V(3).Info("Patching ServerClaim with/-out recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "addAnnotation", addAnnotation)
+	klog.V(3).InfoS("Patching ServerClaim with/-out recreate annotation", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "addAnnotation", addAnnotation)
 
 	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
 		baseServerClaim := serverClaim.DeepCopy()
@@ -157,6 +425,92 @@ func (d *metalDriver) ServerIsBound(ctx context.Context, serverClaim *metalv1alp
 	return serverClaim.Spec.ServerRef != nil, nil
 }
 
+// awaitServerBound polls until the server of the ServerClaim is bound or the bind timeout of the provider spec is
+// reached, a zero bind timeout only checks once
+func (d *metalDriver) awaitServerBound(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) (bool, error) {
+	timeout := time.Duration(providerSpec.BindTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		return d.ServerIsBound(ctx, serverClaim)
+	}
+
+	var serverBound bool
+	if err := pollUntilContextTimeoutWithJitter(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		if serverBound, err = d.ServerIsBound(ctx, serverClaim); err != nil && ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return serverBound, err
+	}); err != nil {
+		if wait.Interrupted(err) {
+			klog.V(3).InfoS("Server is not bound within the bind timeout", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "timeout", timeout)
+			return false, nil
+		}
+		return false, err
+	}
+
+	return serverBound, nil
+}
+
+// logServerSelectorDiagnostics logs the number of free servers matching the server selector of a pending ServerClaim
+// if enabled, helping to tune selectors which match no or too many servers
+func (d *metalDriver) logServerSelectorDiagnostics(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) {
+	if !d.options.ServerSelectorDiagnostics {
+		return
+	}
+
+	selector, err := getServerSelector(providerSpec)
+	if err != nil {
+		klog.V(3).InfoS("Failed to parse server selector", "error", err)
+		return
+	}
+	serverList := &metalv1alpha1.ServerList{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.List(ctx, serverList, client.MatchingLabelsSelector{Selector: selector})
+	}); err != nil {
+		klog.V(3).InfoS("Failed to list servers", "error", err)
+		return
+	}
+
+	freeServers := 0
+	for _, server := range serverList.Items {
+		if server.Spec.ServerClaimRef == nil {
+			freeServers++
+		}
+	}
+
+	switch freeServers {
+	case 0:
+		klog.Warningf("No free server matches the selector %q of ServerClaim %s", selector, client.ObjectKeyFromObject(serverClaim))
+	case 1:
+		klog.Infof("One free server matches the selector %q of ServerClaim %s", selector, client.ObjectKeyFromObject(serverClaim))
+	default:
+		klog.Warningf("%d free servers match the selector %q of pending ServerClaim %s, consider a more specific selector", freeServers, selector, client.ObjectKeyFromObject(serverClaim))
+	}
+}
+
+// getServerSelector returns the server selector of the provider spec built from the server labels and expressions
+func getServerSelector(providerSpec *apiv1alpha1.ProviderSpec) (labels.Selector, error) {
+	return metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels:      providerSpec.ServerLabels,
+		MatchExpressions: providerSpec.ServerSelectorExpressions,
+	})
+}
+
+// serversMatchSelector checks if any server matches the server selector of the provider spec, whether it is claimed or not
+func (d *metalDriver) serversMatchSelector(ctx context.Context, providerSpec *apiv1alpha1.ProviderSpec) (bool, error) {
+	selector, err := getServerSelector(providerSpec)
+	if err != nil {
+		return false, err
+	}
+	serverList := &metalv1alpha1.ServerList{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.List(ctx, serverList, client.MatchingLabelsSelector{Selector: selector}, client.Limit(1))
+	}); err != nil {
+		return false, err
+	}
+	return len(serverList.Items) > 0, nil
+}
+
 func (d *metalDriver) nodeExistsByName(ctx context.Context, nodeName string) bool {
 	nodeFound := false
 
@@ -174,7 +528,7 @@ func (d *metalDriver) nodeExistsByName(ctx context.Context, nodeName string) boo
 		}
 		return nil
 	}); err != nil {
-		klog.V(3).Info("Failed to list nodes", "error", err)
+		klog.V(3).InfoS("Failed to list nodes", "error", err)
 	}
 
 	return nodeFound
@@ -4,13 +4,21 @@
 package metal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"time"
 
+	machinev1alpha1 "github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/metal/testing"
 
@@ -18,8 +26,15 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
@@ -72,8 +87,9 @@ var _ = Describe("CreateMachine", func() {
 
 		Eventually(Object(serverClaim)).Should(SatisfyAll(
 			HaveField("ObjectMeta.Labels", map[string]string{
-				ShootNameLabelKey:      "my-shoot",
-				ShootNamespaceLabelKey: "my-shoot-namespace",
+				ShootNameLabelKey:            "my-shoot",
+				ShootNamespaceLabelKey:       "my-shoot-namespace",
+				validation.LabelKeyManagedBy: ManagedByLabelValue,
 			}),
 			HaveField("Spec.Power", metalv1alpha1.PowerOff),
 			HaveField("Spec.ServerSelector", &metav1.LabelSelector{
@@ -91,6 +107,45 @@ var _ = Describe("CreateMachine", func() {
 		})
 	})
 
+	It("should fail if a foreign ServerClaim with the machine name exists", func(ctx SpecContext) {
+		machineIndex := 2
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a ServerClaim which is not managed by the driver")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+				Labels: map[string]string{
+					"foo": "bar",
+				},
+			},
+			Spec: metalv1alpha1.ServerClaimSpec{
+				Power: metalv1alpha1.PowerOn,
+				Image: "foreign-image",
+			},
+		}
+		Expect(k8sClient.Create(ctx, serverClaim)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, serverClaim)
+
+		By("failing to create the machine")
+		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.AlreadyExists, fmt.Sprintf(`ServerClaim %q in namespace %q already exists and is not managed by the driver`, machineName, ns.Name))))
+		Expect(createMachineResponse).To(BeNil())
+
+		By("ensuring that the ServerClaim has not been adopted")
+		Consistently(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", map[string]string{
+				"foo": "bar",
+			}),
+			HaveField("Spec.Power", metalv1alpha1.PowerOn),
+			HaveField("Spec.Image", "foreign-image"),
+		))
+	})
+
 	It("should fail if the machine request is empty", func(ctx SpecContext) {
 		By("failing if the machine request is empty")
 		createMachineResponse, err := (*drv).CreateMachine(ctx, nil)
@@ -132,6 +187,35 @@ var _ = Describe("CreateMachine", func() {
 		Expect(err).Should(MatchError(status.Error(codes.Internal, `failed to get provider spec: failed to validate provider spec and secret: [userData: Required value: userData is required]`)))
 		Expect(createMachineResponse).To(BeNil())
 	})
+
+	It("should fail if the provided secret is intended for another MachineClass", func(ctx SpecContext) {
+		By("failing if the secret is annotated with another MachineClass")
+		misroutedSecret := providerSecret.DeepCopy()
+		misroutedSecret.Annotations = map[string]string{
+			validation.AnnotationKeyMachineClassName: "other-class",
+		}
+		machineClass := newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec)
+		machineClass.Name = "my-class"
+		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, -1, nil),
+			MachineClass: machineClass,
+			Secret:       misroutedSecret,
+		})
+		Expect(err).Should(MatchError(status.Error(codes.Internal, `failed to get provider spec: failed to validate provider spec and secret: [secret.metadata.annotations[metal.ironcore.dev/machine-class-name]: Invalid value: "other-class": secret is not intended for MachineClass "my-class"]`)))
+		Expect(createMachineResponse).To(BeNil())
+	})
+
+	It("should fail if the MachineClass has no image", func(ctx SpecContext) {
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		delete(providerSpec, "image")
+		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, -1, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).Should(MatchError(status.Error(codes.Internal, `failed to get provider spec: failed to validate provider spec and secret: [spec.image: Required value: image is required]`)))
+		Expect(createMachineResponse).To(BeNil())
+	})
 })
 
 var _ = Describe("CreateMachine with Server name as hostname", func() {
@@ -191,8 +275,9 @@ var _ = Describe("CreateMachine with Server name as hostname", func() {
 
 		Eventually(Object(serverClaim)).Should(SatisfyAll(
 			HaveField("ObjectMeta.Labels", map[string]string{
-				ShootNameLabelKey:      "my-shoot",
-				ShootNamespaceLabelKey: "my-shoot-namespace",
+				ShootNameLabelKey:            "my-shoot",
+				ShootNamespaceLabelKey:       "my-shoot-namespace",
+				validation.LabelKeyManagedBy: ManagedByLabelValue,
 			}),
 			HaveField("Spec.Power", metalv1alpha1.PowerOff),
 			HaveField("Spec.ServerSelector", &metav1.LabelSelector{
@@ -377,3 +462,1191 @@ var _ = Describe("CreateMachine using BMC names", func() {
 		})
 	})
 })
+
+var _ = Describe("CreateMachine adopting foreign ServerClaims", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		AdoptForeignServerClaims: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should adopt a foreign ServerClaim with the machine name", func(ctx SpecContext) {
+		machineIndex := 6
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a ServerClaim which is not managed by the driver")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+			Spec: metalv1alpha1.ServerClaimSpec{
+				Power: metalv1alpha1.PowerOn,
+				Image: "foreign-image",
+			},
+		}
+		Expect(k8sClient.Create(ctx, serverClaim)).To(Succeed())
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that the ServerClaim has been adopted")
+		Eventually(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyManagedBy, ManagedByLabelValue)),
+			HaveField("Spec.Power", metalv1alpha1.PowerOff),
+		))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+
+	It("should correct the stale image of an adopted ServerClaim", func(ctx SpecContext) {
+		machineIndex := 31
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a ServerClaim with a stale image which is not managed by the driver")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+			Spec: metalv1alpha1.ServerClaimSpec{
+				Power: metalv1alpha1.PowerOff,
+				Image: "stale-image",
+			},
+		}
+		Expect(k8sClient.Create(ctx, serverClaim)).To(Succeed())
+
+		By("creating machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+
+		By("ensuring that the image of the adopted ServerClaim has been corrected")
+		Eventually(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyManagedBy, ManagedByLabelValue)),
+			HaveField("Spec.Image", testing.SampleProviderSpec["image"]),
+		))
+	})
+})
+
+var _ = Describe("CreateMachine with diskless servers", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		AllowDiskless: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should create a machine without an image", func(ctx SpecContext) {
+		machineIndex := 7
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		delete(providerSpec, "image")
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that a ServerClaim without an image has been created")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("Spec.Image", BeEmpty()))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with image fallback", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ImageFallback: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should create a ServerClaim with the image of the MachineClass annotation", func(ctx SpecContext) {
+		machineIndex := 8
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		delete(providerSpec, "image")
+		machineClass := newMachineClass(v1alpha1.ProviderName, providerSpec)
+		machineClass.Annotations = map[string]string{
+			validation.AnnotationKeyImage: "annotated-image",
+		}
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring that the ServerClaim uses the image of the MachineClass annotation")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("Spec.Image", "annotated-image"))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = DescribeTable("GetProviderSpec with image fallback",
+	func(specImage, annotationImage, secretImage string, options Options, expectedImage, expectedErr string) {
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		delete(providerSpec, "image")
+		if specImage != "" {
+			providerSpec["image"] = specImage
+		}
+		machineClass := newMachineClass(v1alpha1.ProviderName, providerSpec)
+		if annotationImage != "" {
+			machineClass.Annotations = map[string]string{validation.AnnotationKeyImage: annotationImage}
+		}
+		secret := &corev1.Secret{Data: map[string][]byte{"userData": []byte("abcd")}}
+		if secretImage != "" {
+			secret.Data[validation.SecretKeyImage] = []byte(secretImage)
+		}
+
+		spec, err := GetProviderSpec(machineClass, secret, options)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(expectedErr))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Image).To(Equal(expectedImage))
+	},
+	Entry("should prefer the image of the provider spec",
+		"spec-image", "annotated-image", "secret-image", Options{ImageFallback: true}, "spec-image", ""),
+	Entry("should fall back to the image of the MachineClass annotation",
+		"", "annotated-image", "secret-image", Options{ImageFallback: true}, "annotated-image", ""),
+	Entry("should fall back to the image of the provider secret",
+		"", "", "secret-image", Options{ImageFallback: true}, "secret-image", ""),
+	Entry("should fail if no source provides an image",
+		"", "", "", Options{ImageFallback: true}, "", "failed to validate provider spec and secret: [spec.image: Required value: image is required]"),
+	Entry("should not fall back if the image fallback is disabled",
+		"", "annotated-image", "secret-image", Options{}, "", "failed to validate provider spec and secret: [spec.image: Required value: image is required]"),
+)
+
+var _ = Describe("CreateMachine with server selector diagnostics", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerName, Options{
+		ServerSelectorDiagnostics: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	DescribeTable("should log the number of matching free servers of a pending ServerClaim",
+		func(ctx SpecContext, machineIndex, matchingServers int, expectedLog string) {
+			By("creating servers")
+			for i := range matchingServers {
+				server := &metalv1alpha1.Server{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: fmt.Sprintf("diagnostics-server-%d", i),
+						Labels: map[string]string{
+							"instance-type": "bar",
+						},
+					},
+					Spec: metalv1alpha1.ServerSpec{
+						SystemUUID: fmt.Sprintf("diagnostics-%d", i),
+					},
+				}
+				Expect(k8sClient.Create(ctx, server)).To(Succeed())
+				DeferCleanup(k8sClient.Delete, server)
+			}
+
+			By("creating a server which does not match the selector")
+			server := &metalv1alpha1.Server{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "diagnostics-other-server",
+					Labels: map[string]string{
+						"instance-type": "other",
+					},
+				},
+				Spec: metalv1alpha1.ServerSpec{
+					SystemUUID: "diagnostics-other",
+				},
+			}
+			Expect(k8sClient.Create(ctx, server)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, server)
+
+			By("redirecting the log output")
+			buf := &bytes.Buffer{}
+			klog.LogToStderr(false)
+			klog.SetOutput(buf)
+			DeferCleanup(func() {
+				klog.SetOutput(os.Stderr)
+				klog.LogToStderr(true)
+			})
+
+			By("creating machine")
+			_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf(`server "%s-%d" in namespace %q is still not bound`, machineNamePrefix, machineIndex, ns.Name))))
+			klog.Flush()
+
+			By("ensuring that the diagnostics have been logged")
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf(expectedLog, ns.Name, machineNamePrefix, machineIndex)))
+
+			By("ensuring the cleanup of the machine")
+			DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+		},
+		Entry("no matching server", 9, 0, `No free server matches the selector "instance-type=bar" of ServerClaim %s/%s-%d`),
+		Entry("one matching server", 10, 1, `One free server matches the selector "instance-type=bar" of ServerClaim %s/%s-%d`),
+		Entry("many matching servers", 11, 3, `3 free servers match the selector "instance-type=bar" of pending ServerClaim %s/%s-%d, consider a more specific selector`),
+	)
+})
+
+var _ = Describe("CreateMachine awaiting the IP address binding", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-create"
+
+	It("should create the ServerClaim only once the IPAddressClaims are bound", func(ctx SpecContext) {
+		machineIndex := 12
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["awaitIPAddressBindingOnCreate"] = true
+		ip, ipClaim := newIPRef(machineName, ns.Name, "pool-await", providerSpec, "10.11.17.17", "10.11.17.1")
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+
+		By("failing to create the machine while the IPAddressClaim is not bound")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("IPAddressClaims of machine %q in namespace %q are still not bound", machineName, ns.Name))))
+
+		By("ensuring that the IPAddressClaim has been created without owner reference")
+		Eventually(Object(ipClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyServerClaimName, machineName)),
+			HaveField("ObjectMeta.OwnerReferences", BeEmpty()),
+		))
+
+		By("ensuring that no ServerClaim has been created")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Consistently(Get(serverClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+		By("binding the IPAddressClaim")
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = ip.Name
+		})).Should(Succeed())
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+		Eventually(Get(serverClaim)).Should(Succeed())
+
+		By("deleting the machine")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+
+		By("ensuring that the IPAddressClaim has been deleted")
+		Eventually(Get(ipClaim)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should not create IPAddressClaims on machine creation if the binding is not awaited", func(ctx SpecContext) {
+		machineIndex := 13
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		_, ipClaim := newIPRef(machineName, ns.Name, "pool-no-await", providerSpec, "10.11.18.18", "10.11.18.1")
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that no IPAddressClaim has been created")
+		Consistently(Get(ipClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with a ServerClaim creation timeout", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-create"
+
+	It("should fail with DeadlineExceeded if the ServerClaim creation blocks", func(ctx SpecContext) {
+		machineIndex := 14
+		By("creating a driver with a client blocking the ServerClaim creation")
+		watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+		blockingClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if _, ok := obj.(*metalv1alpha1.ServerClaim); ok {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		})
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(blockingClient)
+		drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerClaimName, Options{
+			ServerClaimCreateTimeout: 100 * time.Millisecond,
+		})
+
+		By("creating machine")
+		_, err = drv.CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(ContainSubstring("code = [DeadlineExceeded]")))
+		Expect(err).To(MatchError(ContainSubstring("failed to create ServerClaim within 100ms")))
+	})
+})
+
+var _ = Describe("CreateMachine with default ServerClaim labels", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		DefaultServerClaimLabels: map[string]string{
+			"environment": "prod",
+			"team":        "infra",
+		},
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should set the default labels with a lower precedence than the provider spec labels", func(ctx SpecContext) {
+		machineIndex := 15
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["labels"] = map[string]string{
+			"team":       "platform",
+			"shoot-name": "my-shoot",
+		}
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring that the ServerClaim has the merged labels")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.Labels", Equal(map[string]string{
+			"environment":                "prod",
+			"team":                       "platform",
+			"shoot-name":                 "my-shoot",
+			validation.LabelKeyManagedBy: ManagedByLabelValue,
+		})))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with image aliases", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ImageAliasConfigMap: "image-aliases",
+	})
+	machineNamePrefix := "machine-create"
+
+	BeforeEach(func(ctx SpecContext) {
+		By("creating the image alias ConfigMap")
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "image-aliases",
+				Namespace: ns.Name,
+			},
+			Data: map[string]string{
+				"stable": "registry.example.com/os:1.2.3",
+			},
+		}
+		Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, configMap)
+	})
+
+	DescribeTable("should resolve the image of the ServerClaim",
+		func(ctx SpecContext, machineIndex int, image, expectedImage string) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+			providerSpec := maps.Clone(testing.SampleProviderSpec)
+			providerSpec["image"] = image
+
+			By("creating machine")
+			Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})).NotTo(BeNil())
+
+			By("ensuring that the ServerClaim has the expected image")
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      machineName,
+					Namespace: ns.Name,
+				},
+			}
+			Eventually(Object(serverClaim)).Should(HaveField("Spec.Image", expectedImage))
+
+			By("ensuring the cleanup of the machine")
+			DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+		},
+		Entry("resolving an alias", 16, "stable", "registry.example.com/os:1.2.3"),
+		Entry("passing through a literal reference", 17, "registry.example.com/os:4.5.6", "registry.example.com/os:4.5.6"),
+	)
+})
+
+var _ = Describe("CreateMachine with an already powered on ServerClaim", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-create"
+
+	It("should not power off the ServerClaim of the machine", func(ctx SpecContext) {
+		machineIndex := 18
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("powering on the ServerClaim as done by a prior initialization")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.Power = metalv1alpha1.PowerOn
+		})).Should(Succeed())
+
+		By("creating the machine again")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that the ServerClaim has not been powered off")
+		Consistently(Object(serverClaim)).Should(HaveField("Spec.Power", metalv1alpha1.PowerOn))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with a ServerClaim spec template", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ServerClaimSpecTemplate: "image: {{ printf \"%s-custom\" .Image | quote }}\nserverSelector: {{ toJson .ServerSelector }}\npower: {{ .Power | quote }}\n",
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should create the ServerClaim with the rendered spec", func(ctx SpecContext) {
+		machineIndex := 19
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that the ServerClaim has the substituted values")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyManagedBy, ManagedByLabelValue)),
+			HaveField("Spec.Image", Equal(testing.SampleProviderSpec["image"].(string)+"-custom")),
+			HaveField("Spec.Power", Equal(metalv1alpha1.PowerOff)),
+			HaveField("Spec.ServerSelector", Equal(&metav1.LabelSelector{
+				MatchLabels: testing.SampleProviderSpec["serverLabels"].(map[string]string),
+			})),
+		))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine verifying the server selector", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		VerifyServerSelector: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should fail if no server matches the server labels", func(ctx SpecContext) {
+		machineIndex := 20
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a server which does not match the selector")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "selector-other-server",
+				Labels: map[string]string{
+					"instance-type": "other",
+				},
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "selector-other",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("failing to create the machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.FailedPrecondition, `no server matches the server selector "instance-type=bar" of the provider spec`)))
+
+		By("ensuring that no ServerClaim has been created")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Consistently(Get(serverClaim)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	It("should create the machine if a claimed server matches the server labels", func(ctx SpecContext) {
+		machineIndex := 21
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a claimed server which matches the selector")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "selector-server",
+				Labels: map[string]string{
+					"instance-type": "bar",
+				},
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "selector",
+				ServerClaimRef: &corev1.ObjectReference{
+					Namespace: ns.Name,
+					Name:      "other-claim",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating the machine")
+		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(createMachineResponse.NodeName).To(Equal(machineName))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with a bind timeout", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerName)
+	machineNamePrefix := "machine-create"
+
+	It("should wait for the server to be bound", func(ctx SpecContext) {
+		machineIndex := 22
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "bind-timeout-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "bind-timeout",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["bindTimeoutSeconds"] = 30
+
+		By("starting a non-blocking goroutine to patch ServerClaim")
+		go func() {
+			defer GinkgoRecover()
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			Eventually(Update(serverClaim, func() {
+				serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+			})).Should(Succeed())
+		}()
+
+		By("creating the machine within a single request")
+		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(createMachineResponse.NodeName).To(Equal(server.Name))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+
+	It("should fail if the server is not bound within the bind timeout", func(ctx SpecContext) {
+		machineIndex := 23
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["bindTimeoutSeconds"] = 1
+
+		By("failing to create the machine after the bind timeout")
+		start := time.Now()
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", machineName, ns.Name))))
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine failing to remove the recreate annotation", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerName)
+	machineNamePrefix := "machine-create"
+
+	It("should create the machine once the server is bound", func(ctx SpecContext) {
+		machineIndex := 24
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a driver with a client failing to remove the recreate annotation")
+		watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+		failingClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if _, ok := obj.(*metalv1alpha1.ServerClaim); ok && patch.Type() == types.MergePatchType && obj.GetAnnotations()[validation.AnnotationKeyMCMMachineRecreate] == "" {
+					return errors.New("injected patch failure")
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		})
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(failingClient)
+		drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerName, Options{})
+
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "recreate-annotation-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "recreate-annotation",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("failing to create the machine while the server is not bound")
+		_, err = drv.CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", machineName, ns.Name))))
+
+		By("binding the server")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("creating the machine although the recreate annotation can not be removed")
+		createMachineResponse, err := drv.CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(createMachineResponse.NodeName).To(Equal(server.Name))
+		Expect(Object(serverClaim)()).To(HaveField("ObjectMeta.Annotations", HaveKeyWithValue(validation.AnnotationKeyMCMMachineRecreate, "true")))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup(k8sClient.Delete, serverClaim)
+	})
+})
+
+var _ = Describe("CreateMachine metrics", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerName)
+	machineNamePrefix := "machine-create"
+
+	It("should count the operations and the pending ServerClaims", func(ctx SpecContext) {
+		machineIndex := 25
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		unavailableCreations := machineOperations.WithLabelValues(OperationCreate, codes.Unavailable.String(), string(cmd.NodeNamePolicyServerName))
+		deletions := machineOperations.WithLabelValues(OperationDelete, codes.OK.String(), string(cmd.NodeNamePolicyServerName))
+		creations := promtestutil.ToFloat64(unavailableCreations)
+		pending := promtestutil.ToFloat64(pendingServerClaimsGauge)
+
+		By("failing to create the machine while the server is not bound")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", machineName, ns.Name))))
+		Expect(promtestutil.ToFloat64(unavailableCreations)).To(Equal(creations + 1))
+		Expect(promtestutil.ToFloat64(pendingServerClaimsGauge)).To(Equal(pending + 1))
+
+		By("binding the ServerClaim after CreateMachine returned")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: "late-server"}
+		})).Should(Succeed())
+
+		By("ensuring the ServerClaim is no longer pending once its status is observed")
+		_, _ = (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(promtestutil.ToFloat64(pendingServerClaimsGauge)).To(Equal(pending))
+
+		By("deleting the machine")
+		deleted := promtestutil.ToFloat64(deletions)
+		_, err = (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promtestutil.ToFloat64(deletions)).To(Equal(deleted + 1))
+		Expect(promtestutil.ToFloat64(pendingServerClaimsGauge)).To(Equal(pending))
+	})
+
+	It("should label the operations with the node name policy of the MachineClass", func(ctx SpecContext) {
+		machineIndex := 35
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["nodeNamePolicy"] = cmd.NodeNamePolicyServerClaimName
+		creations := machineOperations.WithLabelValues(OperationCreate, codes.OK.String(), string(cmd.NodeNamePolicyServerClaimName))
+		created := promtestutil.ToFloat64(creations)
+
+		By("creating the machine with the ServerClaimName policy of the MachineClass")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+		Expect(promtestutil.ToFloat64(creations)).To(Equal(created + 1))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with server selector expressions", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-create"
+
+	It("should pass the expressions to the server selector of the ServerClaim", func(ctx SpecContext) {
+		machineIndex := 26
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		expressions := []metav1.LabelSelectorRequirement{
+			{Key: "instance-type", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+			{Key: "zone", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"x"}},
+		}
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["serverSelectorExpressions"] = expressions
+
+		By("creating the machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring that the ServerClaim selects servers by the labels and expressions")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("Spec.ServerSelector", &metav1.LabelSelector{
+			MatchLabels:      testing.SampleProviderSpec["serverLabels"].(map[string]string),
+			MatchExpressions: expressions,
+		}))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with NodeTemplateSpec annotations", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerName)
+	machineNamePrefix := "machine-create"
+
+	It("should mirror the annotations on the ServerClaim except internal keys", func(ctx SpecContext) {
+		machineIndex := 27
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		annotations := map[string]string{
+			"example.org/cost-center": "42",
+			"team":                    "metal",
+			"node.machine.sapcloud.io/not-managed-by-mcm": "true",
+			"machine.sapcloud.io/preserve":                "now",
+			validation.AnnotationKeyMCMMachineRecreate:    "false",
+			validation.AnnotationKeyProvisioningStart:     "2000-01-01T00:00:00Z",
+		}
+
+		By("creating the machine without a free server")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, annotations),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf(`server %q in namespace %q is still not bound`, machineName, ns.Name))))
+
+		By("ensuring that the ServerClaim carries the annotations and the recreate annotation of the driver")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.Annotations", SatisfyAll(
+			HaveKeyWithValue("example.org/cost-center", "42"),
+			HaveKeyWithValue("team", "metal"),
+			HaveKeyWithValue(validation.AnnotationKeyMCMMachineRecreate, "true"),
+			HaveKeyWithValue(validation.AnnotationKeyProvisioningStart, Not(Equal("2000-01-01T00:00:00Z"))),
+			Not(HaveKey("node.machine.sapcloud.io/not-managed-by-mcm")),
+			Not(HaveKey("machine.sapcloud.io/preserve")),
+		)))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine with zone-aware server selection", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ZoneLabelKey: "topology.kubernetes.io/zone",
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should select servers in the zone of the MachineClass", func(ctx SpecContext) {
+		machineIndex := 28
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring that the ServerClaim selects servers by the zone label")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("Spec.ServerSelector.MatchLabels", Equal(map[string]string{
+			"instance-type":               "bar",
+			"topology.kubernetes.io/zone": "az1",
+		})))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+
+	It("should reject a MachineClass without a zone", func(ctx SpecContext) {
+		machineClass := newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec)
+		machineClass.NodeTemplate.Zone = ""
+
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, 29, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Internal, "failed to get provider spec: failed to validate provider spec and secret: [nodeTemplate.zone: Required value: zone is required to select servers by the zone label]")))
+	})
+})
+
+var _ = Describe("CreateMachine with a custom field owner", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		FieldOwner: "mcm.ironcore.dev/field-owner-green",
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should apply the ServerClaim with the custom field owner", func(ctx SpecContext) {
+		machineIndex := 30
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring that the ServerClaim is owned by the custom field owner only")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.ManagedFields", SatisfyAll(
+			ContainElement(HaveField("Manager", "mcm.ironcore.dev/field-owner-green")),
+			Not(ContainElement(HaveField("Manager", DefaultFieldOwner))),
+		)))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("CreateMachine in dry-run mode", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		DryRun: true,
+	})
+	machineNamePrefix := "machine-create"
+
+	It("should return the provider ID without persisting the ServerClaim", func(ctx SpecContext) {
+		machineIndex := 32
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that no ServerClaim has been created")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Consistently(Get(serverClaim)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
+
+var _ = Describe("CreateMachine with an overridden metal namespace", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		AllowedMetalNamespaces: []string{"tenant-metal"},
+	})
+	machineNamePrefix := "machine-create"
+
+	// newTenantMachine returns a machine targeting the metal namespace with the metal namespace annotation
+	newTenantMachine := func(machineIndex int, metalNamespace string) *machinev1alpha1.Machine {
+		machine := newMachine(ns, machineNamePrefix, machineIndex, nil)
+		machine.Annotations = map[string]string{validation.AnnotationKeyMetalNamespace: metalNamespace}
+		return machine
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		By("creating the allowed metal namespace")
+		tenantNamespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "tenant-metal",
+			},
+		}
+		Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, tenantNamespace))).To(Succeed())
+	})
+
+	It("should create the ServerClaim in the allowed metal namespace", func(ctx SpecContext) {
+		machineIndex := 33
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newTenantMachine(machineIndex, "tenant-metal"),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://tenant-metal/%s", v1alpha1.ProviderName, machineName),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that the ServerClaim has been created in the allowed metal namespace only")
+		Eventually(Get(&metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "tenant-metal",
+				Name:      machineName,
+			},
+		})).Should(Succeed())
+		Expect(Get(&metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		})()).To(Satisfy(apierrors.IsNotFound))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newTenantMachine(machineIndex, "tenant-metal"),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+
+	It("should reject a metal namespace which is not allowed", func(ctx SpecContext) {
+		By("failing to create the machine")
+		_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newTenantMachine(34, "other-tenant"),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.InvalidArgument, `metal namespace "other-tenant" of the metal.ironcore.dev/metal-namespace annotation is not allowed`)))
+	})
+})
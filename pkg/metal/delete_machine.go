@@ -12,17 +12,24 @@ import (
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
+	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // DeleteMachine handles a machine deletion request and also deletes ignitionSecret associated with it
-func (d *metalDriver) DeleteMachine(ctx context.Context, req *driver.DeleteMachineRequest) (*driver.DeleteMachineResponse, error) {
+func (d *metalDriver) DeleteMachine(ctx context.Context, req *driver.DeleteMachineRequest) (_ *driver.DeleteMachineResponse, err error) {
+	var providerSpec *apiv1alpha1.ProviderSpec
+	defer func(start time.Time) {
+		// the node name policy of the provider spec overrides the one of the driver once the provider spec is parsed
+		d.observeOperation(OperationDelete, start, d.getNodeNamePolicy(providerSpec), err)
+	}(time.Now())
+
 	if isEmptyDeleteRequest(req) {
 		return nil, status.Error(codes.InvalidArgument, "received empty DeleteMachineRequest")
 	}
@@ -31,30 +38,90 @@ func (d *metalDriver) DeleteMachine(ctx context.Context, req *driver.DeleteMachi
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("requested provider %q is not supported by the driver %q", req.MachineClass.Provider, apiv1alpha1.ProviderName))
 	}
 
+	ctx, err = d.withMachineNamespace(ctx, req.Machine)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	klog.V(3).Infof("Machine deletion request has been received for %q", req.Machine.Name)
 	defer klog.V(3).Infof("Machine deletion request has been processed for %q", req.Machine.Name)
 
+	if !d.options.AdoptForeignServerClaims {
+		foreign, err := d.isForeignServerClaim(ctx, req.Machine.Name)
+		if err != nil {
+			// Unknown leads to short retry in machine controller
+			return nil, status.Error(codes.Unknown, fmt.Sprintf("failed to check existing ServerClaim: %v", err))
+		}
+		if foreign {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("ServerClaim %q in namespace %q is not managed by the driver and will not be deleted", req.Machine.Name, d.getMetalNamespace(ctx)))
+		}
+	}
+
+	// the provider spec is only required to compute a tenant prefixed ignition secret name
+	if d.options.IgnitionSecretNamePrefixLabel != "" {
+		var err error
+		providerSpec, err = GetProviderSpec(req.MachineClass, req.Secret, d.options)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get provider spec: %v", err))
+		}
+	}
+
 	ignitionSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      d.getIgnitionNameForMachine(ctx, req.Machine.Name),
-			Namespace: d.metalNamespace,
+			Name:      d.getIgnitionNameForMachine(ctx, req.Machine.Name, providerSpec),
+			Namespace: d.getMetalNamespace(ctx),
 		},
 	}
 
+	if d.options.DeleteDryRun || req.Machine.Annotations[validation.AnnotationKeyDeleteDryRun] == "true" {
+		if err := d.reportDeletion(ctx, req, ignitionSecret); err != nil {
+			// Unknown leads to short retry in machine controller
+			return nil, status.Error(codes.Unknown, fmt.Sprintf("error reporting dry-run deletion: %s", err.Error()))
+		}
+		return &driver.DeleteMachineResponse{}, nil
+	}
+
+	setServerClaimPending(client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}, false)
+
+	if err := d.recordDeletionReason(ctx, req); err != nil {
+		// Unknown leads to short retry in machine controller
+		return nil, status.Error(codes.Unknown, fmt.Sprintf("failed to get ServerClaim: %v", err))
+	}
+
 	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
 		return metalClient.Delete(ctx, ignitionSecret)
 	}); client.IgnoreNotFound(err) != nil {
+		return nil, status.Error(getDeleteErrorCode(err), fmt.Sprintf("error deleting ignition secret: %s", err.Error()))
+	}
+	d.legacyIgnitionNames.Delete(client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name})
+	d.expectedIgnitionHashes.Delete(client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name})
+
+	if err := d.deleteIPAddressClaims(ctx, req); err != nil {
 		// Unknown leads to short retry in machine controller
-		return nil, status.Error(codes.Unknown, fmt.Sprintf("error deleting ignition secret: %s", err.Error()))
+		return nil, status.Error(codes.Unknown, fmt.Sprintf("error deleting IPAddressClaims: %s", err.Error()))
+	}
+
+	if err := d.clearPendingIPAMPools(ctx, req); err != nil {
+		// Unknown leads to short retry in machine controller
+		return nil, status.Error(codes.Unknown, fmt.Sprintf("error clearing pending IPAM pools of ServerClaim: %s", err.Error()))
 	}
 
 	serverClaim := &metalv1alpha1.ServerClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      req.Machine.Name,
-			Namespace: d.metalNamespace,
+			Namespace: d.getMetalNamespace(ctx),
 		},
 	}
 
+	var serverName string
+	if d.options.ServerReleaseTimeout > 0 {
+		var err error
+		if serverName, err = d.getClaimedServerName(ctx, serverClaim); err != nil {
+			// Unknown leads to short retry in machine controller
+			return nil, status.Error(codes.Unknown, fmt.Sprintf("error getting the server of the ServerClaim: %s", err.Error()))
+		}
+	}
+
 	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
 		return metalClient.Delete(ctx, serverClaim)
 	}); err != nil {
@@ -62,13 +129,25 @@ func (d *metalDriver) DeleteMachine(ctx context.Context, req *driver.DeleteMachi
 			// Unknown leads to short retry in machine controller
 			return nil, status.Error(codes.Unknown, fmt.Sprintf("error deleting pod: %s", err.Error()))
 		}
-		return nil, status.Error(codes.NotFound, err.Error())
+		if err := d.awaitServerRelease(ctx, serverName); err != nil {
+			return nil, err
+		}
+		// the ServerClaim is already gone, e.g. on a retried deletion, so there is nothing to wait for
+		klog.V(3).Infof("ServerClaim %q in namespace %q is already deleted", serverClaim.Name, serverClaim.Namespace)
+		return &driver.DeleteMachineResponse{}, nil
+	}
+
+	release, ok := d.acquireDeleteSlot()
+	if !ok {
+		// MCM provider retry with codes.Unavailable will ensure a short retry in 5 seconds
+		return nil, status.Error(codes.Unavailable, fmt.Sprintf("maximum of %d concurrent ServerClaim deletions reached, the deletion of %q is queued", d.options.MaxConcurrentDeletes, serverClaim.Name))
 	}
+	defer release()
 
 	// Actively wait until the server claim is deleted since the extension contract in machine-controller-manager expects drivers to
 	// do so. If we would not wait until the server claim is gone it might happen that the kubelet could re-register the Node
 	// object even after it was already deleted by machine-controller-manager.
-	if err := wait.PollUntilContextTimeout(ctx, 5*time.Second, 10*time.Minute, true, func(ctx context.Context) (bool, error) {
+	if err := pollUntilContextTimeoutWithJitter(ctx, 5*time.Second, 10*time.Minute, func(ctx context.Context) (bool, error) {
 		if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
 			return metalClient.Get(ctx, client.ObjectKeyFromObject(serverClaim), serverClaim)
 		}); err != nil {
@@ -86,9 +165,208 @@ func (d *metalDriver) DeleteMachine(ctx context.Context, req *driver.DeleteMachi
 	}
 
 	klog.V(3).Infof("ServerClaim %q in namespace %q has been deleted", serverClaim.Name, serverClaim.Namespace)
+
+	if err := d.awaitServerRelease(ctx, serverName); err != nil {
+		return nil, err
+	}
+
 	return &driver.DeleteMachineResponse{}, nil
 }
 
+// acquireDeleteSlot reserves a slot for waiting on a ServerClaim deletion and returns the function releasing it.
+// It returns false without blocking if all slots are taken.
+func (d *metalDriver) acquireDeleteSlot() (func(), bool) {
+	if d.deleteSlots == nil {
+		return func() {}, true
+	}
+	select {
+	case d.deleteSlots <- struct{}{}:
+		return func() { <-d.deleteSlots }, true
+	default:
+		return nil, false
+	}
+}
+
+// reportDeletion logs the objects which would be deleted for the machine without deleting them
+func (d *metalDriver) reportDeletion(ctx context.Context, req *driver.DeleteMachineRequest, ignitionSecret *corev1.Secret) error {
+	var objects []string
+
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		serverClaim := &metalv1alpha1.ServerClaim{}
+		if err := metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}, serverClaim); client.IgnoreNotFound(err) != nil {
+			return err
+		} else if err == nil {
+			objects = append(objects, fmt.Sprintf("ServerClaim %s", client.ObjectKeyFromObject(serverClaim)))
+		}
+
+		if err := metalClient.Get(ctx, client.ObjectKeyFromObject(ignitionSecret), &corev1.Secret{}); client.IgnoreNotFound(err) != nil {
+			return err
+		} else if err == nil {
+			objects = append(objects, fmt.Sprintf("Secret %s", client.ObjectKeyFromObject(ignitionSecret)))
+		}
+
+		ipClaimList := &capiv1beta1.IPAddressClaimList{}
+		if err := metalClient.List(ctx, ipClaimList, client.InNamespace(d.getIPAddressClaimNamespace(ctx)), client.MatchingLabels{
+			validation.LabelKeyServerClaimName:      req.Machine.Name,
+			validation.LabelKeyServerClaimNamespace: d.getMetalNamespace(ctx),
+		}); err != nil {
+			return err
+		}
+		for _, ipClaim := range ipClaimList.Items {
+			objects = append(objects, fmt.Sprintf("IPAddressClaim %s", client.ObjectKeyFromObject(&ipClaim)))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	klog.Infof("Dry-run deletion of machine %q, the following objects would be deleted: %v", req.Machine.Name, objects)
+	return nil
+}
+
+// recordDeletionReason logs and counts whether the machine is deleted to be recreated or due to a scale-in. A machine is
+// recreated if its ServerClaim carries the recreate annotation. Retried deletions of an already deleting ServerClaim are
+// not recorded again.
+func (d *metalDriver) recordDeletionReason(ctx context.Context, req *driver.DeleteMachineRequest) error {
+	serverClaim := &metalv1alpha1.ServerClaim{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}, serverClaim)
+	}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if !serverClaim.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	reason := DeletionReasonScaleIn
+	if serverClaim.Annotations[validation.AnnotationKeyMCMMachineRecreate] == "true" {
+		reason = DeletionReasonRecreate
+	}
+
+	klog.InfoS("Deleting machine", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx), "reason", reason)
+	machineDeletions.WithLabelValues(reason).Inc()
+	return nil
+}
+
+// clearPendingIPAMPools removes the pending IPAM pools annotation from the ServerClaim, as the IPAddressClaims of the
+// machine have been deleted
+func (d *metalDriver) clearPendingIPAMPools(ctx context.Context, req *driver.DeleteMachineRequest) error {
+	serverClaim := &metalv1alpha1.ServerClaim{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}, serverClaim)
+	}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	return client.IgnoreNotFound(d.annotateServerClaimWithPendingIPAMPools(ctx, serverClaim, nil))
+}
+
+// deleteIPAddressClaims deletes the IPAddressClaims of the machine which have no owner reference, as IPAddressClaims in a
+// separate namespace or created before the ServerClaim are not garbage collected with the ServerClaim. IPAddressClaims
+// owned by the ServerClaim are only deleted if configured, e.g. if the garbage collection lags behind. IPAddressClaims
+// without the managed-by label are only deleted if they were applied by the field owner of the driver.
+func (d *metalDriver) deleteIPAddressClaims(ctx context.Context, req *driver.DeleteMachineRequest) error {
+	ipamNamespace := d.getIPAddressClaimNamespace(ctx)
+
+	return d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		ipClaimList := &capiv1beta1.IPAddressClaimList{}
+		if err := metalClient.List(ctx, ipClaimList, client.InNamespace(ipamNamespace), client.MatchingLabels{
+			validation.LabelKeyServerClaimName:      req.Machine.Name,
+			validation.LabelKeyServerClaimNamespace: d.getMetalNamespace(ctx),
+		}); err != nil {
+			return err
+		}
+
+		for _, ipClaim := range ipClaimList.Items {
+			if len(ipClaim.OwnerReferences) > 0 && !d.options.DeleteOwnedIPAddressClaims {
+				continue
+			}
+			if !d.isManagedObject(&ipClaim) {
+				klog.V(3).Infof("Skipping IPAddressClaim %q in namespace %q which is not managed by the driver", ipClaim.Name, ipClaim.Namespace)
+				continue
+			}
+			klog.V(3).Infof("Deleting IPAddressClaim %q in namespace %q", ipClaim.Name, ipClaim.Namespace)
+			if err := metalClient.Delete(ctx, &ipClaim); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// getDeleteErrorCode classifies a deletion error, a missing permission is permanent while transient errors are retried
+func getDeleteErrorCode(err error) codes.Code {
+	switch {
+	case apierrors.IsForbidden(err):
+		return codes.PermissionDenied
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err), apierrors.IsServiceUnavailable(err):
+		// Unavailable leads to short retry in machine controller
+		return codes.Unavailable
+	}
+	// Unknown leads to short retry in machine controller
+	return codes.Unknown
+}
+
+// getClaimedServerName returns the name of the server claimed by the ServerClaim. If the ServerClaim is already gone,
+// e.g. on a retry after the server release timed out, the server still referencing the ServerClaim is looked up.
+func (d *metalDriver) getClaimedServerName(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim) (string, error) {
+	var serverName string
+	err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		existing := &metalv1alpha1.ServerClaim{}
+		if err := metalClient.Get(ctx, client.ObjectKeyFromObject(serverClaim), existing); client.IgnoreNotFound(err) != nil {
+			return err
+		} else if err == nil {
+			if existing.Spec.ServerRef != nil {
+				serverName = existing.Spec.ServerRef.Name
+			}
+			return nil
+		}
+
+		serverList := &metalv1alpha1.ServerList{}
+		if err := metalClient.List(ctx, serverList); err != nil {
+			return err
+		}
+		for _, server := range serverList.Items {
+			if ref := server.Spec.ServerClaimRef; ref != nil && ref.Name == serverClaim.Name && ref.Namespace == serverClaim.Namespace {
+				serverName = server.Name
+				return nil
+			}
+		}
+		return nil
+	})
+	return serverName, err
+}
+
+// awaitServerRelease waits until the server is available and no longer claimed if the server release timeout is set,
+// so that the deletion of a machine is only reported once its physical server has been released
+func (d *metalDriver) awaitServerRelease(ctx context.Context, serverName string) error {
+	if d.options.ServerReleaseTimeout <= 0 || serverName == "" {
+		return nil
+	}
+
+	if err := pollUntilContextTimeoutWithJitter(ctx, time.Second, d.options.ServerReleaseTimeout, func(ctx context.Context) (bool, error) {
+		server := &metalv1alpha1.Server{}
+		if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+			return metalClient.Get(ctx, client.ObjectKey{Name: serverName}, server)
+		}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			// Unknown leads to short retry in machine controller
+			return false, status.Error(codes.Unknown, err.Error())
+		}
+		return server.Status.State == metalv1alpha1.ServerStateAvailable && server.Spec.ServerClaimRef == nil, nil
+	}); err != nil {
+		klog.V(3).Infof("Failed to wait for the release of server %q: %v", serverName, err)
+		// will be retried with short retry by machine controller
+		return status.Error(codes.DeadlineExceeded, fmt.Sprintf("server %q has not been released within %s: %v", serverName, d.options.ServerReleaseTimeout, err))
+	}
+
+	klog.V(3).Infof("Server %q has been released", serverName)
+	return nil
+}
+
 func isEmptyDeleteRequest(req *driver.DeleteMachineRequest) bool {
 	return req == nil || req.MachineClass == nil || req.Machine == nil || req.Secret == nil
 }
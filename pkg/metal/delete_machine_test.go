@@ -4,18 +4,34 @@
 package metal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/metal/testing"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
@@ -76,6 +92,15 @@ var _ = Describe("DeleteMachine", func() {
 
 		By("waiting for the ignition secret to be gone")
 		Eventually(Get(ignition)).Should(Satisfy(apierrors.IsNotFound))
+
+		By("ensuring that deleting the already deleted machine again returns without waiting")
+		start := time.Now()
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
 	})
 
 	It("should create and delete a machine ignition secret created with old naming convention", func(ctx SpecContext) {
@@ -134,3 +159,483 @@ var _ = Describe("DeleteMachine", func() {
 		Eventually(Get(ignition)).Should(Satisfy(apierrors.IsNotFound))
 	})
 })
+
+var _ = Describe("DeleteMachine with a foreign ServerClaim", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-delete"
+
+	It("should not delete a ServerClaim which is not managed by the driver", func(ctx SpecContext) {
+		machineIndex := 5
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a ServerClaim which is not managed by the driver")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+			Spec: metalv1alpha1.ServerClaimSpec{
+				Power: metalv1alpha1.PowerOn,
+				Image: "foreign-image",
+			},
+		}
+		Expect(k8sClient.Create(ctx, serverClaim)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, serverClaim)
+
+		By("failing to delete the machine")
+		deleteMachineResponse, err := (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.FailedPrecondition, fmt.Sprintf(`ServerClaim %q in namespace %q is not managed by the driver and will not be deleted`, machineName, ns.Name))))
+		Expect(deleteMachineResponse).To(BeNil())
+
+		By("ensuring that the ServerClaim still exists")
+		Consistently(Get(serverClaim)).Should(Succeed())
+	})
+})
+
+var _ = Describe("DeleteMachine dry-run", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-delete"
+
+	It("should report the objects to delete without deleting them", func(ctx SpecContext) {
+		machineIndex := 6
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		dryRunAnnotations := map[string]string{
+			validation.AnnotationKeyDeleteDryRun: "true",
+		}
+
+		By("creating an metal machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("creating an ignition secret")
+		ignition := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Expect(k8sClient.Create(ctx, ignition)).To(Succeed())
+
+		By("redirecting the log output")
+		buf := &bytes.Buffer{}
+		klog.LogToStderr(false)
+		klog.SetOutput(buf)
+		DeferCleanup(func() {
+			klog.SetOutput(os.Stderr)
+			klog.LogToStderr(true)
+		})
+
+		By("deleting the machine in dry-run mode")
+		machine := newMachine(ns, machineNamePrefix, machineIndex, nil)
+		machine.Annotations = dryRunAnnotations
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      machine,
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+		klog.Flush()
+
+		By("ensuring that the objects to delete have been reported")
+		Expect(buf.String()).To(ContainSubstring(fmt.Sprintf(`Dry-run deletion of machine %q, the following objects would be deleted: [ServerClaim %s/%s Secret %s/%s]`,
+			machineName, ns.Name, machineName, ns.Name, machineName)))
+
+		By("ensuring that the objects still exist")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Consistently(Object(serverClaim)).Should(HaveField("ObjectMeta.DeletionTimestamp", BeNil()))
+		Consistently(Object(ignition)).Should(HaveField("ObjectMeta.DeletionTimestamp", BeNil()))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("DeleteMachine deletion reason", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-delete"
+
+	DescribeTable("should record the reason of the deletion",
+		func(ctx SpecContext, machineIndex int, recreate bool, reason string) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+			By("creating an metal machine")
+			Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).NotTo(BeNil())
+
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			if recreate {
+				By("annotating the ServerClaim for recreation")
+				Eventually(Update(serverClaim, func() {
+					serverClaim.Annotations = map[string]string{validation.AnnotationKeyMCMMachineRecreate: "true"}
+				})).Should(Succeed())
+			}
+
+			By("redirecting the log output")
+			buf := &bytes.Buffer{}
+			klog.LogToStderr(false)
+			klog.SetOutput(buf)
+			DeferCleanup(func() {
+				klog.SetOutput(os.Stderr)
+				klog.LogToStderr(true)
+			})
+
+			By("deleting the machine")
+			deletions := promtestutil.ToFloat64(machineDeletions.WithLabelValues(reason))
+			Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).To(Equal(&driver.DeleteMachineResponse{}))
+			klog.Flush()
+			Eventually(Get(serverClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+			By("ensuring that the deletion reason has been logged and counted")
+			Expect(buf.String()).To(ContainSubstring(fmt.Sprintf(`"Deleting machine" name=%q namespace=%q reason=%q`, machineName, ns.Name, reason)))
+			Expect(promtestutil.ToFloat64(machineDeletions.WithLabelValues(reason))).To(Equal(deletions + 1))
+		},
+		Entry("recreate if the ServerClaim is annotated for recreation", 7, true, DeletionReasonRecreate),
+		Entry("scale-in if the ServerClaim is not annotated for recreation", 8, false, DeletionReasonScaleIn),
+	)
+})
+
+var _ = Describe("DeleteMachine with server release confirmation", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ServerReleaseTimeout: 2 * time.Second,
+	})
+	machineNamePrefix := "machine-delete"
+
+	claimServer := func(ctx SpecContext, machineIndex int) *metalv1alpha1.Server {
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a server claimed by the machine")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("release-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: fmt.Sprintf("release-%d", machineIndex),
+				ServerClaimRef: &corev1.ObjectReference{
+					Name:      machineName,
+					Namespace: ns.Name,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+		Eventually(UpdateStatus(server, func() {
+			server.Status.State = metalv1alpha1.ServerStateReserved
+		})).Should(Succeed())
+
+		By("creating an metal machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("binding the ServerClaim to the server")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+		return server
+	}
+
+	It("should succeed once the server becomes available", func(ctx SpecContext) {
+		machineIndex := 9
+		server := claimServer(ctx, machineIndex)
+
+		By("starting a non-blocking goroutine to release the server")
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(500 * time.Millisecond)
+			Eventually(Update(server, func() {
+				server.Spec.ServerClaimRef = nil
+			})).Should(Succeed())
+			Eventually(UpdateStatus(server, func() {
+				server.Status.State = metalv1alpha1.ServerStateAvailable
+			})).Should(Succeed())
+		}()
+
+		By("ensuring that the machine is deleted once the server is released")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+	})
+
+	It("should fail if the server is not released within the timeout", func(ctx SpecContext) {
+		machineIndex := 10
+		server := claimServer(ctx, machineIndex)
+
+		By("failing to delete the machine while the server stays reserved")
+		deleteMachineResponse, err := (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`code = [DeadlineExceeded] message = [server %q has not been released within 2s`, server.Name))))
+		Expect(deleteMachineResponse).To(BeNil())
+
+		By("failing on retry while the ServerClaim is gone and the server stays reserved")
+		_, err = (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(ContainSubstring("code = [DeadlineExceeded]")))
+	})
+})
+
+var _ = Describe("DeleteMachine with a failing ignition secret deletion", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-delete"
+
+	DescribeTable("should classify the error of the ignition secret deletion",
+		func(ctx SpecContext, deleteErr error, expectedCode codes.Code) {
+			By("creating a driver with a client failing the ignition secret deletion")
+			watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+			Expect(err).NotTo(HaveOccurred())
+			failingClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+				Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+					if _, ok := obj.(*corev1.Secret); ok {
+						return deleteErr
+					}
+					return c.Delete(ctx, obj, opts...)
+				},
+			})
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(failingClient)
+			drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerClaimName, Options{})
+
+			By("deleting the machine")
+			_, err = drv.DeleteMachine(ctx, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, 11, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).To(MatchError(status.Error(expectedCode, fmt.Sprintf("error deleting ignition secret: %s", deleteErr.Error()))))
+		},
+		Entry("forbidden delete is permanent",
+			apierrors.NewForbidden(corev1.Resource("secrets"), "machine-delete-11", errors.New("missing permission")), codes.PermissionDenied),
+		Entry("transient error is retried",
+			apierrors.NewServiceUnavailable("apiserver is shutting down"), codes.Unavailable),
+		Entry("other errors are retried",
+			errors.New("connection reset"), codes.Unknown),
+	)
+})
+
+var _ = Describe("DeleteMachine with owned IPAddressClaims", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{DeleteOwnedIPAddressClaims: true})
+	machineNamePrefix := "machine-delete"
+
+	It("should delete the IPAddressClaims owned by the ServerClaim", func(ctx SpecContext) {
+		machineIndex := 12
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Get(serverClaim)).Should(Succeed())
+
+		By("creating an IPAddressClaim owned by the ServerClaim")
+		ipClaim := &capiv1beta1.IPAddressClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      getIPAddressClaimName(machineName, "pool-owned"),
+				Labels: map[string]string{
+					validation.LabelKeyServerClaimName:      machineName,
+					validation.LabelKeyServerClaimNamespace: ns.Name,
+					validation.LabelKeyManagedBy:            ManagedByLabelValue,
+				},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: metalv1alpha1.GroupVersion.String(),
+					Kind:       "ServerClaim",
+					Name:       serverClaim.Name,
+					UID:        serverClaim.UID,
+				}},
+			},
+			Spec: capiv1beta1.IPAddressClaimSpec{
+				PoolRef: corev1.TypedLocalObjectReference{
+					APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+					Kind:     "GlobalInClusterIPPool",
+					Name:     "pool-owned",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+
+		By("deleting the machine")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+
+		By("ensuring that the owned IPAddressClaim has been deleted")
+		Eventually(Get(ipClaim)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
+
+var _ = Describe("DeleteMachine with IPAddressClaims without managed-by label", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-delete"
+
+	It("should delete the IPAddressClaims applied by the driver and keep foreign ones", func(ctx SpecContext) {
+		machineIndex := 15
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		newIPAddressClaim := func(pool string) *capiv1beta1.IPAddressClaim {
+			return &capiv1beta1.IPAddressClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      getIPAddressClaimName(machineName, pool),
+					Labels: map[string]string{
+						validation.LabelKeyServerClaimName:      machineName,
+						validation.LabelKeyServerClaimNamespace: ns.Name,
+					},
+				},
+				Spec: capiv1beta1.IPAddressClaimSpec{
+					PoolRef: corev1.TypedLocalObjectReference{
+						APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+						Kind:     "GlobalInClusterIPPool",
+						Name:     pool,
+					},
+				},
+			}
+		}
+
+		By("creating an IPAddressClaim of a previous driver version without managed-by label")
+		legacyIPClaim := newIPAddressClaim("pool-legacy")
+		Expect(k8sClient.Create(ctx, legacyIPClaim, client.FieldOwner(DefaultFieldOwner))).To(Succeed())
+
+		By("creating a foreign IPAddressClaim with the labels of the ServerClaim")
+		foreignIPClaim := newIPAddressClaim("pool-foreign")
+		Expect(k8sClient.Create(ctx, foreignIPClaim, client.FieldOwner("foreign-owner"))).To(Succeed())
+		DeferCleanup(k8sClient.Delete, foreignIPClaim)
+
+		By("deleting the machine")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+
+		By("ensuring that the IPAddressClaim of the previous driver version has been deleted")
+		Eventually(Get(legacyIPClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+		By("ensuring that the foreign IPAddressClaim still exists")
+		Consistently(Get(foreignIPClaim)).Should(Succeed())
+	})
+})
+
+var _ = Describe("DeleteMachine with a maximum of concurrent deletions", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{MaxConcurrentDeletes: 1})
+	machineNamePrefix := "machine-delete"
+
+	It("should queue deletions exceeding the maximum", func(ctx SpecContext) {
+		blockedIndex, queuedIndex := 13, 14
+
+		By("creating the machines")
+		for _, machineIndex := range []int{blockedIndex, queuedIndex} {
+			Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).NotTo(BeNil())
+		}
+
+		By("blocking the deletion of the first ServerClaim with a finalizer")
+		blockedServerClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      fmt.Sprintf("%s-%d", machineNamePrefix, blockedIndex),
+			},
+		}
+		Eventually(Update(blockedServerClaim, func() {
+			blockedServerClaim.Finalizers = []string{"test.ironcore.dev/block"}
+		})).Should(Succeed())
+
+		By("starting a non-blocking goroutine deleting the first machine")
+		deleteErr := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, blockedIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			deleteErr <- err
+		}()
+		Eventually(func() int {
+			return len((*drv).(*metalDriver).deleteSlots)
+		}).Should(Equal(1))
+
+		By("ensuring that the deletion of the second machine is queued")
+		_, err := (*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, queuedIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(ContainSubstring("code = [Unavailable] message = [maximum of 1 concurrent ServerClaim deletions reached")))
+
+		By("releasing the first ServerClaim")
+		Eventually(Update(blockedServerClaim, func() {
+			blockedServerClaim.Finalizers = nil
+		})).Should(Succeed())
+		Eventually(deleteErr).Should(Receive(BeNil()))
+
+		By("ensuring that the queued deletion succeeds on retry")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, queuedIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+	})
+})
@@ -8,6 +8,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
@@ -33,17 +37,26 @@ const (
 	defaultIgnitionKey     = "ignition"
 	ShootNameLabelKey      = "shoot-name"
 	ShootNamespaceLabelKey = "shoot-namespace"
-)
-
-var (
-	fieldOwner = client.FieldOwner("mcm.ironcore.dev/field-owner")
+	// ManagedByLabelValue is the default value of the managed-by label set on objects created by the driver
+	ManagedByLabelValue = "machine-controller-manager-provider-ironcore-metal"
+	// DefaultFieldOwner is the default field owner of the objects applied by the driver
+	DefaultFieldOwner = "mcm.ironcore.dev/field-owner"
 )
 
 type metalDriver struct {
 	Schema         *runtime.Scheme
-	clientProvider *mcmclient.Provider
+	clientProvider mcmclient.ClientProvider
 	metalNamespace string
 	nodeNamePolicy cmd.NodeNamePolicy
+	options        Options
+	// ipamAvailable caches that the CAPI IPAM CRDs have been found in the metal cluster
+	ipamAvailable atomic.Bool
+	// legacyIgnitionNames caches per namespaced machine name whether its ignition secret uses the legacy naming convention
+	legacyIgnitionNames sync.Map
+	// expectedIgnitionHashes caches per namespaced machine name the hash of the ignition rendered for the drift detection
+	expectedIgnitionHashes sync.Map
+	// deleteSlots limits the concurrent waits for ServerClaim deletions, it is nil if they are not limited
+	deleteSlots chan struct{}
 }
 
 func (d *metalDriver) GetVolumeIDs(_ context.Context, _ *driver.GetVolumeIDsRequest) (*driver.GetVolumeIDsResponse, error) {
@@ -51,34 +64,111 @@ func (d *metalDriver) GetVolumeIDs(_ context.Context, _ *driver.GetVolumeIDsRequ
 }
 
 // NewDriver returns a new Gardener metal driver object
-func NewDriver(clientProvider *mcmclient.Provider, namespace string, nodeNamePolicy cmd.NodeNamePolicy) driver.Driver {
-	return &metalDriver{
+func NewDriver(clientProvider mcmclient.ClientProvider, namespace string, nodeNamePolicy cmd.NodeNamePolicy, options Options) driver.Driver {
+	d := &metalDriver{
 		clientProvider: clientProvider,
 		metalNamespace: namespace,
 		nodeNamePolicy: nodeNamePolicy,
+		options:        options,
+	}
+	if options.MaxConcurrentDeletes > 0 {
+		d.deleteSlots = make(chan struct{}, options.MaxConcurrentDeletes)
 	}
+	d.exposeConfig()
+	return d
 }
 
 func (d *metalDriver) GenerateMachineClassForMigration(_ context.Context, _ *driver.GenerateMachineClassForMigrationRequest) (*driver.GenerateMachineClassForMigrationResponse, error) {
 	return &driver.GenerateMachineClassForMigrationResponse{}, nil
 }
 
-func (d *metalDriver) getIgnitionNameForMachine(ctx context.Context, machineName string) string {
+func (d *metalDriver) getIgnitionNameForMachine(ctx context.Context, machineName string, providerSpec *apiv1alpha1.ProviderSpec) string {
 	//for backward compatibility checking if the ignition secret was already present with the old naming convention
 	ignitionSecretName := fmt.Sprintf("%s-%s", machineName, "ignition")
-	if err := d.clientProvider.SyncClient(func(k8s client.Client) error {
-		return k8s.Get(ctx, client.ObjectKey{Name: ignitionSecretName, Namespace: d.metalNamespace}, &corev1.Secret{})
-	}); apierrors.IsNotFound(err) {
-		return machineName
+	// machines of the same name may target different metal namespaces
+	cacheKey := client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: machineName}
+	legacy, ok := d.legacyIgnitionNames.Load(cacheKey)
+	if !ok {
+		err := d.clientProvider.SyncClient(func(k8s client.Client) error {
+			return k8s.Get(ctx, client.ObjectKey{Name: ignitionSecretName, Namespace: d.getMetalNamespace(ctx)}, &corev1.Secret{})
+		})
+		legacy = !apierrors.IsNotFound(err)
+		// only a definite result is cached, other errors are looked up again on the next call
+		if err == nil || apierrors.IsNotFound(err) {
+			d.legacyIgnitionNames.Store(cacheKey, legacy)
+		}
+	}
+	if !legacy.(bool) {
+		return d.getIgnitionNamePrefix(providerSpec) + machineName
 	}
 	return ignitionSecretName
 }
 
+// getFieldOwner returns the field owner of the objects applied by the driver
+func (d *metalDriver) getFieldOwner() client.FieldOwner {
+	if d.options.FieldOwner != "" {
+		return client.FieldOwner(d.options.FieldOwner)
+	}
+	return DefaultFieldOwner
+}
+
+// getManagedByLabelValue returns the value of the managed-by label set on objects created by the driver
+func (d *metalDriver) getManagedByLabelValue() string {
+	if d.options.ManagedBy != "" {
+		return d.options.ManagedBy
+	}
+	return ManagedByLabelValue
+}
+
+// getIPAddressClaimNamespace returns the namespace of the IPAddressClaims, which defaults to the metal namespace
+func (d *metalDriver) getIPAddressClaimNamespace(ctx context.Context) string {
+	if d.options.IPAddressClaimNamespace != "" {
+		return d.options.IPAddressClaimNamespace
+	}
+	return d.getMetalNamespace(ctx)
+}
+
+// metalNamespaceKey is the context key of the metal namespace a machine overrides with the metal namespace annotation
+type metalNamespaceKey struct{}
+
+// withMachineNamespace returns a context carrying the metal namespace the machine overrides with the metal namespace
+// annotation. The namespace has to be one of the allowed metal namespaces.
+func (d *metalDriver) withMachineNamespace(ctx context.Context, machine *machinev1alpha1.Machine) (context.Context, error) {
+	namespace, ok := machine.Annotations[validation.AnnotationKeyMetalNamespace]
+	if !ok || namespace == d.metalNamespace {
+		return ctx, nil
+	}
+	if !slices.Contains(d.options.AllowedMetalNamespaces, namespace) {
+		return nil, fmt.Errorf("metal namespace %q of the %s annotation is not allowed", namespace, validation.AnnotationKeyMetalNamespace)
+	}
+	return context.WithValue(ctx, metalNamespaceKey{}, namespace), nil
+}
+
+// getMetalNamespace returns the metal namespace of the machine of the request, which defaults to the metal namespace
+// of the driver
+func (d *metalDriver) getMetalNamespace(ctx context.Context) string {
+	if namespace, ok := ctx.Value(metalNamespaceKey{}).(string); ok {
+		return namespace
+	}
+	return d.metalNamespace
+}
+
+// getIgnitionNamePrefix returns the tenant prefix of the ignition secret name derived from the provider spec labels
+func (d *metalDriver) getIgnitionNamePrefix(providerSpec *apiv1alpha1.ProviderSpec) string {
+	if d.options.IgnitionSecretNamePrefixLabel == "" || providerSpec == nil {
+		return ""
+	}
+	if tenant := providerSpec.Labels[d.options.IgnitionSecretNamePrefixLabel]; tenant != "" {
+		return tenant + "-"
+	}
+	return ""
+}
+
 func getProviderIDForServerClaim(serverClaim *metalv1alpha1.ServerClaim) string {
 	return fmt.Sprintf("%s://%s/%s", apiv1alpha1.ProviderName, serverClaim.Namespace, serverClaim.Name)
 }
 
-func getNodeName(ctx context.Context, policy cmd.NodeNamePolicy, serverClaim *metalv1alpha1.ServerClaim, metalNamespace string, clientProvider *mcmclient.Provider) (string, error) {
+func getNodeName(ctx context.Context, policy cmd.NodeNamePolicy, serverClaim *metalv1alpha1.ServerClaim, metalNamespace, nodeNameLabelKey string, clientProvider mcmclient.ClientProvider) (string, error) {
 	switch policy {
 	case cmd.NodeNamePolicyServerClaimName:
 		return serverClaim.Name, nil
@@ -101,20 +191,99 @@ func getNodeName(ctx context.Context, policy cmd.NodeNamePolicy, serverClaim *me
 			return "", fmt.Errorf("server %q does not have a BMC configured", serverClaim.Spec.ServerRef.Name)
 		}
 		return server.Spec.BMCRef.Name, nil
+	case cmd.NodeNamePolicyServerLabel:
+		if nodeNameLabelKey == "" {
+			return "", fmt.Errorf("node name policy %s requires a node name label key", policy)
+		}
+		if serverClaim.Spec.ServerRef == nil {
+			return "", errors.New("server claim does not have a server ref")
+		}
+		var server metalv1alpha1.Server
+		if err := clientProvider.SyncClient(func(metalClient client.Client) error {
+			return metalClient.Get(ctx, client.ObjectKey{Name: serverClaim.Spec.ServerRef.Name}, &server)
+		}); err != nil {
+			return "", fmt.Errorf("failed to get server %q: %v", serverClaim.Spec.ServerRef.Name, err)
+		}
+		nodeName := server.Labels[nodeNameLabelKey]
+		if nodeName == "" {
+			return "", fmt.Errorf("server %q does not have the node name label %q", serverClaim.Spec.ServerRef.Name, nodeNameLabelKey)
+		}
+		return nodeName, nil
 	}
 	return "", fmt.Errorf("unknown node name policy: %s", policy)
 }
 
+// getNodeNamePolicy returns the node name policy of the provider spec, which overrides the node name policy of the driver
+func (d *metalDriver) getNodeNamePolicy(providerSpec *apiv1alpha1.ProviderSpec) cmd.NodeNamePolicy {
+	if providerSpec != nil && providerSpec.NodeNamePolicy != "" {
+		return providerSpec.NodeNamePolicy
+	}
+	return d.nodeNamePolicy
+}
+
+// resolveNodeName returns the node name of the ServerClaim according to the node name policy. If the node name can not be
+// resolved and the node name fallback is enabled, the name of the ServerClaim is used instead.
+func (d *metalDriver) resolveNodeName(ctx context.Context, policy cmd.NodeNamePolicy, serverClaim *metalv1alpha1.ServerClaim) (string, error) {
+	nodeName, err := getNodeName(ctx, policy, serverClaim, d.getMetalNamespace(ctx), d.options.NodeNameLabelKey, d.clientProvider)
+	if err != nil && d.options.NodeNameFallback {
+		klog.Warningf("Failed to resolve the node name of ServerClaim %s with policy %s, falling back to the ServerClaim name: %v", client.ObjectKeyFromObject(serverClaim), policy, err)
+		return serverClaim.Name, nil
+	}
+	return nodeName, err
+}
+
+// getHostname returns the hostname of the first source in the priority order providing a non-empty value
+func getHostname(sources []apiv1alpha1.HostnameSource, candidates map[apiv1alpha1.HostnameSource]string) (string, error) {
+	if len(sources) == 0 {
+		sources = apiv1alpha1.DefaultHostnameSources
+	}
+	for _, source := range sources {
+		if hostname := candidates[source]; hostname != "" {
+			return hostname, nil
+		}
+	}
+	return "", fmt.Errorf("none of the hostname sources %v provided a hostname", sources)
+}
+
+// qualifyHostname appends the shoot name and the shoot hostname domain to the hostname if the shoot hostname domain is
+// configured and the provider spec carries a shoot name label, e.g. <node>.<shoot-name>.internal
+func (d *metalDriver) qualifyHostname(hostname string, providerSpec *apiv1alpha1.ProviderSpec) (string, error) {
+	if d.options.ShootHostnameDomain == "" || providerSpec == nil {
+		return hostname, nil
+	}
+	shootName := providerSpec.Labels[ShootNameLabelKey]
+	if shootName == "" {
+		return hostname, nil
+	}
+
+	fqdn := strings.Join([]string{hostname, shootName, d.options.ShootHostnameDomain}, ".")
+	if msgs := validateFQDN(fqdn); len(msgs) > 0 {
+		return "", fmt.Errorf("invalid FQDN %q derived from shoot %q: %s", fqdn, shootName, strings.Join(msgs, ", "))
+	}
+	return fqdn, nil
+}
+
+// validateFQDN validates that the FQDN is a DNS subdomain consisting of valid DNS labels
+func validateFQDN(fqdn string) []string {
+	msgs := utilvalidation.IsDNS1123Subdomain(fqdn)
+	for _, label := range strings.Split(fqdn, ".") {
+		for _, msg := range utilvalidation.IsDNS1123Label(label) {
+			msgs = append(msgs, fmt.Sprintf("label %q: %s", label, msg))
+		}
+	}
+	return msgs
+}
+
 func getIPAddressClaimName(machineName, metadataKey string) string {
 	ipAddrClaimName := fmt.Sprintf("%s-%s", machineName, metadataKey)
 	if len(ipAddrClaimName) > utilvalidation.DNS1123SubdomainMaxLength {
-		klog.Info("IPAddressClaim name is too long, it will be shortened which can cause name collisions", "name", ipAddrClaimName)
+		klog.InfoS("IPAddressClaim name is too long, it will be shortened which can cause name collisions", "name", ipAddrClaimName)
 		ipAddrClaimName = ipAddrClaimName[:utilvalidation.DNS1123SubdomainMaxLength]
 	}
 	return ipAddrClaimName
 }
 
-func GetProviderSpec(machineClass *machinev1alpha1.MachineClass, secret *corev1.Secret) (*apiv1alpha1.ProviderSpec, error) {
+func GetProviderSpec(machineClass *machinev1alpha1.MachineClass, secret *corev1.Secret, options Options) (*apiv1alpha1.ProviderSpec, error) {
 	if machineClass == nil {
 		return nil, errors.New("MachineClass is not set in request")
 	}
@@ -124,10 +293,60 @@ func GetProviderSpec(machineClass *machinev1alpha1.MachineClass, secret *corev1.
 		return nil, err
 	}
 
-	validationErr := validation.ValidateProviderSpecAndSecret(providerSpec, secret, field.NewPath("providerSpec"))
+	if options.ImageFallback && providerSpec.Image == "" {
+		providerSpec.Image = getFallbackImage(machineClass, secret)
+	}
+
+	validationErr := validation.ValidateProviderSpecAndSecret(providerSpec, secret, field.NewPath("providerSpec"), validation.Options{
+		AllowDiskless:       options.AllowDiskless,
+		AllowedMetadataKeys: options.AllowedMetadataKeys,
+		DeniedMetadataKeys:  options.DeniedMetadataKeys,
+		NodeNameLabelKey:    options.NodeNameLabelKey,
+	})
+	validationErr = append(validationErr, validation.ValidateSecretForMachineClass(secret, machineClass.Name, field.NewPath("secret"))...)
+	if options.VerifySecretNamespace {
+		validationErr = append(validationErr, validation.ValidateSecretNamespace(secret, machineClass.Namespace, options.AllowedSecretNamespaces, field.NewPath("secret"))...)
+	}
+	if options.ZoneLabelKey != "" && getZone(machineClass) == "" {
+		validationErr = append(validationErr, field.Required(field.NewPath("nodeTemplate", "zone"), "zone is required to select servers by the zone label"))
+	}
+	for _, finding := range validation.ValidateProviderSpecFindings(providerSpec, field.NewPath("spec")) {
+		if options.ValidationMode == cmd.ValidationModeStrict {
+			validationErr = append(validationErr, finding)
+			continue
+		}
+		klog.Warningf("Provider spec of MachineClass %q: %v", machineClass.Name, finding)
+	}
 	if validationErr.ToAggregate() != nil && len(validationErr.ToAggregate().Errors()) > 0 {
 		return nil, fmt.Errorf("failed to validate provider spec and secret: %v", validationErr.ToAggregate().Errors())
 	}
 
+	// the zone of the MachineClass extends the server labels, so every selector of the machine is zone-aware
+	if options.ZoneLabelKey != "" {
+		if providerSpec.ServerLabels == nil {
+			providerSpec.ServerLabels = make(map[string]string, 1)
+		}
+		providerSpec.ServerLabels[options.ZoneLabelKey] = getZone(machineClass)
+	}
+
 	return providerSpec, nil
 }
+
+// getZone returns the zone of the node template of the MachineClass
+func getZone(machineClass *machinev1alpha1.MachineClass) string {
+	if machineClass.NodeTemplate == nil {
+		return ""
+	}
+	return machineClass.NodeTemplate.Zone
+}
+
+// getFallbackImage returns the image provided out-of-band by the MachineClass annotation or the provider secret
+func getFallbackImage(machineClass *machinev1alpha1.MachineClass, secret *corev1.Secret) string {
+	if image := machineClass.Annotations[validation.AnnotationKeyImage]; image != "" {
+		return image
+	}
+	if secret != nil {
+		return string(secret.Data[validation.SecretKeyImage])
+	}
+	return ""
+}
@@ -0,0 +1,319 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	machinev1alpha1 "github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/metal/testing"
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	jsonlog "k8s.io/component-base/logs/json"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+)
+
+var _ = Describe("Structured logging", func() {
+	It("should serialize the key/value pairs of a log line as JSON", func() {
+		By("switching klog to the JSON logger")
+		buf := &bytes.Buffer{}
+		logger, _ := jsonlog.NewJSONLogger(0, jsonlog.AddNopSync(buf), nil, nil)
+		klog.SetLogger(logger)
+		DeferCleanup(klog.ClearLogger)
+
+		By("logging a too long IPAddressClaim name")
+		name := getIPAddressClaimName(strings.Repeat("a", 250), "pool")
+		klog.Flush()
+
+		By("ensuring that the log line is valid JSON with the expected fields")
+		line := map[string]any{}
+		Expect(json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &line)).To(Succeed())
+		Expect(line).To(HaveKeyWithValue("msg", "IPAddressClaim name is too long, it will be shortened which can cause name collisions"))
+		Expect(line).To(HaveKeyWithValue("name", strings.Repeat("a", 250)+"-pool"))
+		Expect(line).To(HaveKey("ts"))
+		Expect(line).To(HaveKey("caller"))
+		Expect(name).To(HaveLen(253))
+	})
+})
+
+var _ = Describe("GetProviderSpec with validation mode", func() {
+	newSuspiciousMachineClass := func() *machinev1alpha1.MachineClass {
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		delete(providerSpec, "serverLabels")
+		return newMachineClass(v1alpha1.ProviderName, providerSpec)
+	}
+	secret := &corev1.Secret{Data: map[string][]byte{"userData": []byte("abcd")}}
+
+	It("should fail on non-critical findings in strict mode", func() {
+		_, err := GetProviderSpec(newSuspiciousMachineClass(), secret, Options{ValidationMode: cmd.ValidationModeStrict})
+		Expect(err).To(MatchError("failed to validate provider spec and secret: [spec.serverLabels: Required value: an empty server selector matches any free server]"))
+	})
+
+	It("should keep critical findings as errors in strict mode", func() {
+		machineClass := newSuspiciousMachineClass()
+		_, err := GetProviderSpec(machineClass, &corev1.Secret{}, Options{ValidationMode: cmd.ValidationModeStrict})
+		Expect(err).To(MatchError(ContainSubstring("userData: Required value: userData is required")))
+	})
+
+	It("should log non-critical findings as warnings in lenient mode", func() {
+		By("redirecting the log output")
+		buf := &bytes.Buffer{}
+		klog.LogToStderr(false)
+		klog.SetOutput(buf)
+		DeferCleanup(func() {
+			klog.SetOutput(os.Stderr)
+			klog.LogToStderr(true)
+		})
+
+		spec, err := GetProviderSpec(newSuspiciousMachineClass(), secret, Options{ValidationMode: cmd.ValidationModeLenient})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec).NotTo(BeNil())
+		klog.Flush()
+		Expect(buf.String()).To(ContainSubstring("spec.serverLabels: Required value: an empty server selector matches any free server"))
+	})
+
+	It("should keep critical findings as errors in lenient mode", func() {
+		_, err := GetProviderSpec(newSuspiciousMachineClass(), &corev1.Secret{}, Options{ValidationMode: cmd.ValidationModeLenient})
+		Expect(err).To(MatchError("failed to validate provider spec and secret: [userData: Required value: userData is required]"))
+	})
+})
+
+var _ = Describe("resolveNodeName", func() {
+	serverClaim := &metalv1alpha1.ServerClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "machine-node-name",
+			Namespace: "default",
+		},
+		Spec: metalv1alpha1.ServerClaimSpec{
+			ServerRef: &corev1.LocalObjectReference{Name: "missing-server"},
+		},
+	}
+	newDriver := func(fallback bool) *metalDriver {
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(k8sClient)
+		return &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: "default",
+			nodeNamePolicy: cmd.NodeNamePolicyBMCName,
+			options:        Options{NodeNameFallback: fallback},
+		}
+	}
+
+	It("should fail if the server is missing and the fallback is disabled", func(ctx SpecContext) {
+		_, err := newDriver(false).resolveNodeName(ctx, cmd.NodeNamePolicyBMCName, serverClaim)
+		Expect(err).To(MatchError(ContainSubstring(`failed to get server "missing-server"`)))
+	})
+
+	It("should fall back to the ServerClaim name if the server is missing", func(ctx SpecContext) {
+		Expect(newDriver(true).resolveNodeName(ctx, cmd.NodeNamePolicyBMCName, serverClaim)).To(Equal("machine-node-name"))
+	})
+})
+
+var _ = Describe("getNodeName with the ServerLabel policy", func() {
+	clientProvider := &mcmclient.Provider{}
+	newServerClaim := func(serverName string) *metalv1alpha1.ServerClaim {
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "machine-node-label",
+				Namespace: "default",
+			},
+		}
+		if serverName != "" {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: serverName}
+		}
+		return serverClaim
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		clientProvider.SetClient(k8sClient)
+
+		By("creating a labeled and an unlabeled server")
+		for name, labels := range map[string]map[string]string{
+			"labeled-server":   {"asset-id": "asset-4711"},
+			"unlabeled-server": nil,
+		} {
+			server := &metalv1alpha1.Server{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: labels,
+				},
+				Spec: metalv1alpha1.ServerSpec{
+					SystemUUID: name,
+				},
+			}
+			Expect(k8sClient.Create(ctx, server)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, server)
+		}
+	})
+
+	It("should use the label value of the bound server", func(ctx SpecContext) {
+		Expect(getNodeName(ctx, cmd.NodeNamePolicyServerLabel, newServerClaim("labeled-server"), "default", "asset-id", clientProvider)).To(Equal("asset-4711"))
+	})
+
+	It("should fail if the server does not have the label", func(ctx SpecContext) {
+		_, err := getNodeName(ctx, cmd.NodeNamePolicyServerLabel, newServerClaim("unlabeled-server"), "default", "asset-id", clientProvider)
+		Expect(err).To(MatchError(`server "unlabeled-server" does not have the node name label "asset-id"`))
+	})
+
+	It("should fail if the server is not bound", func(ctx SpecContext) {
+		_, err := getNodeName(ctx, cmd.NodeNamePolicyServerLabel, newServerClaim(""), "default", "asset-id", clientProvider)
+		Expect(err).To(MatchError("server claim does not have a server ref"))
+	})
+
+	It("should fail if no label key is configured", func(ctx SpecContext) {
+		_, err := getNodeName(ctx, cmd.NodeNamePolicyServerLabel, newServerClaim("labeled-server"), "default", "", clientProvider)
+		Expect(err).To(MatchError("node name policy ServerLabel requires a node name label key"))
+	})
+})
+
+var _ = Describe("MachineClass node name policies", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-policy"
+
+	DescribeTable("should use the effective node name policy of the MachineClass",
+		func(ctx SpecContext, machineIndex int, policy cmd.NodeNamePolicy, expectServerName bool) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+			providerSpec := maps.Clone(testing.SampleProviderSpec)
+			if policy != "" {
+				providerSpec["nodeNamePolicy"] = policy
+			}
+			machineClass := newMachineClass(v1alpha1.ProviderName, providerSpec)
+
+			By("creating a server")
+			server := &metalv1alpha1.Server{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("policy-server-%d", machineIndex),
+				},
+				Spec: metalv1alpha1.ServerSpec{
+					SystemUUID: "12345",
+				},
+			}
+			Expect(k8sClient.Create(ctx, server)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, server)
+			expectedNodeName := machineName
+			if expectServerName {
+				expectedNodeName = server.Name
+			}
+
+			By("creating machine")
+			_, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})
+			if expectServerName {
+				Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("server %q in namespace %q is still not bound", machineName, ns.Name))))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})
+
+			By("patching ServerClaim with ServerRef")
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			Eventually(Update(serverClaim, func() {
+				serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+			})).Should(Succeed())
+
+			By("ensuring that create, initialize and status report the node name of the policy")
+			providerID := fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName)
+			Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})).To(Equal(&driver.CreateMachineResponse{ProviderID: providerID, NodeName: expectedNodeName}))
+			Expect((*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})).To(Equal(&driver.InitializeMachineResponse{ProviderID: providerID, NodeName: expectedNodeName}))
+			Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})).To(Equal(&driver.GetMachineStatusResponse{ProviderID: providerID, NodeName: expectedNodeName}))
+		},
+		Entry("driver policy", 1, cmd.NodeNamePolicy(""), false),
+		Entry("MachineClass policy", 2, cmd.NodeNamePolicyServerName, true),
+	)
+})
+
+// fakeClientProvider is a ClientProvider backed by a fake client, so that the driver runs without a metal cluster
+type fakeClientProvider struct {
+	client client.Client
+}
+
+func (p *fakeClientProvider) SyncClient(fn func(client client.Client) error) error {
+	return fn(p.client)
+}
+
+func (p *fakeClientProvider) GetClientScheme() *runtime.Scheme {
+	return p.client.Scheme()
+}
+
+var _ mcmclient.ClientProvider = &fakeClientProvider{}
+
+var _ = Describe("Driver with a fake ClientProvider", func() {
+	It("should list the machines of the ServerClaims served by the fake client", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(metalv1alpha1.AddToScheme(scheme)).To(Succeed())
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "metal",
+				Name:      "machine-fake-0",
+				Labels: map[string]string{
+					"shoot-name":                 "my-shoot",
+					"shoot-namespace":            "my-shoot-namespace",
+					validation.LabelKeyManagedBy: ManagedByLabelValue,
+				},
+			},
+		}
+		foreignServerClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "metal",
+				Name:      "foreign",
+			},
+		}
+		clientProvider := &fakeClientProvider{
+			client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(serverClaim, foreignServerClaim).Build(),
+		}
+		drv := NewDriver(clientProvider, "metal", cmd.NodeNamePolicyServerClaimName, Options{})
+
+		Expect(drv.ListMachines(ctx, &driver.ListMachinesRequest{
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       &corev1.Secret{Data: map[string][]byte{"userData": []byte("abcd")}},
+		})).To(Equal(&driver.ListMachinesResponse{
+			MachineList: map[string]string{
+				fmt.Sprintf("%s://metal/machine-fake-0", v1alpha1.ProviderName): "machine-fake-0",
+			},
+		}))
+	})
+})
@@ -5,23 +5,37 @@ package metal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// errIPAddressClaimBindGracePeriodExceeded is returned when an IPAddressClaim is not bound within the configured grace period
+var errIPAddressClaimBindGracePeriodExceeded = errors.New("bind grace period exceeded")
+
 // GetMachineStatus handles a machine get status request
-func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachineStatusRequest) (*driver.GetMachineStatusResponse, error) {
+func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachineStatusRequest) (_ *driver.GetMachineStatusResponse, err error) {
+	var providerSpec *apiv1alpha1.ProviderSpec
+	defer func(start time.Time) {
+		// the node name policy of the provider spec overrides the one of the driver once the provider spec is parsed
+		d.observeOperation(OperationGetStatus, start, d.getNodeNamePolicy(providerSpec), err)
+	}(time.Now())
+
 	if isEmptyMachineStatusRequest(req) {
 		return nil, status.Error(codes.InvalidArgument, "received empty GetMachineStatusRequest")
 	}
@@ -30,10 +44,15 @@ func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachi
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("requested provider %q is not supported by the driver %q", req.MachineClass.Provider, apiv1alpha1.ProviderName))
 	}
 
+	ctx, err = d.withMachineNamespace(ctx, req.Machine)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	klog.V(3).Infof("Machine status request has been received for %q", req.Machine.Name)
 	defer klog.V(3).Infof("Machine status request has been processed for %q", req.Machine.Name)
 
-	providerSpec, err := GetProviderSpec(req.MachineClass, req.Secret)
+	providerSpec, err = GetProviderSpec(req.MachineClass, req.Secret, d.options)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get provider spec: %v", err))
 	}
@@ -41,7 +60,7 @@ func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachi
 	serverClaim := &metalv1alpha1.ServerClaim{}
 
 	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
-		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.metalNamespace, Name: req.Machine.Name}, serverClaim)
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}, serverClaim)
 	}); err != nil {
 		if apierrors.IsNotFound(err) {
 			return nil, status.Error(codes.NotFound, err.Error())
@@ -49,13 +68,37 @@ func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachi
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	// the server may be bound after CreateMachine returned, the gauge is updated on every observation of the ServerClaim
+	setServerClaimPending(client.ObjectKeyFromObject(serverClaim), serverClaim.Spec.ServerRef == nil)
+
 	if len(serverClaim.Annotations) > 0 && serverClaim.Annotations[validation.AnnotationKeyMCMMachineRecreate] == "true" {
 		klog.V(3).Infof("Machine creation flow will be retriggered, Server still not bound: %q", req.Machine.Name)
 		// MCM provider retry with codes.NotFound which triggers machine creation flow
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("server claim %q is marked for recreation", req.Machine.Name))
 	}
 
-	nodeName, err := getNodeName(ctx, d.nodeNamePolicy, serverClaim, d.metalNamespace, d.clientProvider)
+	if d.options.ImageUpdatePolicy == cmd.ImageUpdatePolicyRecreate {
+		image, err := d.resolveImageAlias(ctx, providerSpec.Image)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to resolve image alias: %v", err))
+		}
+		if serverClaim.Spec.Image != image && d.isManagedObject(serverClaim) {
+			// the ServerClaim is deleted, as applying the changed image to the bound ServerClaim would not reprovision
+			// the server. Once it is gone the machine creation flow is triggered with codes.NotFound.
+			if serverClaim.DeletionTimestamp.IsZero() {
+				klog.V(3).InfoS("Deleting ServerClaim to recreate it, image of the MachineClass changed", "name", req.Machine.Name, "currentImage", serverClaim.Spec.Image, "image", image)
+				if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+					return client.IgnoreNotFound(metalClient.Delete(ctx, serverClaim))
+				}); err != nil {
+					return nil, status.Error(codes.Internal, fmt.Sprintf("failed to delete server claim to recreate it: %v", err))
+				}
+			}
+			// MCM provider retry with codes.Unavailable will ensure a short retry in 5 seconds
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("image %q of server claim %q differs from the image %q of the MachineClass, server claim is deleted to be recreated", serverClaim.Spec.Image, req.Machine.Name, image))
+		}
+	}
+
+	nodeName, err := d.resolveNodeName(ctx, d.getNodeNamePolicy(providerSpec), serverClaim)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get node name: %v", err))
 	}
@@ -65,7 +108,28 @@ func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachi
 		NodeName:   nodeName,
 	}
 
+	// the maintenance annotation of the machine powers off the server, the ServerClaim is annotated as well to tell a
+	// server powered off for maintenance from a server which is still not initialized. The machine-controller-manager
+	// only requests the status in the creation and deletion flows, so the maintenance is applied there.
+	maintenance := req.Machine.Annotations[validation.AnnotationKeyMaintenance] == "true"
+	if maintenance != (serverClaim.Annotations[validation.AnnotationKeyMaintenance] == "true") {
+		if err := d.SetMachineMaintenance(ctx, serverClaim, maintenance); err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to set maintenance of machine: %v", err))
+		}
+	}
+	if maintenance {
+		// the machine is reported as existing, an error would fail the creation flow and a reinitialization would
+		// power on the server again
+		klog.V(3).Infof("Machine %q is in maintenance, server is powered off", req.Machine.Name)
+		return getMachineStatusResponse, nil
+	}
+
 	if err := d.validateIPAddressClaims(ctx, req, serverClaim, providerSpec); err != nil {
+		if errors.Is(err, errIPAddressClaimBindGracePeriodExceeded) {
+			klog.V(3).Infof("Machine creation flow will be retriggered, IPAddressClaims not bound within grace period: %q", req.Machine.Name)
+			// MCM provider retry with codes.NotFound which triggers machine creation flow
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("unsuccessful IPAddressClaims validation, will recreate: %v", err))
+		}
 		klog.V(3).Infof("Machine initialization flow will be retriggered, IPAddressClaims validation was unsuccessful: %q", req.Machine.Name)
 		// MCM provider retry with codes.Uninitialized which triggers machine initialization flow (requires valid GetMachineStatusResponse)
 		return getMachineStatusResponse, status.Error(codes.Uninitialized, fmt.Sprintf("unsuccessful IPAddressClaims validation, will reinitialize: %v", err))
@@ -77,15 +141,232 @@ func (d *metalDriver) GetMachineStatus(ctx context.Context, req *driver.GetMachi
 		return getMachineStatusResponse, status.Error(codes.Uninitialized, fmt.Sprintf("server claim %q is still not powered on, will reinitialize", req.Machine.Name))
 	}
 
+	// the bound Server is only fetched once for all checks which require it
+	var server *metalv1alpha1.Server
+	if d.options.VerifyServerImage || d.options.ReadyConditionType != "" {
+		if server, err = d.getBoundServer(ctx, serverClaim); err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get the server of the server claim: %v", err))
+		}
+	}
+
+	if d.options.VerifyServerImage {
+		serverImage, err := d.getServerBootImage(ctx, server)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get the boot image of the server: %v", err))
+		}
+		if serverImage != "" && serverImage != serverClaim.Spec.Image {
+			// reinitializing the machine does not change the boot configuration of the server, the mismatch is only
+			// reported to not retrigger the initialization endlessly
+			klog.Warningf("Server of server claim %q boots the image %q instead of the requested image %q", req.Machine.Name, serverImage, serverClaim.Spec.Image)
+		}
+	}
+
+	if d.options.DetectIgnitionDrift {
+		drifted, err := d.hasIgnitionDrift(ctx, req, serverClaim, providerSpec)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to check the ignition for drift: %v", err))
+		}
+		if drifted {
+			klog.V(3).Infof("Machine initialization flow will be retriggered, ignition drifted from the provider spec %q", req.Machine.Name)
+			// MCM provider retry with codes.Uninitialized which triggers machine initialization flow (requires valid GetMachineStatusResponse)
+			return getMachineStatusResponse, status.Error(codes.Uninitialized, fmt.Sprintf("ignition of server claim %q has drifted from the provider spec, will reinitialize", req.Machine.Name))
+		}
+	}
+
+	if d.options.ReadyConditionType != "" {
+		if !serverIsReady(server, d.options.ReadyConditionType) {
+			if serverIsTransitioning(server) {
+				// a server which is e.g. rebooting is not ready, but the powered on ServerClaim is still healthy and
+				// reinitializing the machine would not change that. The provisioning duration is observed once it is ready.
+				klog.V(3).Infof("Server of machine %q is transitioning its power state and not ready yet", req.Machine.Name)
+				return getMachineStatusResponse, nil
+			}
+			klog.V(3).Infof("Machine initialization flow will be retriggered, Server still not ready %q", req.Machine.Name)
+			// MCM provider retry with codes.Uninitialized which triggers machine initialization flow (requires valid GetMachineStatusResponse)
+			return getMachineStatusResponse, status.Error(codes.Uninitialized, fmt.Sprintf("server of server claim %q has no true %s condition, will reinitialize", req.Machine.Name, d.options.ReadyConditionType))
+		}
+	}
+
+	if err := d.observeProvisioningDuration(ctx, serverClaim); err != nil {
+		// the provisioning duration is observed on the next status request
+		klog.Warningf("Failed to observe the provisioning duration of machine %q: %v", req.Machine.Name, err)
+	}
+
 	return getMachineStatusResponse, nil
 }
 
+// SetMachineMaintenance powers off the server of the ServerClaim and marks the ServerClaim to be in maintenance, or
+// powers the server on again once the maintenance ends. All other fields of the ServerClaim, e.g. the ignition secret
+// reference, are preserved.
+func (d *metalDriver) SetMachineMaintenance(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, on bool) error {
+	klog.V(3).InfoS("Setting maintenance of ServerClaim", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "maintenance", on)
+
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		baseServerClaim := serverClaim.DeepCopy()
+		if on {
+			if serverClaim.Annotations == nil {
+				serverClaim.Annotations = make(map[string]string)
+			}
+			serverClaim.Annotations[validation.AnnotationKeyMaintenance] = "true"
+			serverClaim.Spec.Power = metalv1alpha1.PowerOff
+		} else {
+			delete(serverClaim.Annotations, validation.AnnotationKeyMaintenance)
+			serverClaim.Spec.Power = metalv1alpha1.PowerOn
+		}
+		return metalClient.Patch(ctx, serverClaim, client.MergeFrom(baseServerClaim))
+	}); err != nil {
+		return fmt.Errorf("failed to patch ServerClaim %q: %w", client.ObjectKeyFromObject(serverClaim), err)
+	}
+
+	return nil
+}
+
+// observeProvisioningDuration observes the time from the provisioning start until the machine is ready for the first time.
+// The ServerClaim is marked as provisioned before the observation, so that the duration is observed at most once.
+func (d *metalDriver) observeProvisioningDuration(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim) error {
+	if serverClaim.Annotations[validation.AnnotationKeyProvisioningFinished] != "" {
+		return nil
+	}
+	provisioningStart, ok := serverClaim.Annotations[validation.AnnotationKeyProvisioningStart]
+	if !ok {
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, provisioningStart)
+	if err != nil {
+		return fmt.Errorf("invalid provisioning start %q: %w", provisioningStart, err)
+	}
+
+	now := time.Now()
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		baseServerClaim := serverClaim.DeepCopy()
+		serverClaim.Annotations[validation.AnnotationKeyProvisioningFinished] = now.UTC().Format(time.RFC3339)
+		return metalClient.Patch(ctx, serverClaim, client.MergeFrom(baseServerClaim))
+	}); err != nil {
+		return fmt.Errorf("failed to mark ServerClaim %q as provisioned: %w", client.ObjectKeyFromObject(serverClaim), err)
+	}
+
+	duration := now.Sub(start)
+	machineProvisioningDuration.Observe(duration.Seconds())
+	klog.V(3).InfoS("Machine provisioned", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "duration", duration)
+	return nil
+}
+
+// hasIgnitionDrift checks if the content hash of the ignition secret differs from the hash of the ignition rendered
+// from the current provider spec. An ignition secret without a content hash is considered drifted.
+func (d *metalDriver) hasIgnitionDrift(ctx context.Context, req *driver.GetMachineStatusRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) (bool, error) {
+	if serverClaim.Spec.IgnitionSecretRef == nil {
+		return false, nil
+	}
+
+	expectedHash, err := d.getExpectedIgnitionHash(ctx, req, serverClaim, providerSpec)
+	if err != nil {
+		return false, err
+	}
+
+	current := &corev1.Secret{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: serverClaim.Spec.IgnitionSecretRef.Name}, current)
+	}); err != nil {
+		return false, fmt.Errorf("failed to get ignition Secret %q: %w", serverClaim.Spec.IgnitionSecretRef.Name, err)
+	}
+
+	return current.Annotations[validation.AnnotationKeyIgnitionHash] != expectedHash, nil
+}
+
+// expectedIgnitionHash is the cached hash of the ignition rendered for a machine together with the version of the
+// inputs it was rendered from
+type expectedIgnitionHash struct {
+	version string
+	hash    string
+}
+
+// getExpectedIgnitionHash returns the hash of the ignition rendered from the current provider spec. Rendering the
+// ignition requires to collect the IPAM metadata, so the hash is cached until the generation of the MachineClass, the
+// provider secret or the ServerClaim changes.
+func (d *metalDriver) getExpectedIgnitionHash(ctx context.Context, req *driver.GetMachineStatusRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) (string, error) {
+	cacheKey := client.ObjectKey{Namespace: d.getMetalNamespace(ctx), Name: req.Machine.Name}
+	version := fmt.Sprintf("%s/%d/%s/%s/%s", req.MachineClass.UID, req.MachineClass.Generation, req.Secret.UID, req.Secret.ResourceVersion, serverClaim.UID)
+	if cached, ok := d.expectedIgnitionHashes.Load(cacheKey); ok && cached.(expectedIgnitionHash).version == version {
+		return cached.(expectedIgnitionHash).hash, nil
+	}
+
+	initReq := &driver.InitializeMachineRequest{
+		Machine:      req.Machine.DeepCopy(),
+		MachineClass: req.MachineClass,
+		Secret:       req.Secret,
+	}
+	addressesMetaData, err := d.collectIPAddressClaimsMetadata(ctx, initReq, providerSpec)
+	if err != nil {
+		return "", err
+	}
+	expected, err := d.renderIgnitionSecret(ctx, initReq, serverClaim, providerSpec, addressesMetaData)
+	if err != nil {
+		return "", err
+	}
+
+	hash := expected.Annotations[validation.AnnotationKeyIgnitionHash]
+	d.expectedIgnitionHashes.Store(cacheKey, expectedIgnitionHash{version: version, hash: hash})
+	return hash, nil
+}
+
+// getBoundServer returns the Server bound to the ServerClaim, or nil if the ServerClaim is not bound
+func (d *metalDriver) getBoundServer(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim) (*metalv1alpha1.Server, error) {
+	if serverClaim.Spec.ServerRef == nil {
+		return nil, nil
+	}
+
+	server := &metalv1alpha1.Server{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Name: serverClaim.Spec.ServerRef.Name}, server)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get Server %q: %w", serverClaim.Spec.ServerRef.Name, err)
+	}
+	return server, nil
+}
+
+// getServerBootImage returns the image of the boot configuration of the Server. An empty image is returned if there
+// is no Server or the Server has no boot configuration yet.
+func (d *metalDriver) getServerBootImage(ctx context.Context, server *metalv1alpha1.Server) (string, error) {
+	if server == nil || server.Spec.BootConfigurationRef == nil {
+		return "", nil
+	}
+	ref := server.Spec.BootConfigurationRef
+
+	bootConfig := &metalv1alpha1.ServerBootConfiguration{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, bootConfig)
+	}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get ServerBootConfiguration %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	return bootConfig.Spec.Image, nil
+}
+
+// serverIsTransitioning checks if the Server is powering on or off
+func serverIsTransitioning(server *metalv1alpha1.Server) bool {
+	if server == nil {
+		return false
+	}
+	return server.Status.PowerState == metalv1alpha1.ServerPoweringOnPowerState || server.Status.PowerState == metalv1alpha1.ServerPoweringOffPowerState
+}
+
+// serverIsReady checks if the Server has a true condition of the ready condition type
+func serverIsReady(server *metalv1alpha1.Server, readyConditionType string) bool {
+	if server == nil {
+		return false
+	}
+	return meta.IsStatusConditionTrue(server.Status.Conditions, readyConditionType)
+}
+
 func isEmptyMachineStatusRequest(req *driver.GetMachineStatusRequest) bool {
 	return req == nil || req.MachineClass == nil || req.Machine == nil || req.Secret == nil
 }
 
 func (d *metalDriver) validateIPAddressClaims(ctx context.Context, req *driver.GetMachineStatusRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) error {
-	klog.V(3).Info("Validating IPAddressClaims", "name", req.Machine.Name, "namespace", d.metalNamespace)
+	klog.V(3).InfoS("Validating IPAddressClaims", "name", req.Machine.Name, "namespace", d.getIPAddressClaimNamespace(ctx))
 
 	for _, ipamConfig := range providerSpec.IPAMConfig {
 		if ipamConfig.IPAMRef == nil {
@@ -95,7 +376,7 @@ func (d *metalDriver) validateIPAddressClaims(ctx context.Context, req *driver.G
 		ipClaim := &capiv1beta1.IPAddressClaim{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      getIPAddressClaimName(req.Machine.Name, ipamConfig.MetadataKey),
-				Namespace: d.metalNamespace,
+				Namespace: d.getIPAddressClaimNamespace(ctx),
 			},
 		}
 
@@ -105,16 +386,26 @@ func (d *metalDriver) validateIPAddressClaims(ctx context.Context, req *driver.G
 			return fmt.Errorf("failed to get IPAddressClaim %q: %v", ipClaim.Name, err)
 		}
 
-		validationErr := validation.ValidateIPAddressClaim(ipClaim, serverClaim, req.Machine.Name, d.metalNamespace)
+		validationErr := validation.ValidateIPAddressClaim(ipClaim, serverClaim, req.Machine.Name, d.getMetalNamespace(ctx))
 		if validationErr.ToAggregate() != nil && len(validationErr.ToAggregate().Errors()) > 0 {
 			return fmt.Errorf("failed to validate IPAddressClaim %s/%s: %v", ipClaim.Namespace, ipClaim.Name, validationErr.ToAggregate().Errors())
 		}
 
 		if ipClaim.Status.AddressRef.Name == "" {
+			if gracePeriod := d.options.IPAddressClaimBindGracePeriod; gracePeriod > 0 && time.Since(ipClaim.CreationTimestamp.Time) > gracePeriod {
+				// the stale IPAddressClaim is deleted, otherwise the machine creation flow would keep it together with
+				// its creation timestamp and the recreation would be requested again right away
+				if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+					return client.IgnoreNotFound(metalClient.Delete(ctx, ipClaim))
+				}); err != nil {
+					return fmt.Errorf("failed to delete stale IPAddressClaim %s/%s: %w", ipClaim.Namespace, ipClaim.Name, err)
+				}
+				return fmt.Errorf("IPAddressClaim %s/%s not bound within %s: %w", ipClaim.Namespace, ipClaim.Name, gracePeriod, errIPAddressClaimBindGracePeriodExceeded)
+			}
 			return fmt.Errorf("IPAddressClaim %s/%s still not bound", ipClaim.Namespace, ipClaim.Name)
 		}
 	}
 
-	klog.V(3).Info("All IPAddressClaims are valid and bound", "name", req.Machine.Name, "namespace", d.metalNamespace)
+	klog.V(3).InfoS("All IPAddressClaims are valid and bound", "name", req.Machine.Name, "namespace", d.getIPAddressClaimNamespace(ctx))
 	return nil
 }
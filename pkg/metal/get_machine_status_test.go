@@ -6,6 +6,7 @@ package metal
 import (
 	"fmt"
 	"maps"
+	"time"
 
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 
@@ -18,8 +19,12 @@ import (
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
@@ -563,3 +568,828 @@ var _ = Describe("GetMachineStatus using BMC names", func() {
 		})
 	})
 })
+
+var _ = Describe("GetMachineStatus with IPAddressClaim bind grace period", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{IPAddressClaimBindGracePeriod: time.Minute})
+	machineNamePrefix := "machine-status-grace"
+
+	It("should reinitialize while the IPAddressClaim binds shortly after initialization", func(ctx SpecContext) {
+		machineIndex := 1
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+
+		poolName := "pool-g"
+		ip, ipClaim := newIPRef(machineName, ns.Name, poolName, providerSpec, "10.11.12.13", "10.11.12.1")
+
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("failing on the initialization of the machine, IPAddressClaim still not bound")
+		_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(HaveOccurred())
+
+		By("ensuring the machine status requests a reinitialization within the grace period")
+		getMachineStatusResponse, err := (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(getMachineStatusResponse).ToNot(BeNil())
+		Expect(err).Should(MatchError(status.Error(codes.Uninitialized, fmt.Sprintf("unsuccessful IPAddressClaims validation, will reinitialize: IPAddressClaim %s/%s-%s still not bound", ns.Name, machineName, poolName))))
+
+		By("binding the IPAddressClaim")
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = ip.Name
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring the machine status")
+		_, err = (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("GetMachineStatus with exceeded IPAddressClaim bind grace period", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{IPAddressClaimBindGracePeriod: time.Millisecond})
+	machineNamePrefix := "machine-status-grace"
+
+	It("should recreate the machine if the IPAddressClaim is not bound within the grace period", func(ctx SpecContext) {
+		machineIndex := 2
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+
+		poolName := "pool-h"
+		_, ipClaim := newIPRef(machineName, ns.Name, poolName, providerSpec, "10.11.12.13", "10.11.12.1")
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.CreateMachineResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+		Eventually(Get(ipClaim)).Should(Succeed())
+		initialUID := ipClaim.UID
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("failing on the initialization of the machine, IPAddressClaim still not bound")
+		_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(HaveOccurred())
+
+		By("ensuring the machine status requests a recreation after the grace period")
+		getMachineStatusResponse, err := (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(getMachineStatusResponse).To(BeNil())
+		Expect(err).Should(MatchError(status.Error(codes.NotFound, fmt.Sprintf("unsuccessful IPAddressClaims validation, will recreate: IPAddressClaim %s/%s-%s not bound within 1ms: bind grace period exceeded", ns.Name, machineName, poolName))))
+
+		By("ensuring the stale IPAddressClaim is deleted")
+		Eventually(Get(ipClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+		By("recreating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring a new IPAddressClaim is created")
+		Eventually(Object(ipClaim)).Should(HaveField("UID", Not(Equal(initialUID))))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("GetMachineStatus with a ready condition", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{ReadyConditionType: "Ready"})
+	machineNamePrefix := "machine-status"
+
+	It("should only report a powered on machine once the server is ready", func(ctx SpecContext) {
+		machineIndex := 8
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("failing on the machine status while the powered on server is not ready")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).To(MatchError(status.Error(codes.Uninitialized, fmt.Sprintf("server of server claim %q has no true Ready condition, will reinitialize", machineName))))
+		}).Should(Succeed())
+
+		By("setting the ready condition of the server")
+		Eventually(UpdateStatus(server, func() {
+			meta.SetStatusCondition(&server.Status.Conditions, metav1.Condition{
+				Type:   "Ready",
+				Status: metav1.ConditionTrue,
+				Reason: "Ready",
+			})
+		})).Should(Succeed())
+
+		By("ensuring the machine status")
+		Eventually(func(g Gomega) {
+			g.Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).To(Equal(&driver.GetMachineStatusResponse{
+				ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+				NodeName:   machineName,
+			}))
+		}).Should(Succeed())
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+
+	It("should not reinitialize the machine while the server is transitioning its power state", func(ctx SpecContext) {
+		machineIndex := 9
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("rebooting the server")
+		Eventually(UpdateStatus(server, func() {
+			server.Status.PowerState = metalv1alpha1.ServerPoweringOnPowerState
+		})).Should(Succeed())
+
+		By("ensuring the machine is reported healthy instead of reinitialized while the server is rebooting")
+		Eventually(func(g Gomega) {
+			g.Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).To(Equal(&driver.GetMachineStatusResponse{
+				ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+				NodeName:   machineName,
+			}))
+		}).Should(Succeed())
+
+		By("ensuring the provisioning is not considered finished while the server is rebooting")
+		Consistently(Object(serverClaim)).Should(HaveField("ObjectMeta.Annotations", Not(HaveKey(validation.AnnotationKeyProvisioningFinished))))
+
+		By("setting the ready condition of the powered on server")
+		Eventually(UpdateStatus(server, func() {
+			server.Status.PowerState = metalv1alpha1.ServerOnPowerState
+			meta.SetStatusCondition(&server.Status.Conditions, metav1.Condition{
+				Type:   "Ready",
+				Status: metav1.ConditionTrue,
+				Reason: "Ready",
+			})
+		})).Should(Succeed())
+
+		By("ensuring the machine status once the server is ready")
+		Eventually(func(g Gomega) {
+			g.Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})).To(Equal(&driver.GetMachineStatusResponse{
+				ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+				NodeName:   machineName,
+			}))
+		}).Should(Succeed())
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("GetMachineStatus with provisioning duration", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-status"
+
+	provisioningDuration := func() *dto.Histogram {
+		metric := &dto.Metric{}
+		Expect(machineProvisioningDuration.Write(metric)).To(Succeed())
+		return metric.GetHistogram()
+	}
+
+	It("should observe the provisioning duration once the machine is ready for the first time", func(ctx SpecContext) {
+		machineIndex := 9
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		statusRequest := &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		}
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring that the ServerClaim carries the provisioning start")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.Annotations", HaveKey(validation.AnnotationKeyProvisioningStart)))
+		_, err := time.Parse(time.RFC3339, serverClaim.Annotations[validation.AnnotationKeyProvisioningStart])
+		Expect(err).NotTo(HaveOccurred())
+
+		By("not observing the duration while the machine is not ready")
+		before := provisioningDuration()
+		_, err = (*drv).GetMachineStatus(ctx, statusRequest)
+		Expect(err).To(MatchError(ContainSubstring("code = [Uninitialized]")))
+		Expect(provisioningDuration().GetSampleCount()).To(Equal(before.GetSampleCount()))
+
+		By("powering on the ServerClaim which has been created ten minutes ago")
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Annotations[validation.AnnotationKeyProvisioningStart] = time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+			serverClaim.Spec.Power = metalv1alpha1.PowerOn
+		})).Should(Succeed())
+
+		By("observing the duration once the machine is ready")
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).NotTo(BeNil())
+		after := provisioningDuration()
+		Expect(after.GetSampleCount()).To(Equal(before.GetSampleCount() + 1))
+		Expect(after.GetSampleSum() - before.GetSampleSum()).To(BeNumerically("~", 600, 10))
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.Annotations", HaveKey(validation.AnnotationKeyProvisioningFinished)))
+
+		By("not observing the duration again on the next status request")
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).NotTo(BeNil())
+		Expect(provisioningDuration().GetSampleCount()).To(Equal(after.GetSampleCount()))
+	})
+})
+
+var _ = Describe("GetMachineStatus with ignition drift detection", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{DetectIgnitionDrift: true})
+	machineNamePrefix := "machine-status"
+
+	It("should reinitialize the machine once the provider spec changes the ignition", func(ctx SpecContext) {
+		machineIndex := 10
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("test-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the ignition secret carries the content hash")
+		ignition := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(ignition)).Should(HaveField("ObjectMeta.Annotations", HaveKeyWithValue(validation.AnnotationKeyIgnitionHash, HaveLen(64))))
+
+		By("ensuring that the machine status reports no drift for the unchanged provider spec")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.GetMachineStatusResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+
+		By("ensuring that the expected hash is cached for the generation of the MachineClass")
+		metalDrv := (*drv).(*metalDriver)
+		cached, ok := metalDrv.expectedIgnitionHashes.Load(client.ObjectKey{Namespace: ns.Name, Name: machineName})
+		Expect(ok).To(BeTrue())
+		Expect(cached).To(HaveField("hash", ignition.Annotations[validation.AnnotationKeyIgnitionHash]))
+
+		By("detecting the drift once the provider spec metadata changes with a new generation of the MachineClass")
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["metaData"] = map[string]any{"foo": "changed"}
+		machineClass := newMachineClass(v1alpha1.ProviderName, providerSpec)
+		machineClass.Generation = 2
+		_, err := (*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Uninitialized, fmt.Sprintf("ignition of server claim %q has drifted from the provider spec, will reinitialize", machineName))))
+
+		By("reinitializing the machine with the changed provider spec")
+		Expect((*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring that the drift is resolved")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("GetMachineStatus with image update policies", func() {
+	machineNamePrefix := "machine-status"
+
+	// initializeMachineWithChangedImage creates and initializes a machine and returns the provider spec with a changed image
+	initializeMachineWithChangedImage := func(ctx SpecContext, ns *corev1.Namespace, providerSecret *corev1.Secret, drv *driver.Driver, machineIndex int) map[string]any {
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("test-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Expect((*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring the machine status for the unchanged image")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.GetMachineStatusResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}))
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["image"] = "my-new-image"
+		return providerSpec
+	}
+
+	Context("Ignore", func() {
+		ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{ImageUpdatePolicy: cmd.ImageUpdatePolicyIgnore})
+
+		It("should keep the machine if the image of the MachineClass changes", func(ctx SpecContext) {
+			machineIndex := 11
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+			providerSpec := initializeMachineWithChangedImage(ctx, ns, providerSecret, drv, machineIndex)
+
+			By("ensuring the machine status for the changed image")
+			Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})).To(Equal(&driver.GetMachineStatusResponse{
+				ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+				NodeName:   machineName,
+			}))
+		})
+	})
+
+	Context("Recreate", func() {
+		ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{ImageUpdatePolicy: cmd.ImageUpdatePolicyRecreate})
+
+		It("should recreate the machine if the image of the MachineClass changes", func(ctx SpecContext) {
+			machineIndex := 12
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+			providerSpec := initializeMachineWithChangedImage(ctx, ns, providerSecret, drv, machineIndex)
+			statusRequest := &driver.GetMachineStatusRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			}
+
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			Expect(Get(serverClaim)()).To(Succeed())
+			oldUID := serverClaim.UID
+
+			By("ensuring that the changed image deletes the ServerClaim")
+			_, err := (*drv).GetMachineStatus(ctx, statusRequest)
+			Expect(err).To(MatchError(status.Error(codes.Unavailable, fmt.Sprintf("image %q of server claim %q differs from the image %q of the MachineClass, server claim is deleted to be recreated", "my-image", machineName, "my-new-image"))))
+			Eventually(Get(serverClaim)).Should(Satisfy(apierrors.IsNotFound))
+
+			By("ensuring that the deleted ServerClaim triggers the machine creation flow")
+			_, err = (*drv).GetMachineStatus(ctx, statusRequest)
+			Expect(err).To(MatchError(status.Error(codes.NotFound, fmt.Sprintf("serverclaims.metal.ironcore.dev %q not found", machineName))))
+
+			By("creating the machine again")
+			Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})).NotTo(BeNil())
+
+			By("ensuring that a new ServerClaim with the changed image has been created")
+			Eventually(Object(serverClaim)).Should(SatisfyAll(
+				HaveField("UID", Not(Equal(oldUID))),
+				HaveField("Spec.Image", "my-new-image"),
+				HaveField("Spec.ServerRef", BeNil()),
+			))
+
+			By("ensuring that the new ServerClaim triggers the machine initialization flow")
+			_, err = (*drv).GetMachineStatus(ctx, statusRequest)
+			Expect(err).To(MatchError(status.Error(codes.Uninitialized, fmt.Sprintf("server claim %q is still not powered on, will reinitialize", machineName))))
+		})
+	})
+})
+
+var _ = Describe("GetMachineStatus with server image verification", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{VerifyServerImage: true})
+	machineNamePrefix := "machine-status"
+
+	It("should report a healthy machine while the server boots another image", func(ctx SpecContext) {
+		machineIndex := 13
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("test-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Expect((*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring the machine status while the server has no boot configuration")
+		expectedResponse := &driver.GetMachineStatusResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(expectedResponse))
+
+		By("referencing a boot configuration with a mismatched image")
+		bootConfig := &metalv1alpha1.ServerBootConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+			Spec: metalv1alpha1.ServerBootConfigurationSpec{
+				ServerRef: corev1.LocalObjectReference{Name: server.Name},
+				Image:     "other-image",
+			},
+		}
+		Expect(k8sClient.Create(ctx, bootConfig)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, bootConfig)
+		Eventually(Update(server, func() {
+			server.Spec.BootConfigurationRef = &corev1.ObjectReference{Namespace: ns.Name, Name: bootConfig.Name}
+		})).Should(Succeed())
+
+		By("ensuring that the mismatched image does not trigger the machine initialization flow")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(expectedResponse))
+
+		By("updating the image of the boot configuration")
+		Eventually(Update(bootConfig, func() {
+			bootConfig.Spec.Image = "my-image"
+		})).Should(Succeed())
+
+		By("ensuring the machine status once the server boots the requested image")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).To(Equal(expectedResponse))
+	})
+})
+
+var _ = Describe("GetMachineStatus with maintenance", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-status"
+
+	It("should power off the server while the machine is in maintenance", func(ctx SpecContext) {
+		machineIndex := 14
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		machine := newMachine(ns, machineNamePrefix, machineIndex, nil)
+		statusRequest := &driver.GetMachineStatusRequest{
+			Machine:      machine,
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		}
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("powering on the initialized ServerClaim")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.Power = metalv1alpha1.PowerOn
+			serverClaim.Spec.IgnitionSecretRef = &corev1.LocalObjectReference{Name: machineName}
+		})).Should(Succeed())
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).NotTo(BeNil())
+
+		expectedResponse := &driver.GetMachineStatusResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName),
+			NodeName:   machineName,
+		}
+
+		By("putting the machine into maintenance")
+		machine.Annotations = map[string]string{validation.AnnotationKeyMaintenance: "true"}
+		// the creation flow of the machine-controller-manager fails the machine on any error but codes.NotFound and
+		// codes.Uninitialized, which would trigger a reinitialization powering on the server again
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).To(Equal(expectedResponse))
+		Eventually(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Annotations", HaveKeyWithValue(validation.AnnotationKeyMaintenance, "true")),
+			HaveField("Spec.Power", metalv1alpha1.PowerOff),
+			HaveField("Spec.IgnitionSecretRef", &corev1.LocalObjectReference{Name: machineName}),
+		))
+
+		By("ensuring that the machine stays in maintenance")
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).To(Equal(expectedResponse))
+		Consistently(Object(serverClaim)).Should(HaveField("Spec.Power", metalv1alpha1.PowerOff))
+
+		By("ending the maintenance of the machine")
+		delete(machine.Annotations, validation.AnnotationKeyMaintenance)
+		Expect((*drv).GetMachineStatus(ctx, statusRequest)).To(Equal(expectedResponse))
+		Eventually(Object(serverClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Annotations", Not(HaveKey(validation.AnnotationKeyMaintenance))),
+			HaveField("Spec.Power", metalv1alpha1.PowerOn),
+			HaveField("Spec.IgnitionSecretRef", &corev1.LocalObjectReference{Name: machineName}),
+		))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
@@ -5,14 +5,25 @@ package metal
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/ignition"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 
+	machinev1alpha1 "github.com/gardener/machine-controller-manager/pkg/apis/machine/v1alpha1"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
@@ -20,7 +31,11 @@ import (
 	"github.com/imdario/mergo"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
@@ -28,8 +43,36 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// initializeRetryBackoff is the backoff between the in-place retries of initialization steps
+var initializeRetryBackoff = wait.Backoff{
+	Duration: 200 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// errStaleAddressRef is returned when the AddressRef of an IPAddressClaim references an IPAddress which no longer exists
+var errStaleAddressRef = errors.New("stale AddressRef")
+
+// unboundIPAddressClaimsError is returned when IPAddressClaims of the machine are not yet bound to an IPAddress
+type unboundIPAddressClaimsError struct {
+	// claim is the first unbound IPAddressClaim
+	claim string
+	// pools are the names of the pools of all unbound IPAddressClaims
+	pools []string
+}
+
+func (e *unboundIPAddressClaimsError) Error() string {
+	return fmt.Sprintf("IPAddressClaim %s not bound", e.claim)
+}
+
 // InitializeMachine handles a machine initialization request, which includes creating an ignition secret and powering on the server
-func (d *metalDriver) InitializeMachine(ctx context.Context, req *driver.InitializeMachineRequest) (*driver.InitializeMachineResponse, error) {
+func (d *metalDriver) InitializeMachine(ctx context.Context, req *driver.InitializeMachineRequest) (_ *driver.InitializeMachineResponse, err error) {
+	var providerSpec *apiv1alpha1.ProviderSpec
+	defer func(start time.Time) {
+		// the node name policy of the provider spec overrides the one of the driver once the provider spec is parsed
+		d.observeOperation(OperationInitialize, start, d.getNodeNamePolicy(providerSpec), err)
+	}(time.Now())
+
 	if isEmptyInitializeRequest(req) {
 		return nil, status.Error(codes.InvalidArgument, "received empty InitializeMachineRequest")
 	}
@@ -38,10 +81,15 @@ func (d *metalDriver) InitializeMachine(ctx context.Context, req *driver.Initial
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("requested provider %q is not supported by the driver %q", req.MachineClass.Provider, apiv1alpha1.ProviderName))
 	}
 
-	klog.V(3).Info("Machine initialization request has been received", "name", req.Machine.Name)
-	defer klog.V(3).Info("Machine initialization request has been processed", "name", req.Machine.Name)
+	ctx, err = d.withMachineNamespace(ctx, req.Machine)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	klog.V(3).InfoS("Machine initialization request has been received", "name", req.Machine.Name)
+	defer klog.V(3).InfoS("Machine initialization request has been processed", "name", req.Machine.Name)
 
-	providerSpec, err := GetProviderSpec(req.MachineClass, req.Secret)
+	providerSpec, err = GetProviderSpec(req.MachineClass, req.Secret, d.options)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get provider spec: %v", err))
 	}
@@ -51,24 +99,59 @@ func (d *metalDriver) InitializeMachine(ctx context.Context, req *driver.Initial
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get ServerClaim: %v", err))
 	}
 
+	// the server may be bound after CreateMachine returned, the gauge is updated on every observation of the ServerClaim
+	setServerClaimPending(client.ObjectKeyFromObject(serverClaim), serverClaim.Spec.ServerRef == nil)
+
 	if serverClaim.Spec.ServerRef == nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("ServerClaim %s/%s still not bound", d.metalNamespace, req.Machine.Name))
+		d.logServerSelectorDiagnostics(ctx, serverClaim, providerSpec)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ServerClaim %s/%s still not bound", d.getMetalNamespace(ctx), req.Machine.Name))
 	}
 
-	if err := d.createIPAddressClaims(ctx, req, serverClaim, providerSpec); err != nil {
+	if err := d.retryInitializeStep(ctx, serverClaim, func() error {
+		return d.createIPAddressClaims(ctx, req.Machine.Name, serverClaim, providerSpec)
+	}); err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create IPAddressClaims: %v", err))
 	}
 
 	addressesMetaData, err := d.collectIPAddressClaimsMetadata(ctx, req, providerSpec)
+	var unboundErr *unboundIPAddressClaimsError
+	if errors.As(err, &unboundErr) {
+		if err := d.annotateServerClaimWithPendingIPAMPools(ctx, serverClaim, unboundErr.pools); err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to annotate ServerClaim with pending IPAM pools: %v", err))
+		}
+	}
 	if err != nil {
+		if errors.Is(err, errStaleAddressRef) {
+			// MCM provider retry with codes.Uninitialized which triggers machine initialization flow
+			return nil, status.Error(codes.Uninitialized, fmt.Sprintf("failed to collect IPAddress metadata: %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to collect IPAddress metadata: %v", err))
 	}
 
-	if err := d.createIgnitionAndPowerOnServer(ctx, req, serverClaim, providerSpec, addressesMetaData); err != nil {
+	if err := d.retryInitializeStep(ctx, serverClaim, func() error {
+		return d.annotateServerClaimWithPendingIPAMPools(ctx, serverClaim, nil)
+	}); err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to clear pending IPAM pools of ServerClaim: %v", err))
+	}
+
+	if err := d.retryInitializeStep(ctx, serverClaim, func() error {
+		return d.annotateServerClaimWithIPAddresses(ctx, serverClaim, addressesMetaData)
+	}); err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to annotate ServerClaim with IP addresses: %v", err))
+	}
+
+	if err := d.retryInitializeStep(ctx, serverClaim, func() error {
+		return d.createIgnitionAndPowerOnServer(ctx, req, serverClaim, providerSpec, addressesMetaData)
+	}); err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update ignition and power on server: %v", err))
 	}
 
-	nodeName, err := getNodeName(ctx, d.nodeNamePolicy, serverClaim, d.metalNamespace, d.clientProvider)
+	// the annotations are informational, so the initialization does not fail if the driver may not patch Servers
+	if err := d.annotateServer(ctx, serverClaim); err != nil {
+		klog.Warningf("Failed to annotate the Server of ServerClaim %s: %v", client.ObjectKeyFromObject(serverClaim), err)
+	}
+
+	nodeName, err := d.resolveNodeName(ctx, d.getNodeNamePolicy(providerSpec), serverClaim)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get node name: %v", err))
 	}
@@ -79,14 +162,77 @@ func (d *metalDriver) InitializeMachine(ctx context.Context, req *driver.Initial
 	}, nil
 }
 
+// retryInitializeStep runs a step of the machine initialization and retries it in place up to the configured initialize
+// retries if it fails with a transient metal API error. As a failed step may have modified the ServerClaim without
+// persisting it, the ServerClaim is fetched again before each retry.
+func (d *metalDriver) retryInitializeStep(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, step func() error) error {
+	backoff := initializeRetryBackoff
+	backoff.Steps = d.options.InitializeRetries + 1
+
+	attempt := 0
+	return retry.OnError(backoff, isTransientError, func() error {
+		if attempt++; attempt > 1 {
+			klog.V(3).InfoS("Retrying initialization step", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "attempt", attempt)
+			current := &metalv1alpha1.ServerClaim{}
+			if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+				return metalClient.Get(ctx, client.ObjectKeyFromObject(serverClaim), current)
+			}); err != nil {
+				return err
+			}
+			*serverClaim = *current
+		}
+		return step()
+	})
+}
+
+// isTransientError checks if the error is a transient metal API error which may succeed if retried
+func isTransientError(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err)
+}
+
+// annotateServer sets the configured server annotations on the Server bound to the ServerClaim
+func (d *metalDriver) annotateServer(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim) error {
+	if len(d.options.ServerAnnotations) == 0 || serverClaim.Spec.ServerRef == nil {
+		return nil
+	}
+
+	server := &metalv1alpha1.Server{}
+	return d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		if err := metalClient.Get(ctx, client.ObjectKey{Name: serverClaim.Spec.ServerRef.Name}, server); err != nil {
+			return err
+		}
+
+		baseServer := server.DeepCopy()
+		if server.Annotations == nil {
+			server.Annotations = make(map[string]string)
+		}
+		maps.Copy(server.Annotations, d.options.ServerAnnotations)
+		if maps.Equal(server.Annotations, baseServer.Annotations) {
+			return nil
+		}
+
+		klog.V(3).InfoS("Annotating Server", "name", server.Name, "annotations", d.options.ServerAnnotations)
+		return metalClient.Patch(ctx, server, client.MergeFrom(baseServer))
+	})
+}
+
 // isEmptyInitializeRequest checks if any of the fields in InitializeMachineRequest is empty
 func isEmptyInitializeRequest(req *driver.InitializeMachineRequest) bool {
 	return req == nil || req.MachineClass == nil || req.Machine == nil || req.Secret == nil
 }
 
-// createIPAddressClaims creates IPAddressClaims for the ipam config
-func (d *metalDriver) createIPAddressClaims(ctx context.Context, req *driver.InitializeMachineRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec) error {
-	klog.V(3).Info("Creating IPAddressClaims", "name", req.Machine.Name, "namespace", d.metalNamespace)
+// createIPAddressClaims creates IPAddressClaims for the ipam config. The owner reference to the ServerClaim is only
+// set if the ServerClaim is given, IPAddressClaims created before the ServerClaim are adopted on initialization.
+// The apply options are passed to the apply, e.g. to apply in dry-run mode.
+func (d *metalDriver) createIPAddressClaims(ctx context.Context, machineName string, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec, applyOpts ...client.PatchOption) error {
+	klog.V(3).InfoS("Creating IPAddressClaims", "name", machineName, "namespace", d.getIPAddressClaimNamespace(ctx))
+
+	if len(providerSpec.IPAMConfig) > 0 {
+		if err := d.ensureIPAMAvailable(); err != nil {
+			return err
+		}
+	}
 
 	for _, ipamConfig := range providerSpec.IPAMConfig {
 		if ipamConfig.IPAMRef == nil {
@@ -99,11 +245,12 @@ func (d *metalDriver) createIPAddressClaims(ctx context.Context, req *driver.Ini
 				Kind:       "IPAddressClaim",
 			},
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      getIPAddressClaimName(req.Machine.Name, ipamConfig.MetadataKey),
-				Namespace: d.metalNamespace,
+				Name:      getIPAddressClaimName(machineName, ipamConfig.MetadataKey),
+				Namespace: d.getIPAddressClaimNamespace(ctx),
 				Labels: map[string]string{
-					validation.LabelKeyServerClaimName:      req.Machine.Name,
-					validation.LabelKeyServerClaimNamespace: d.metalNamespace,
+					validation.LabelKeyServerClaimName:      machineName,
+					validation.LabelKeyServerClaimNamespace: d.getMetalNamespace(ctx),
+					validation.LabelKeyManagedBy:            d.getManagedByLabelValue(),
 				},
 			},
 			Spec: capiv1beta1.IPAddressClaimSpec{
@@ -115,33 +262,109 @@ func (d *metalDriver) createIPAddressClaims(ctx context.Context, req *driver.Ini
 			},
 		}
 
-		if err := controllerutil.SetOwnerReference(serverClaim, ipClaim, d.clientProvider.GetClientScheme()); err != nil {
-			return fmt.Errorf("failed to set owner reference for IPAddressClaim %q: %v", ipClaim.Name, err)
+		if err := d.checkIPAddressClaimCollision(ctx, client.ObjectKeyFromObject(ipClaim), machineName); err != nil {
+			return err
+		}
+
+		// owner references can not cross namespaces, IPAddressClaims in a separate namespace are only bound by labels
+		if serverClaim != nil && ipClaim.Namespace == serverClaim.Namespace {
+			if err := controllerutil.SetOwnerReference(serverClaim, ipClaim, d.clientProvider.GetClientScheme()); err != nil {
+				return fmt.Errorf("failed to set owner reference for IPAddressClaim %q: %w", ipClaim.Name, err)
+			}
+			if err := d.removeStaleOwnerReferences(ctx, client.ObjectKeyFromObject(ipClaim), serverClaim); err != nil {
+				return fmt.Errorf("failed to remove stale owner references of IPAddressClaim %q: %w", ipClaim.Name, err)
+			}
 		}
 
 		if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
-			return metalClient.Patch(ctx, ipClaim, client.Apply, fieldOwner, client.ForceOwnership)
+			return metalClient.Patch(ctx, ipClaim, client.Apply, append([]client.PatchOption{d.getFieldOwner(), client.ForceOwnership}, applyOpts...)...)
 		}); err != nil {
-			return fmt.Errorf("failed to create IPAddressClaim: %s", err.Error())
+			return fmt.Errorf("failed to create IPAddressClaim: %w", err)
+		}
+	}
+
+	klog.V(3).InfoS("Successfully created all IPAddressClaims", "count", len(providerSpec.IPAMConfig))
+	return nil
+}
+
+// ensureIPAMAvailable checks on first use that the IPAddressClaim CRD of the CAPI IPAM is installed in the metal cluster
+func (d *metalDriver) ensureIPAMAvailable() error {
+	if d.ipamAvailable.Load() {
+		return nil
+	}
+
+	groupKind := capiv1beta1.GroupVersion.WithKind("IPAddressClaim").GroupKind()
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		_, err := metalClient.RESTMapper().RESTMapping(groupKind, capiv1beta1.GroupVersion.Version)
+		return err
+	}); err != nil {
+		if meta.IsNoMatchError(err) {
+			return fmt.Errorf("IPAM is configured but the CRD ipaddressclaims.%s/%s is not installed in the metal cluster", capiv1beta1.GroupVersion.Group, capiv1beta1.GroupVersion.Version)
 		}
+		return fmt.Errorf("failed to check if the CRD ipaddressclaims.%s is installed: %w", capiv1beta1.GroupVersion.Group, err)
 	}
 
-	klog.V(3).Info("Successfully created all IPAddressClaims", "count", len(providerSpec.IPAMConfig))
+	d.ipamAvailable.Store(true)
 	return nil
 }
 
-// collectIPAddressClaimsMetadata collects the IPAddressClaims metadata for the machine
+// checkIPAddressClaimCollision fails if an IPAddressClaim with the name already exists which belongs to another machine,
+// e.g. machine "foo" with metadata key "bar-baz" and machine "foo-bar" with metadata key "baz", instead of taking it over
+func (d *metalDriver) checkIPAddressClaimCollision(ctx context.Context, key client.ObjectKey, machineName string) error {
+	ipClaim := &capiv1beta1.IPAddressClaim{}
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Get(ctx, key, ipClaim)
+	}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get IPAddressClaim %q: %w", key, err)
+	}
+
+	owner, ok := ipClaim.Labels[validation.LabelKeyServerClaimName]
+	ownerNamespace := ipClaim.Labels[validation.LabelKeyServerClaimNamespace]
+	if ok && (owner != machineName || ownerNamespace != d.getMetalNamespace(ctx)) {
+		return fmt.Errorf("IPAddressClaim %q already exists for machine %q in namespace %q, the name collides for machine %q", key, owner, ownerNamespace, machineName)
+	}
+	return nil
+}
+
+// removeStaleOwnerReferences removes owner references of an existing IPAddressClaim which point to a previous
+// ServerClaim of the same name, e.g. left behind by an interrupted initialization before the ServerClaim was recreated
+func (d *metalDriver) removeStaleOwnerReferences(ctx context.Context, key client.ObjectKey, serverClaim *metalv1alpha1.ServerClaim) error {
+	return d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		ipClaim := &capiv1beta1.IPAddressClaim{}
+		if err := metalClient.Get(ctx, key, ipClaim); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		baseIPClaim := ipClaim.DeepCopy()
+		ipClaim.OwnerReferences = slices.DeleteFunc(ipClaim.OwnerReferences, func(ownerRef metav1.OwnerReference) bool {
+			return ownerRef.Kind == "ServerClaim" && ownerRef.Name == serverClaim.Name && ownerRef.UID != serverClaim.UID
+		})
+		if len(ipClaim.OwnerReferences) == len(baseIPClaim.OwnerReferences) {
+			return nil
+		}
+
+		klog.V(3).InfoS("Removing stale owner references of IPAddressClaim", "name", ipClaim.Name, "namespace", ipClaim.Namespace)
+		return metalClient.Patch(ctx, ipClaim, client.MergeFrom(baseIPClaim))
+	})
+}
+
+// collectIPAddressClaimsMetadata collects the IPAddressClaims metadata for the machine. If IPAddressClaims are not yet
+// bound, an unboundIPAddressClaimsError listing the pools of all unbound claims is returned.
 func (d *metalDriver) collectIPAddressClaimsMetadata(ctx context.Context, req *driver.InitializeMachineRequest, providerSpec *apiv1alpha1.ProviderSpec) (map[string]any, error) {
-	klog.V(3).Info("Collecting IPAddressClaims metadata for machine", "name", req.Machine.Name, "namespace", d.metalNamespace)
+	klog.V(3).InfoS("Collecting IPAddressClaims metadata for machine", "name", req.Machine.Name, "namespace", d.getIPAddressClaimNamespace(ctx))
 
 	addressesMetaData := make(map[string]any)
+	var unboundErr *unboundIPAddressClaimsError
 
 	for _, ipamConfig := range providerSpec.IPAMConfig {
 		ipAddrClaimName := getIPAddressClaimName(req.Machine.Name, ipamConfig.MetadataKey)
 		ipClaim := &capiv1beta1.IPAddressClaim{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      ipAddrClaimName,
-				Namespace: d.metalNamespace,
+				Namespace: d.getIPAddressClaimNamespace(ctx),
 			},
 		}
 
@@ -152,7 +375,11 @@ func (d *metalDriver) collectIPAddressClaimsMetadata(ctx context.Context, req *d
 		}
 
 		if ipClaim.Status.AddressRef.Name == "" {
-			return nil, fmt.Errorf("IPAddressClaim %s/%s not bound", ipClaim.Namespace, ipClaim.Name)
+			if unboundErr == nil {
+				unboundErr = &unboundIPAddressClaimsError{claim: client.ObjectKeyFromObject(ipClaim).String()}
+			}
+			unboundErr.pools = append(unboundErr.pools, ipamConfig.IPAMRef.Name)
+			continue
 		}
 
 		ipAddr := &capiv1beta1.IPAddress{
@@ -165,56 +392,301 @@ func (d *metalDriver) collectIPAddressClaimsMetadata(ctx context.Context, req *d
 		if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
 			return metalClient.Get(ctx, client.ObjectKeyFromObject(ipAddr), ipAddr)
 		}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("IPAddressClaim %s/%s references the missing IPAddress %q, delete the IPAddressClaim to have it recreated: %w", ipClaim.Namespace, ipClaim.Name, ipAddr.Name, errStaleAddressRef)
+			}
 			return nil, fmt.Errorf("failed to get IPAddress %q: %w", client.ObjectKeyFromObject(ipAddr), err)
 		}
 
-		addressesMetaData[ipamConfig.MetadataKey] = map[string]any{
+		if err := validateIPFamily(ipamConfig.IPFamily, ipAddr.Spec.Address); err != nil {
+			return nil, fmt.Errorf("IPAddress %q of metadata key %q: %w", client.ObjectKeyFromObject(ipAddr), ipamConfig.MetadataKey, err)
+		}
+
+		// the defaults of the IPAM config only fill in what the allocated IPAddress does not specify
+		prefix := ipAddr.Spec.Prefix
+		if prefix == 0 {
+			prefix = ipamConfig.DefaultPrefix
+		}
+		gateway := ipAddr.Spec.Gateway
+		if gateway == "" {
+			gateway = ipamConfig.DefaultGateway
+		}
+
+		// a misconfigured pool may allocate addresses with an empty prefix, which would render an unusable network config
+		if err := validatePrefix(ipAddr.Spec.Address, prefix); err != nil {
+			return nil, fmt.Errorf("IPAddress %q of metadata key %q: %w", client.ObjectKeyFromObject(ipAddr), ipamConfig.MetadataKey, err)
+		}
+
+		addressMetaData := map[string]any{
 			"ip":      ipAddr.Spec.Address,
-			"prefix":  ipAddr.Spec.Prefix,
-			"gateway": ipAddr.Spec.Gateway,
+			"prefix":  prefix,
+			"gateway": gateway,
+		}
+		if d.options.IPAMPoolMetadata && ipamConfig.IPAMRef != nil {
+			addressMetaData["pool"] = ipamConfig.IPAMRef.Name
 		}
+		addressesMetaData[ipamConfig.MetadataKey] = addressMetaData
 
-		klog.V(3).Info("IP address metadata found", "namespace", ipAddr.Namespace, "name", ipAddr.Name, "ip", ipAddr.Spec.Address, "prefix", ipAddr.Spec.Prefix, "gateway", ipAddr.Spec.Gateway)
+		klog.V(3).InfoS("IP address metadata found", "namespace", ipAddr.Namespace, "name", ipAddr.Name, "ip", ipAddr.Spec.Address, "prefix", prefix, "gateway", gateway)
 	}
 
-	klog.V(3).Info("Successfully processed all IPAMConfigs", "count", len(addressesMetaData))
+	if unboundErr != nil {
+		return nil, unboundErr
+	}
+
+	klog.V(3).InfoS("Successfully processed all IPAMConfigs", "count", len(addressesMetaData))
 	return addressesMetaData, nil
 }
 
+// validateIPFamily checks that the address is of the expected IP family, an empty family matches any address
+func validateIPFamily(family apiv1alpha1.IPFamily, address string) error {
+	if family == "" {
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address %q: %w", address, err)
+	}
+
+	var actual apiv1alpha1.IPFamily
+	if addr.Unmap().Is4() {
+		actual = apiv1alpha1.IPFamilyIPv4
+	} else {
+		actual = apiv1alpha1.IPFamilyIPv6
+	}
+	if actual != family {
+		return fmt.Errorf("address %s is of IP family %s, expected %s", address, actual, family)
+	}
+	return nil
+}
+
+// validatePrefix checks that the prefix is within the range of the IP family of the address, i.e. 1-32 for IPv4 and
+// 1-128 for IPv6 addresses
+func validatePrefix(address string, prefix int) error {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address %q: %w", address, err)
+	}
+
+	maxPrefix := 128
+	if addr.Unmap().Is4() {
+		maxPrefix = 32
+	}
+	if prefix < 1 || prefix > maxPrefix {
+		return fmt.Errorf("prefix %d of address %s is out of the range 1-%d, the IPAM pool may be misconfigured", prefix, address, maxPrefix)
+	}
+	return nil
+}
+
+// maxIPAddressesAnnotationSize is the maximum size in bytes of the IP addresses annotation on the ServerClaim
+const maxIPAddressesAnnotationSize = 4096
+
+// annotateServerClaimWithIPAddresses annotates the ServerClaim with the allocated IP addresses per metadata key
+func (d *metalDriver) annotateServerClaimWithIPAddresses(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, addressesMetaData map[string]any) error {
+	if len(addressesMetaData) == 0 {
+		return nil
+	}
+
+	ipAddresses, err := getIPAddressesAnnotationValue(addressesMetaData)
+	if err != nil {
+		return err
+	}
+
+	if serverClaim.Annotations[validation.AnnotationKeyIPAddresses] == ipAddresses {
+		return nil
+	}
+
+	klog.V(3).InfoS("Annotating ServerClaim with IP addresses", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "ipAddresses", ipAddresses)
+
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		baseServerClaim := serverClaim.DeepCopy()
+		if serverClaim.Annotations == nil {
+			serverClaim.Annotations = make(map[string]string)
+		}
+		serverClaim.Annotations[validation.AnnotationKeyIPAddresses] = ipAddresses
+		return metalClient.Patch(ctx, serverClaim, client.MergeFrom(baseServerClaim))
+	}); err != nil {
+		return fmt.Errorf("failed to patch ServerClaim: %w", err)
+	}
+
+	return nil
+}
+
+// annotateServerClaimWithPendingIPAMPools annotates the ServerClaim with the pools of the IPAddressClaims which are not
+// yet bound, so that a stuck allocation is visible on the ServerClaim. The annotation is removed if no pools are pending.
+func (d *metalDriver) annotateServerClaimWithPendingIPAMPools(ctx context.Context, serverClaim *metalv1alpha1.ServerClaim, pools []string) error {
+	pools = slices.Clone(pools)
+	slices.Sort(pools)
+	pools = slices.Compact(pools)
+	pendingPools := strings.Join(pools, ",")
+
+	current, ok := serverClaim.Annotations[validation.AnnotationKeyPendingIPAMPools]
+	if current == pendingPools && ok == (pendingPools != "") {
+		return nil
+	}
+
+	klog.V(3).InfoS("Annotating ServerClaim with pending IPAM pools", "name", serverClaim.Name, "namespace", serverClaim.Namespace, "pools", pendingPools)
+
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		baseServerClaim := serverClaim.DeepCopy()
+		if pendingPools == "" {
+			delete(serverClaim.Annotations, validation.AnnotationKeyPendingIPAMPools)
+		} else {
+			if serverClaim.Annotations == nil {
+				serverClaim.Annotations = make(map[string]string)
+			}
+			serverClaim.Annotations[validation.AnnotationKeyPendingIPAMPools] = pendingPools
+		}
+		return metalClient.Patch(ctx, serverClaim, client.MergeFrom(baseServerClaim))
+	}); err != nil {
+		return fmt.Errorf("failed to patch ServerClaim: %w", err)
+	}
+
+	return nil
+}
+
+// getIPAddressesAnnotationValue returns the IP addresses in CIDR notation per metadata key as JSON.
+// Addresses which would exceed the maximum annotation size are omitted.
+func getIPAddressesAnnotationValue(addressesMetaData map[string]any) (string, error) {
+	ipAddresses := make(map[string]string, len(addressesMetaData))
+	value := []byte("{}")
+
+	keys := make([]string, 0, len(addressesMetaData))
+	for key := range addressesMetaData {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		metaData, ok := addressesMetaData[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		ipAddresses[key] = fmt.Sprintf("%v/%v", metaData["ip"], metaData["prefix"])
+
+		data, err := json.Marshal(ipAddresses)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal IP addresses: %w", err)
+		}
+		if len(data) > maxIPAddressesAnnotationSize {
+			klog.InfoS("IP addresses annotation exceeds the maximum size, omitting remaining addresses", "maxSize", maxIPAddressesAnnotationSize, "omittedKey", key)
+			break
+		}
+		value = data
+	}
+
+	return string(value), nil
+}
+
 // generateIgnition creates an ignition file for the machine and stores it in a secret
 func (d *metalDriver) generateIgnitionSecret(ctx context.Context, req *driver.InitializeMachineRequest, hostname string, providerSpec *apiv1alpha1.ProviderSpec, addressesMetaData map[string]any, serverMetadata *ServerMetadata) (*corev1.Secret, error) {
-	klog.V(3).Info("Generating ignition secret for machine", "name", req.Machine.Name)
+	klog.V(3).InfoS("Generating ignition secret for machine", "name", req.Machine.Name)
 
 	userData, ok := req.Secret.Data["userData"]
 	if !ok {
 		return nil, fmt.Errorf("failed to find user-data in Secret %q", client.ObjectKeyFromObject(req.Secret))
 	}
 
+	additionalIgnitions := make([]string, 0, len(providerSpec.AdditionalUserDataKeys))
+	for _, key := range providerSpec.AdditionalUserDataKeys {
+		data, ok := req.Secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("failed to find additional user data key %q in Secret %q", key, client.ObjectKeyFromObject(req.Secret))
+		}
+		additionalIgnitions = append(additionalIgnitions, string(data))
+	}
+
 	if providerSpec.Metadata == nil {
 		providerSpec.Metadata = make(map[string]any)
 	}
 
-	if serverMetadata != nil {
-		metadata := map[string]any{}
-		if serverMetadata.LoopbackAddress != nil {
-			metadata["loopbackAddress"] = serverMetadata.LoopbackAddress.String()
-		}
-		if err := mergo.Merge(&providerSpec.Metadata, metadata, mergo.WithOverride); err != nil {
-			return nil, fmt.Errorf("failed to merge server metadata into provider metadata: %w", err)
+	// the computed metadata overrides colliding keys of the provider spec metadata unless the user metadata takes precedence
+	var mergeOpts []func(*mergo.Config)
+	if !d.options.UserMetadataPrecedence {
+		mergeOpts = append(mergeOpts, mergo.WithOverride)
+	}
+
+	metadata := map[string]any{}
+	if serverMetadata != nil && serverMetadata.LoopbackAddress != nil {
+		metadata["loopbackAddress"] = serverMetadata.LoopbackAddress.String()
+	}
+	if providerSpec.PropagateCreationTimestamp {
+		if createdAt := getCreationTimestamp(req.Machine, serverMetadata); !createdAt.IsZero() {
+			metadata["createdAt"] = createdAt.UTC().Format(time.RFC3339)
 		}
 	}
+	if err := mergo.Merge(&providerSpec.Metadata, metadata, mergeOpts...); err != nil {
+		return nil, fmt.Errorf("failed to merge server metadata into provider metadata: %w", err)
+	}
 
-	if err := mergo.Merge(&providerSpec.Metadata, addressesMetaData, mergo.WithOverride); err != nil {
+	if err := mergo.Merge(&providerSpec.Metadata, addressesMetaData, mergeOpts...); err != nil {
 		return nil, fmt.Errorf("failed to merge addresses metadata into provider metadata: %w", err)
 	}
 
+	if d.options.MaxMetadataSize > 0 {
+		metadataJSON, err := json.Marshal(providerSpec.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		if len(metadataJSON) > d.options.MaxMetadataSize {
+			return nil, fmt.Errorf("serialized metadata of machine %q has %d bytes which exceeds the maximum metadata size of %d bytes", req.Machine.Name, len(metadataJSON), d.options.MaxMetadataSize)
+		}
+	}
+
 	config := &ignition.Config{
-		Hostname:         hostname,
-		UserData:         string(userData),
-		MetaData:         providerSpec.Metadata,
-		Ignition:         providerSpec.Ignition,
-		DnsServers:       providerSpec.DnsServers,
-		IgnitionOverride: providerSpec.IgnitionOverride,
+		Hostname:                 hostname,
+		UserData:                 string(userData),
+		MetaData:                 providerSpec.Metadata,
+		Ignition:                 providerSpec.Ignition,
+		DnsServers:               providerSpec.DnsServers,
+		FallbackDnsServers:       providerSpec.FallbackDnsServers,
+		ResolvConfSymlink:        providerSpec.ResolvConfSymlink,
+		IgnitionOverride:         providerSpec.IgnitionOverride,
+		AdditionalIgnitions:      additionalIgnitions,
+		CompressionThreshold:     d.options.IgnitionCompressionThreshold,
+		MetaDataEnvFile:          d.options.MetadataEnvFile,
+		MetaDataYAML:             providerSpec.MetadataFormat == apiv1alpha1.MetadataFormatYAML,
+		UserDataIgnition:         d.options.UserDataIgnitionPolicy == cmd.UserDataIgnitionPolicyMerge || d.options.UserDataIgnitionPolicy == cmd.UserDataIgnitionPolicyOverride,
+		UserDataIgnitionOverride: d.options.UserDataIgnitionPolicy == cmd.UserDataIgnitionPolicyOverride,
+	}
+	if paths := providerSpec.IgnitionPaths; paths != nil {
+		config.MetaDataPath = paths.MetadataPath
+		config.InitScriptPath = paths.InitScriptPath
+		config.HostnamePath = paths.HostnamePath
+		config.InitDoneMarkerPath = paths.InitDoneMarkerPath
+	}
+	for _, dropin := range providerSpec.CloudConfigInitDropins {
+		config.InitServiceDropins = append(config.InitServiceDropins, ignition.Dropin{
+			Name:     dropin.Name,
+			Contents: dropin.Contents,
+		})
+	}
+
+	for _, device := range providerSpec.LUKS {
+		config.LUKS = append(config.LUKS, toIgnitionLUKSDevice(device))
+	}
+
+	for _, group := range providerSpec.Groups {
+		config.Groups = append(config.Groups, ignition.Group{
+			Name:   group.Name,
+			Gid:    group.GID,
+			System: group.System,
+		})
+	}
+
+	for _, user := range providerSpec.Users {
+		config.Users = append(config.Users, ignition.User{
+			Name:              user.Name,
+			Uid:               user.UID,
+			PrimaryGroup:      user.PrimaryGroup,
+			Groups:            user.Groups,
+			HomeDir:           user.HomeDir,
+			NoCreateHome:      user.NoCreateHome,
+			Shell:             user.Shell,
+			System:            user.System,
+			SSHAuthorizedKeys: user.SSHAuthorizedKeys,
+		})
 	}
 
 	ignitionContent, err := ignition.Render(config)
@@ -222,16 +694,26 @@ func (d *metalDriver) generateIgnitionSecret(ctx context.Context, req *driver.In
 		return nil, fmt.Errorf("failed to render ignition for Machine %q: %w", client.ObjectKeyFromObject(req.Machine), err)
 	}
 
+	ignitionKey := providerSpec.IgnitionSecretKey
+	if ignitionKey == "" {
+		ignitionKey = apiv1alpha1.DefaultIgnitionKey
+	}
 	ignitionData := map[string][]byte{}
-	ignitionData["ignition"] = []byte(ignitionContent)
+	ignitionData[ignitionKey] = []byte(ignitionContent)
 	ignitionSecret := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: corev1.SchemeGroupVersion.String(),
 			Kind:       "Secret",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      d.getIgnitionNameForMachine(ctx, req.Machine.Name),
-			Namespace: d.metalNamespace,
+			Name:      d.getIgnitionNameForMachine(ctx, req.Machine.Name, providerSpec),
+			Namespace: d.getMetalNamespace(ctx),
+			Labels: map[string]string{
+				validation.LabelKeyManagedBy: d.getManagedByLabelValue(),
+			},
+			Annotations: map[string]string{
+				validation.AnnotationKeyIgnitionHash: getIgnitionHash(ignitionContent),
+			},
 		},
 		Data: ignitionData,
 	}
@@ -239,32 +721,60 @@ func (d *metalDriver) generateIgnitionSecret(ctx context.Context, req *driver.In
 	return ignitionSecret, nil
 }
 
-// createIgnitionAndPowerOnServer creates the ignition secret for the server and powers it on
-func (d *metalDriver) createIgnitionAndPowerOnServer(ctx context.Context, req *driver.InitializeMachineRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec, addressesMetaData map[string]any) error {
-	klog.V(3).Info("Creating ignition Secret and powering on server", "severClaimName", client.ObjectKeyFromObject(serverClaim))
+// getIgnitionHash returns the hex encoded SHA-256 hash of the rendered ignition
+func getIgnitionHash(ignitionContent string) string {
+	hash := sha256.Sum256([]byte(ignitionContent))
+	return hex.EncodeToString(hash[:])
+}
 
-	nodeName, err := getNodeName(ctx, d.nodeNamePolicy, serverClaim, d.metalNamespace, d.clientProvider)
+// renderIgnitionSecret renders the ignition secret of the machine bound to the server of the ServerClaim
+func (d *metalDriver) renderIgnitionSecret(ctx context.Context, req *driver.InitializeMachineRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec, addressesMetaData map[string]any) (*corev1.Secret, error) {
+	nodeName, err := d.resolveNodeName(ctx, d.getNodeNamePolicy(providerSpec), serverClaim)
 	if err != nil {
-		return fmt.Errorf("failed to get node name: %w", err)
+		return nil, fmt.Errorf("failed to get node name: %w", err)
 	}
 
 	serverMetadata, err := d.extractServerMetadataFromClaim(ctx, serverClaim)
 	if err != nil {
-		return fmt.Errorf("error extracting server metadata from ServerClaim %q: %w", client.ObjectKeyFromObject(serverClaim), err)
+		return nil, fmt.Errorf("error extracting server metadata from ServerClaim %q: %w", client.ObjectKeyFromObject(serverClaim), err)
+	}
+
+	hostname, err := getHostname(providerSpec.HostnameSources, map[apiv1alpha1.HostnameSource]string{
+		apiv1alpha1.HostnameSourceProviderSpec: providerSpec.Hostname,
+		apiv1alpha1.HostnameSourceNodeName:     nodeName,
+		apiv1alpha1.HostnameSourceServerName:   serverClaim.Spec.ServerRef.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	if hostname, err = d.qualifyHostname(hostname, providerSpec); err != nil {
+		return nil, fmt.Errorf("failed to qualify hostname: %w", err)
 	}
 
-	ignitionSecret, err := d.generateIgnitionSecret(ctx, req, nodeName, providerSpec, addressesMetaData, serverMetadata)
+	return d.generateIgnitionSecret(ctx, req, hostname, providerSpec, addressesMetaData, serverMetadata)
+}
+
+// createIgnitionAndPowerOnServer creates the ignition secret for the server and powers it on
+func (d *metalDriver) createIgnitionAndPowerOnServer(ctx context.Context, req *driver.InitializeMachineRequest, serverClaim *metalv1alpha1.ServerClaim, providerSpec *apiv1alpha1.ProviderSpec, addressesMetaData map[string]any) error {
+	klog.V(3).InfoS("Creating ignition Secret and powering on server", "severClaimName", client.ObjectKeyFromObject(serverClaim))
+
+	ignitionSecret, err := d.renderIgnitionSecret(ctx, req, serverClaim, providerSpec, addressesMetaData)
 	if err != nil {
 		return err
 	}
 
-	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
-		return metalClient.Patch(ctx, ignitionSecret, client.Apply, fieldOwner, client.ForceOwnership)
-	}); err != nil {
+	// the ignition secret always shares the namespace of the ServerClaim, which references it locally
+	if d.options.IgnitionSecretOwnerReference {
+		if err := controllerutil.SetOwnerReference(serverClaim, ignitionSecret, d.clientProvider.GetClientScheme()); err != nil {
+			return fmt.Errorf("failed to set owner reference for ignition Secret %q: %w", ignitionSecret.Name, err)
+		}
+	}
+
+	if err := d.applyIgnitionSecret(ctx, ignitionSecret); err != nil {
 		return err
 	}
 
-	klog.V(3).Info("Setting ingnition Secret reference to the ServerClaim", "serverClaimName", client.ObjectKeyFromObject(serverClaim), "ignitionSecretName", client.ObjectKeyFromObject(ignitionSecret))
+	klog.V(3).InfoS("Setting ingnition Secret reference to the ServerClaim", "serverClaimName", client.ObjectKeyFromObject(serverClaim), "ignitionSecretName", client.ObjectKeyFromObject(ignitionSecret))
 
 	serverClaimBase := serverClaim.DeepCopy()
 	serverClaim.Spec.Power = metalv1alpha1.PowerOn
@@ -278,17 +788,70 @@ func (d *metalDriver) createIgnitionAndPowerOnServer(ctx context.Context, req *d
 		return err
 	}
 
-	klog.V(3).Info("ServerClaim powered on", "serverClaimName", client.ObjectKeyFromObject(serverClaim))
+	klog.V(3).InfoS("ServerClaim powered on", "serverClaimName", client.ObjectKeyFromObject(serverClaim))
+
+	return nil
+}
+
+// applyIgnitionSecret applies the ignition secret. The ownership of conflicting fields is forced unless the conflict
+// detection is enabled, in which case a conflict with another field manager of a co-managed secret is surfaced.
+func (d *metalDriver) applyIgnitionSecret(ctx context.Context, ignitionSecret *corev1.Secret) error {
+	patchOpts := []client.PatchOption{d.getFieldOwner()}
+	if !d.options.IgnitionSecretConflictDetection {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
 
+	if err := d.clientProvider.SyncClient(func(metalClient client.Client) error {
+		return metalClient.Patch(ctx, ignitionSecret, client.Apply, patchOpts...)
+	}); err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("ignition Secret %q is co-managed and conflicts with another field manager: %w", client.ObjectKeyFromObject(ignitionSecret), err)
+		}
+		return err
+	}
 	return nil
 }
 
 type ServerMetadata struct {
 	LoopbackAddress net.IP
+	// ServerClaimCreationTimestamp is the creation time of the ServerClaim
+	ServerClaimCreationTimestamp metav1.Time
+}
+
+// toIgnitionLUKSDevice converts the LUKS device of the provider spec to the LUKS device of the ignition
+func toIgnitionLUKSDevice(device apiv1alpha1.LUKSDevice) ignition.LUKSDevice {
+	luksDevice := ignition.LUKSDevice{
+		Name:       device.Name,
+		Device:     device.Device,
+		Label:      device.Label,
+		WipeVolume: device.WipeVolume,
+		Options:    device.Options,
+	}
+	if device.Clevis != nil {
+		luksDevice.Clevis = &ignition.Clevis{
+			Tpm2:      device.Clevis.TPM2,
+			Threshold: device.Clevis.Threshold,
+		}
+		for _, tang := range device.Clevis.Tang {
+			luksDevice.Clevis.Tang = append(luksDevice.Clevis.Tang, ignition.Tang{
+				URL:        tang.URL,
+				Thumbprint: tang.Thumbprint,
+			})
+		}
+	}
+	return luksDevice
+}
+
+// getCreationTimestamp returns the creation time of the machine, falling back to the creation time of the ServerClaim
+func getCreationTimestamp(machine *machinev1alpha1.Machine, serverMetadata *ServerMetadata) metav1.Time {
+	if !machine.CreationTimestamp.IsZero() || serverMetadata == nil {
+		return machine.CreationTimestamp
+	}
+	return serverMetadata.ServerClaimCreationTimestamp
 }
 
 func (d *metalDriver) extractServerMetadataFromClaim(ctx context.Context, claim *metalv1alpha1.ServerClaim) (*ServerMetadata, error) {
-	klog.V(3).Info("Extracting server metadata from ServerClaim", "name", client.ObjectKeyFromObject(claim))
+	klog.V(3).InfoS("Extracting server metadata from ServerClaim", "name", client.ObjectKeyFromObject(claim))
 
 	if claim.Spec.ServerRef == nil {
 		return nil, fmt.Errorf("ServerClaim %q does not have a server reference", client.ObjectKeyFromObject(claim))
@@ -302,7 +865,9 @@ func (d *metalDriver) extractServerMetadataFromClaim(ctx context.Context, claim
 		return nil, fmt.Errorf("failed to get Server by reference %q: %w", claim.Spec.ServerRef.Name, err)
 	}
 
-	serverMetadata := &ServerMetadata{}
+	serverMetadata := &ServerMetadata{
+		ServerClaimCreationTimestamp: claim.CreationTimestamp,
+	}
 
 	loopbackAddress, ok := server.Annotations[apiv1alpha1.LoopbackAddressAnnotation]
 	if ok {
@@ -316,12 +881,12 @@ func (d *metalDriver) extractServerMetadataFromClaim(ctx context.Context, claim
 }
 
 func (d *metalDriver) getServerClaim(ctx context.Context, req *driver.InitializeMachineRequest) (*metalv1alpha1.ServerClaim, error) {
-	klog.V(3).Info("Getting ServerClaim for machine", "name", req.Machine.Name, "namespace", d.metalNamespace)
+	klog.V(3).InfoS("Getting ServerClaim for machine", "name", req.Machine.Name, "namespace", d.getMetalNamespace(ctx))
 
 	serverClaim := &metalv1alpha1.ServerClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      req.Machine.Name,
-			Namespace: d.metalNamespace,
+			Namespace: d.getMetalNamespace(ctx),
 		},
 	}
 
@@ -4,16 +4,24 @@
 package metal
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/metal/testing"
 
@@ -22,9 +30,15 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/utils/ptr"
 	capiv1beta1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
@@ -206,6 +220,7 @@ var _ = Describe("InitializeMachine", func() {
 				HaveField("ObjectMeta.Labels", map[string]string{
 					validation.LabelKeyServerClaimName:      machineName,
 					validation.LabelKeyServerClaimNamespace: ns.Name,
+					validation.LabelKeyManagedBy:            ManagedByLabelValue,
 				}),
 				HaveField("ObjectMeta.OwnerReferences", ContainElement(
 					metav1.OwnerReference{
@@ -343,6 +358,11 @@ var _ = Describe("InitializeMachine", func() {
 			HaveField("Spec.IgnitionSecretRef.Name", machineName),
 		))
 
+		By("ensuring that the ServerClaim is annotated with the allocated IP addresses")
+		Eventually(Object(serverClaim)).Should(HaveField("ObjectMeta.Annotations", HaveKeyWithValue(
+			validation.AnnotationKeyIPAddresses, `{"pool-c":"10.11.13.13/24","pool-d":"10.11.13.13/24"}`,
+		)))
+
 		By("ensuring the cleanup of the machine")
 		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
 			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
@@ -474,7 +494,7 @@ var _ = Describe("InitializeMachine", func() {
 		delete(providerSpec, "metaData")
 
 		poolName := "pool-a"
-		_, ipClaim := newIPRef(machineName, ns.Name, poolName, providerSpec, "10.11.14.13", "10.11.14.1")
+		ip, ipClaim := newIPRef(machineName, ns.Name, poolName, providerSpec, "10.11.14.13", "10.11.14.1")
 
 		By("creating machine")
 		createMachineResponse, err := (*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
@@ -518,6 +538,33 @@ var _ = Describe("InitializeMachine", func() {
 
 		DeferCleanup(k8sClient.Delete, ipClaim)
 
+		By("ensuring that the ServerClaim is annotated with the pending IPAM pool")
+		Eventually(Object(serverClaim)).Should(
+			HaveField("ObjectMeta.Annotations", HaveKeyWithValue(validation.AnnotationKeyPendingIPAMPools, getIPAddressClaimName(machineName, poolName))),
+		)
+
+		By("binding the IPAddressClaim")
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = ip.Name
+		})).Should(Succeed())
+
+		By("initializing the machine once the IPAddressClaim is bound")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the pending IPAM pool annotation is removed")
+		Eventually(Object(serverClaim)).Should(
+			HaveField("ObjectMeta.Annotations", Not(HaveKey(validation.AnnotationKeyPendingIPAMPools))),
+		)
+
 		By("ensuring the cleanup of the machine")
 		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
 			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
@@ -684,3 +731,1379 @@ var _ = Describe("InitializeMachine with Server name as hostname", func() {
 		})
 	})
 })
+
+var _ = DescribeTable("getHostname",
+	func(sources []v1alpha1.HostnameSource, candidates map[v1alpha1.HostnameSource]string, expected string, expectErr bool) {
+		hostname, err := getHostname(sources, candidates)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hostname).To(Equal(expected))
+	},
+	Entry("default order prefers the explicit hostname",
+		nil,
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceProviderSpec: "explicit", v1alpha1.HostnameSourceNodeName: "node"},
+		"explicit", false,
+	),
+	Entry("default order falls back to the node name",
+		nil,
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceNodeName: "node", v1alpha1.HostnameSourceServerName: "server"},
+		"node", false,
+	),
+	Entry("node name before explicit hostname",
+		[]v1alpha1.HostnameSource{v1alpha1.HostnameSourceNodeName, v1alpha1.HostnameSourceProviderSpec},
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceProviderSpec: "explicit", v1alpha1.HostnameSourceNodeName: "node"},
+		"node", false,
+	),
+	Entry("server name before node name",
+		[]v1alpha1.HostnameSource{v1alpha1.HostnameSourceServerName, v1alpha1.HostnameSourceNodeName},
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceNodeName: "node", v1alpha1.HostnameSourceServerName: "server"},
+		"server", false,
+	),
+	Entry("explicit hostname before server name",
+		[]v1alpha1.HostnameSource{v1alpha1.HostnameSourceProviderSpec, v1alpha1.HostnameSourceServerName},
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceProviderSpec: "explicit", v1alpha1.HostnameSourceServerName: "server"},
+		"explicit", false,
+	),
+	Entry("empty explicit hostname falls back to the next source",
+		[]v1alpha1.HostnameSource{v1alpha1.HostnameSourceProviderSpec, v1alpha1.HostnameSourceServerName},
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceServerName: "server"},
+		"server", false,
+	),
+	Entry("no source provides a hostname",
+		[]v1alpha1.HostnameSource{v1alpha1.HostnameSourceProviderSpec},
+		map[v1alpha1.HostnameSource]string{v1alpha1.HostnameSourceNodeName: "node"},
+		"", true,
+	),
+)
+
+var _ = DescribeTable("qualifyHostname",
+	func(domain string, labels map[string]string, expected, expectedErr string) {
+		d := &metalDriver{options: Options{ShootHostnameDomain: domain}}
+		hostname, err := d.qualifyHostname("node", &v1alpha1.ProviderSpec{Labels: labels})
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hostname).To(Equal(expected))
+	},
+	Entry("derives the FQDN from the shoot name", "internal", map[string]string{ShootNameLabelKey: "my-shoot"}, "node.my-shoot.internal", ""),
+	Entry("keeps the hostname without a domain", "", map[string]string{ShootNameLabelKey: "my-shoot"}, "node", ""),
+	Entry("keeps the hostname without a shoot name", "internal", map[string]string{"foo": "bar"}, "node", ""),
+	Entry("rejects an invalid shoot name", "internal", map[string]string{ShootNameLabelKey: "My_Shoot"}, "", `invalid FQDN "node.My_Shoot.internal" derived from shoot "My_Shoot"`),
+	Entry("rejects a too long DNS label", "internal", map[string]string{ShootNameLabelKey: strings.Repeat("a", 64)}, "", "must be no more than 63 characters"),
+)
+
+var _ = Describe("getIPAddressesAnnotationValue", func() {
+	It("should return the IP addresses in CIDR notation per metadata key", func() {
+		Expect(getIPAddressesAnnotationValue(map[string]any{
+			"pool-b": map[string]any{"ip": "10.0.0.2", "prefix": 24, "gateway": "10.0.0.1"},
+			"pool-a": map[string]any{"ip": "2001:db8::2", "prefix": 64, "gateway": "2001:db8::1"},
+		})).To(Equal(`{"pool-a":"2001:db8::2/64","pool-b":"10.0.0.2/24"}`))
+	})
+
+	It("should omit addresses exceeding the maximum annotation size", func() {
+		addressesMetaData := map[string]any{}
+		for i := range 200 {
+			addressesMetaData[fmt.Sprintf("pool-%03d", i)] = map[string]any{"ip": "10.0.0.1", "prefix": 24}
+		}
+
+		value, err := getIPAddressesAnnotationValue(addressesMetaData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(value)).To(BeNumerically("<=", maxIPAddressesAnnotationSize))
+
+		ipAddresses := map[string]string{}
+		Expect(json.Unmarshal([]byte(value), &ipAddresses)).To(Succeed())
+		Expect(ipAddresses).To(HaveKeyWithValue("pool-000", "10.0.0.1/24"))
+		Expect(ipAddresses).NotTo(HaveKey("pool-199"))
+	})
+})
+
+var _ = Describe("Ignition secret name cache", func() {
+	ns, _, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	It("should cache the naming convention of the ignition secret until it is forgotten", func(ctx SpecContext) {
+		machineName := "machine-init-ignition-cache"
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(k8sClient)
+		d := &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: ns.Name,
+		}
+
+		By("resolving the name without a legacy ignition secret")
+		Expect(d.getIgnitionNameForMachine(ctx, machineName, &v1alpha1.ProviderSpec{})).To(Equal(machineName))
+
+		By("creating a legacy ignition secret")
+		legacySecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName + "-ignition",
+				Namespace: ns.Name,
+			},
+		}
+		Expect(k8sClient.Create(ctx, legacySecret)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, legacySecret)
+
+		By("resolving the cached name")
+		Expect(d.getIgnitionNameForMachine(ctx, machineName, &v1alpha1.ProviderSpec{})).To(Equal(machineName))
+
+		By("resolving the legacy name once the cache entry is removed")
+		d.legacyIgnitionNames.Delete(client.ObjectKey{Namespace: ns.Name, Name: machineName})
+		Expect(d.getIgnitionNameForMachine(ctx, machineName, &v1alpha1.ProviderSpec{})).To(Equal(legacySecret.Name))
+
+		By("resolving the name of a machine of the same name in another metal namespace")
+		otherCtx := context.WithValue(ctx, metalNamespaceKey{}, "other-metal-namespace")
+		Expect(d.getIgnitionNameForMachine(otherCtx, machineName, &v1alpha1.ProviderSpec{})).To(Equal(machineName))
+	})
+})
+
+var _ = Describe("InitializeMachine with tenant prefixed ignition secrets", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		IgnitionSecretNamePrefixLabel: ShootNamespaceLabelKey,
+	})
+	machineNamePrefix := "machine-init"
+
+	newTenantProviderSpec := func(tenant string) map[string]any {
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		providerSpec["labels"] = map[string]string{
+			ShootNameLabelKey:      "my-shoot",
+			ShootNamespaceLabelKey: tenant,
+		}
+		return providerSpec
+	}
+
+	It("should compute distinct ignition secret names for machines of different tenants", func(ctx SpecContext) {
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, 8)
+		metalDrv := (*drv).(*metalDriver)
+
+		By("computing the ignition secret names of both tenants")
+		tenantA, err := GetProviderSpec(newMachineClass(v1alpha1.ProviderName, newTenantProviderSpec("tenant-a")), providerSecret, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		tenantB, err := GetProviderSpec(newMachineClass(v1alpha1.ProviderName, newTenantProviderSpec("tenant-b")), providerSecret, Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(metalDrv.getIgnitionNameForMachine(ctx, machineName, tenantA)).To(Equal("tenant-a-" + machineName))
+		Expect(metalDrv.getIgnitionNameForMachine(ctx, machineName, tenantB)).To(Equal("tenant-b-" + machineName))
+	})
+
+	It("should use the tenant prefixed ignition secret name on create, initialize and delete", func(ctx SpecContext) {
+		machineIndex := 9
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		ignitionSecretName := "tenant-a-" + machineName
+		machineClass := newMachineClass(v1alpha1.ProviderName, newTenantProviderSpec("tenant-a"))
+
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineName,
+				Namespace: ns.Name,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: machineClass,
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the tenant prefixed ignition secret has been created and is referenced in ServerClaim")
+		ignition := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      ignitionSecretName,
+			},
+		}
+		Eventually(Get(ignition)).Should(Succeed())
+		Eventually(Object(serverClaim)).Should(HaveField("Spec.IgnitionSecretRef.Name", ignitionSecretName))
+
+		By("deleting the machine")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: machineClass,
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+
+		By("ensuring that the tenant prefixed ignition secret has been deleted")
+		Eventually(Get(ignition)).Should(Satisfy(apierrors.IsNotFound))
+	})
+})
+
+var _ = Describe("InitializeMachine with IPAddressClaims in a separate namespace", func() {
+	const ipamNamespace = "ipam-split"
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		IPAddressClaimNamespace: ipamNamespace,
+	})
+	machineNamePrefix := "machine-init"
+
+	It("should create, validate and delete IPAddressClaims in the IPAM namespace", func(ctx SpecContext) {
+		machineIndex := 10
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating the IPAM namespace")
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ipamNamespace}})).To(Succeed())
+
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+
+		ipClaims := []*capiv1beta1.IPAddressClaim{}
+		for _, pool := range []string{"pool-e", "pool-f"} {
+			ip, ipClaim := newIPRef(machineName, ipamNamespace, pool, providerSpec, "10.11.14.14", "10.11.14.1")
+			Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ip)
+
+			ipClaims = append(ipClaims, ipClaim)
+
+			go func() {
+				defer GinkgoRecover()
+				Eventually(UpdateStatus(ipClaim, func() {
+					ipClaim.Status.AddressRef.Name = ip.Name
+				})).Should(Succeed())
+			}()
+		}
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initialization of the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the IPAddressClaims are bound to the ServerClaim by labels only")
+		for _, ipClaim := range ipClaims {
+			Eventually(Object(ipClaim)).Should(SatisfyAll(
+				HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyServerClaimName, machineName)),
+				HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyServerClaimNamespace, ns.Name)),
+				HaveField("ObjectMeta.OwnerReferences", BeEmpty()),
+			))
+		}
+
+		By("ensuring that the IPAddressClaims are validated across namespaces")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.GetMachineStatusResponse{
+			ProviderID: fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex),
+			NodeName:   machineName,
+		}))
+
+		By("deleting the machine")
+		Expect((*drv).DeleteMachine(ctx, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.DeleteMachineResponse{}))
+
+		By("ensuring that the IPAddressClaims in the IPAM namespace have been deleted")
+		for _, ipClaim := range ipClaims {
+			Eventually(Get(ipClaim)).Should(Satisfy(apierrors.IsNotFound))
+		}
+	})
+})
+
+var _ = Describe("InitializeMachine with a custom managed-by label", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{
+		ManagedBy: "my-driver",
+	})
+	machineNamePrefix := "machine-init"
+
+	It("should set the managed-by label on all created objects", func(ctx SpecContext) {
+		machineIndex := 11
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		ip, ipClaim := newIPRef(machineName, ns.Name, "pool-g", providerSpec, "10.11.15.15", "10.11.15.1")
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+
+		go func() {
+			defer GinkgoRecover()
+			Eventually(UpdateStatus(ipClaim, func() {
+				ipClaim.Status.AddressRef.Name = ip.Name
+			})).Should(Succeed())
+		}()
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initialization of the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the ServerClaim, the IPAddressClaim and the ignition secret carry the managed-by label")
+		ignition := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		for _, obj := range []client.Object{serverClaim, ipClaim, ignition} {
+			Eventually(Object(obj)).Should(HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyManagedBy, "my-driver")))
+		}
+
+		By("ensuring that the machine is listed by the managed-by label")
+		Expect((*drv).ListMachines(ctx, &driver.ListMachinesRequest{
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).To(Equal(&driver.ListMachinesResponse{
+			MachineList: map[string]string{
+				fmt.Sprintf("%s://%s/%s-%d", v1alpha1.ProviderName, ns.Name, machineNamePrefix, machineIndex): machineName,
+			},
+		}))
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup(k8sClient.Delete, ipClaim)
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+var _ = Describe("InitializeMachine with partially applied IPAddressClaims", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-init"
+
+	It("should fix the owner reference and labels of a pre-existing IPAddressClaim on re-initialize", func(ctx SpecContext) {
+		machineIndex := 15
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		ip, ipClaim := newIPRef(machineName, ns.Name, "pool-h", providerSpec, "10.11.16.16", "10.11.16.1")
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("creating the IPAddressClaim with a stale owner reference and without labels as left by an interrupted initialization")
+		ipClaim.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: metalv1alpha1.GroupVersion.String(),
+			Kind:       "ServerClaim",
+			Name:       machineName,
+			UID:        "stale-uid",
+		}}
+		ipClaim.Spec.PoolRef = corev1.TypedLocalObjectReference{
+			APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+			Kind:     "GlobalInClusterIPPool",
+			Name:     ipClaim.Name,
+		}
+		Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ipClaim)
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = ip.Name
+		})).Should(Succeed())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("re-initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the IPAddressClaim has been fixed")
+		Eventually(Object(ipClaim)).Should(SatisfyAll(
+			HaveField("ObjectMeta.Labels", map[string]string{
+				validation.LabelKeyServerClaimName:      machineName,
+				validation.LabelKeyServerClaimNamespace: ns.Name,
+				validation.LabelKeyManagedBy:            ManagedByLabelValue,
+			}),
+			HaveField("ObjectMeta.OwnerReferences", ConsistOf(
+				metav1.OwnerReference{
+					APIVersion: metalv1alpha1.GroupVersion.String(),
+					Kind:       "ServerClaim",
+					Name:       serverClaim.Name,
+					UID:        serverClaim.UID,
+				},
+			)),
+		))
+
+		By("ensuring that the machine status is valid")
+		Expect((*drv).GetMachineStatus(ctx, &driver.GetMachineStatusRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+
+		By("ensuring the cleanup of the machine")
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+	})
+})
+
+// getIgnitionMetadata returns the content of the metadata file of the ignition in the secret
+func getIgnitionMetadata(secret *corev1.Secret) map[string]any {
+	rendered := struct {
+		Storage struct {
+			Files []struct {
+				Path     string `json:"path"`
+				Contents struct {
+					Source string `json:"source"`
+				} `json:"contents"`
+			} `json:"files"`
+		} `json:"storage"`
+	}{}
+	Expect(json.Unmarshal(secret.Data["ignition"], &rendered)).To(Succeed())
+
+	for _, file := range rendered.Storage.Files {
+		if file.Path != "/var/lib/metal-cloud-config/metadata" {
+			continue
+		}
+		var content []byte
+		if data, ok := strings.CutPrefix(file.Contents.Source, "data:;base64,"); ok {
+			decoded, err := base64.StdEncoding.DecodeString(data)
+			Expect(err).NotTo(HaveOccurred())
+			content = decoded
+		} else {
+			decoded, err := url.PathUnescape(strings.TrimPrefix(file.Contents.Source, "data:,"))
+			Expect(err).NotTo(HaveOccurred())
+			content = []byte(decoded)
+		}
+		metadata := map[string]any{}
+		Expect(json.Unmarshal(content, &metadata)).To(Succeed())
+		return metadata
+	}
+	Fail("ignition does not contain a metadata file")
+	return nil
+}
+
+var _ = Describe("Ignition metadata precedence", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should merge the provider spec metadata with the computed metadata",
+		func(ctx SpecContext, userMetadataPrecedence bool, expectedLoopbackAddress, expectedPool any) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+				options:        Options{UserMetadataPrecedence: userMetadataPrecedence},
+			}
+
+			secret, err := d.generateIgnitionSecret(ctx, &driver.InitializeMachineRequest{
+				Machine: newMachine(ns, "machine-init", 16, nil),
+				Secret:  providerSecret,
+			}, "my-host", &v1alpha1.ProviderSpec{
+				Metadata: map[string]any{
+					"loopbackAddress": "user-loopback",
+					"pool":            "user-pool",
+					"foo":             "bar",
+				},
+			}, map[string]any{
+				"pool": map[string]any{"ip": "10.11.19.19", "prefix": 24, "gateway": "10.11.19.1"},
+			}, &ServerMetadata{LoopbackAddress: net.ParseIP("2001:db8::1")})
+			Expect(err).NotTo(HaveOccurred())
+
+			metadata := getIgnitionMetadata(secret)
+			Expect(metadata).To(HaveKeyWithValue("loopbackAddress", expectedLoopbackAddress))
+			Expect(metadata).To(HaveKeyWithValue("pool", expectedPool))
+			Expect(metadata).To(HaveKeyWithValue("foo", "bar"))
+		},
+		Entry("computed metadata first", false, "2001:db8::1", map[string]any{"ip": "10.11.19.19", "prefix": float64(24), "gateway": "10.11.19.1"}),
+		Entry("user metadata first", true, "user-loopback", "user-pool"),
+	)
+})
+
+var _ = Describe("Ignition metadata size", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should validate the serialized metadata size",
+		func(ctx SpecContext, maxMetadataSize int, expectedErr string) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+				options:        Options{MaxMetadataSize: maxMetadataSize},
+			}
+
+			// the serialized metadata {"foo":"bar"} has 13 bytes
+			secret, err := d.generateIgnitionSecret(ctx, &driver.InitializeMachineRequest{
+				Machine: newMachine(ns, "machine-init", 16, nil),
+				Secret:  providerSecret,
+			}, "my-host", &v1alpha1.ProviderSpec{
+				Metadata: map[string]any{"foo": "bar"},
+			}, nil, nil)
+			if expectedErr != "" {
+				Expect(err).To(MatchError(expectedErr))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getIgnitionMetadata(secret)).To(HaveKeyWithValue("foo", "bar"))
+		},
+		Entry("at the maximum size", 13, ""),
+		Entry("without a maximum size", 0, ""),
+		Entry("above the maximum size", 12, `serialized metadata of machine "machine-init-16" has 13 bytes which exceeds the maximum metadata size of 12 bytes`),
+	)
+})
+
+var _ = Describe("Ignition secret key", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should store the ignition under the configured key",
+		func(ctx SpecContext, ignitionSecretKey, expectedKey string) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+			}
+
+			secret, err := d.generateIgnitionSecret(ctx, &driver.InitializeMachineRequest{
+				Machine: newMachine(ns, "machine-init", 16, nil),
+				Secret:  providerSecret,
+			}, "my-host", &v1alpha1.ProviderSpec{
+				IgnitionSecretKey: ignitionSecretKey,
+			}, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(HaveLen(1))
+			Expect(secret.Data).To(HaveKeyWithValue(expectedKey, Not(BeEmpty())))
+		},
+		Entry("default key", "", v1alpha1.DefaultIgnitionKey),
+		Entry("custom key", "config.ign", "config.ign"),
+	)
+})
+
+var _ = Describe("Additional user data", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	generateIgnitionSecret := func(ctx SpecContext, data map[string][]byte) (*corev1.Secret, error) {
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(k8sClient)
+		d := &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: ns.Name,
+		}
+
+		secret := providerSecret.DeepCopy()
+		maps.Copy(secret.Data, data)
+		return d.generateIgnitionSecret(ctx, &driver.InitializeMachineRequest{
+			Machine: newMachine(ns, "machine-init", 16, nil),
+			Secret:  secret,
+		}, "my-host", &v1alpha1.ProviderSpec{
+			AdditionalUserDataKeys: []string{"extraUserData"},
+		}, nil, nil)
+	}
+
+	It("should merge the additional user data into the ignition", func(ctx SpecContext) {
+		secret, err := generateIgnitionSecret(ctx, map[string][]byte{
+			"extraUserData": []byte("storage:\n  files:\n  - path: /etc/extra\n    contents:\n      inline: extra\n"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(secret.Data[v1alpha1.DefaultIgnitionKey])).To(ContainSubstring(`"path":"/etc/extra"`))
+	})
+
+	It("should fail if an additional user data key is missing", func(ctx SpecContext) {
+		_, err := generateIgnitionSecret(ctx, nil)
+		Expect(err).To(MatchError(fmt.Sprintf(`failed to find additional user data key "extraUserData" in Secret %q`, client.ObjectKeyFromObject(providerSecret))))
+	})
+})
+
+var _ = Describe("InitializeMachine with an expected IP family", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-init"
+
+	// initializeMachine initializes a machine whose single IPAMConfig expects the family and is bound to the address
+	initializeMachine := func(ctx SpecContext, machineIndex int, family v1alpha1.IPFamily, address, gateway string) error {
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("test-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		ip, ipClaim := newIPRef(machineName, ns.Name, "pool-i", providerSpec, address, gateway)
+		providerSpec["ipamConfig"].([]v1alpha1.IPAMConfig)[0].IPFamily = family
+		Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ip)
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+
+		By("creating a bound IPAddressClaim")
+		ipClaim.Spec.PoolRef = corev1.TypedLocalObjectReference{
+			APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+			Kind:     "GlobalInClusterIPPool",
+			Name:     ipClaim.Name,
+		}
+		Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ipClaim)
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = ip.Name
+		})).Should(Succeed())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		return err
+	}
+
+	It("should initialize the machine if the allocated address matches the IP family", func(ctx SpecContext) {
+		Expect(initializeMachine(ctx, 17, v1alpha1.IPFamilyIPv6, "2001:db8::17", "2001:db8::1")).To(Succeed())
+	})
+
+	It("should fail the initialization if the allocated address does not match the IP family", func(ctx SpecContext) {
+		Expect(initializeMachine(ctx, 18, v1alpha1.IPFamilyIPv6, "10.11.18.18", "10.11.18.1")).To(MatchError(SatisfyAll(
+			ContainSubstring("code = [Internal]"),
+			ContainSubstring("address 10.11.18.18 is of IP family ipv4, expected ipv6"),
+		)))
+	})
+})
+
+var _ = Describe("InitializeMachine with a stale AddressRef", func() {
+	ns, providerSecret, drv := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-init"
+
+	It("should reinitialize if the IPAddressClaim references a missing IPAddress", func(ctx SpecContext) {
+		machineIndex := 20
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("test-server-%d", machineIndex),
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "12345",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		providerSpec := maps.Clone(testing.SampleProviderSpec)
+		_, ipClaim := newIPRef(machineName, ns.Name, "pool-j", providerSpec, "10.11.20.20", "10.11.20.1")
+
+		By("creating machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+
+		By("creating an IPAddressClaim bound to a missing IPAddress")
+		ipClaim.Spec.PoolRef = corev1.TypedLocalObjectReference{
+			APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+			Kind:     "GlobalInClusterIPPool",
+			Name:     ipClaim.Name,
+		}
+		Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ipClaim)
+		Eventually(UpdateStatus(ipClaim, func() {
+			ipClaim.Status.AddressRef.Name = "missing-address"
+		})).Should(Succeed())
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("failing the initialization with a hint to recreate the IPAddressClaim")
+		_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, providerSpec),
+			Secret:       providerSecret,
+		})
+		Expect(err).To(MatchError(status.Error(codes.Uninitialized, fmt.Sprintf(
+			`failed to collect IPAddress metadata: IPAddressClaim %s/%s references the missing IPAddress "missing-address", delete the IPAddressClaim to have it recreated: stale AddressRef`,
+			ns.Name, ipClaim.Name))))
+	})
+})
+
+var _ = DescribeTable("validateIPFamily",
+	func(family v1alpha1.IPFamily, address string, expectedErr string) {
+		err := validateIPFamily(family, address)
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(expectedErr))
+		}
+	},
+	Entry("should accept any address without a family", v1alpha1.IPFamily(""), "2001:db8::1", ""),
+	Entry("should accept an IPv4 address for ipv4", v1alpha1.IPFamilyIPv4, "10.0.0.1", ""),
+	Entry("should accept an IPv6 address for ipv6", v1alpha1.IPFamilyIPv6, "2001:db8::1", ""),
+	Entry("should accept an IPv4-mapped IPv6 address for ipv4", v1alpha1.IPFamilyIPv4, "::ffff:10.0.0.1", ""),
+	Entry("should reject an IPv6 address for ipv4", v1alpha1.IPFamilyIPv4, "2001:db8::1", "address 2001:db8::1 is of IP family ipv6, expected ipv4"),
+	Entry("should reject an IPv4 address for ipv6", v1alpha1.IPFamilyIPv6, "10.0.0.1", "address 10.0.0.1 is of IP family ipv4, expected ipv6"),
+)
+
+var _ = Describe("Ignition metadata creation timestamp", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineCreated := metav1.NewTime(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	serverClaimCreated := metav1.NewTime(time.Date(2024, 5, 6, 7, 10, 0, 0, time.FixedZone("CEST", 2*60*60)))
+
+	DescribeTable("should add the creation timestamp to the metadata",
+		func(ctx SpecContext, propagate bool, machineCreationTimestamp metav1.Time, expectedCreatedAt string) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+			}
+
+			machine := newMachine(ns, "machine-init", 19, nil)
+			machine.CreationTimestamp = machineCreationTimestamp
+			secret, err := d.generateIgnitionSecret(ctx, &driver.InitializeMachineRequest{
+				Machine: machine,
+				Secret:  providerSecret,
+			}, "my-host", &v1alpha1.ProviderSpec{
+				Metadata:                   map[string]any{"foo": "bar"},
+				PropagateCreationTimestamp: propagate,
+			}, nil, &ServerMetadata{ServerClaimCreationTimestamp: serverClaimCreated})
+			Expect(err).NotTo(HaveOccurred())
+
+			metadata := getIgnitionMetadata(secret)
+			if expectedCreatedAt == "" {
+				Expect(metadata).NotTo(HaveKey("createdAt"))
+				return
+			}
+			Expect(metadata).To(HaveKeyWithValue("createdAt", expectedCreatedAt))
+			_, err = time.Parse(time.RFC3339, metadata["createdAt"].(string))
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("from the Machine", true, machineCreated, "2024-05-06T07:08:09Z"),
+		Entry("from the ServerClaim if the Machine has none", true, metav1.Time{}, "2024-05-06T05:10:00Z"),
+		Entry("not if disabled", false, machineCreated, ""),
+	)
+})
+
+var _ = Describe("IPAM pool metadata", func() {
+	ns, _, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should add the pool name to the IP address metadata",
+		func(ctx SpecContext, enabled bool, expected map[string]any) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+				options:        Options{IPAMPoolMetadata: enabled},
+			}
+
+			By("creating a bound IPAddressClaim")
+			machine := newMachine(ns, "machine-init", 21, nil)
+			ip, ipClaim := newIPRef(machine.Name, ns.Name, "pool-e", nil, "10.11.21.21", "10.11.21.1")
+			Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ip)
+			Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ipClaim)
+			Eventually(UpdateStatus(ipClaim, func() {
+				ipClaim.Status.AddressRef.Name = ip.Name
+			})).Should(Succeed())
+
+			By("collecting the IP address metadata")
+			addressesMetaData, err := d.collectIPAddressClaimsMetadata(ctx, &driver.InitializeMachineRequest{Machine: machine}, &v1alpha1.ProviderSpec{
+				IPAMConfig: []v1alpha1.IPAMConfig{{
+					MetadataKey: "pool-e",
+					IPAMRef: &v1alpha1.IPAMObjectReference{
+						APIGroup: "ipam.cluster.x-k8s.io",
+						Kind:     "GlobalInClusterIPPool",
+						Name:     "my-pool",
+					},
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addressesMetaData).To(HaveKeyWithValue("pool-e", expected))
+		},
+		Entry("enabled", true, map[string]any{"ip": "10.11.21.21", "prefix": 24, "gateway": "10.11.21.1", "pool": "my-pool"}),
+		Entry("disabled", false, map[string]any{"ip": "10.11.21.21", "prefix": 24, "gateway": "10.11.21.1"}),
+	)
+})
+
+var _ = Describe("IPAddressClaim name collisions", func() {
+	ns, _, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	It("should fail if the IPAddressClaim name collides with the one of another machine", func(ctx SpecContext) {
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(k8sClient)
+		d := &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: ns.Name,
+		}
+		newProviderSpec := func(metadataKey string) *v1alpha1.ProviderSpec {
+			return &v1alpha1.ProviderSpec{IPAMConfig: []v1alpha1.IPAMConfig{{
+				MetadataKey: metadataKey,
+				IPAMRef: &v1alpha1.IPAMObjectReference{
+					APIGroup: "ipam.cluster.x-k8s.io",
+					Kind:     "GlobalInClusterIPPool",
+					Name:     "pool",
+				},
+			}}}
+		}
+
+		By("creating the IPAddressClaim of the first machine")
+		Expect(d.createIPAddressClaims(ctx, "machine-collide", nil, newProviderSpec("a-pool"))).To(Succeed())
+		ipClaim := &capiv1beta1.IPAddressClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "machine-collide-a-pool",
+				Namespace: ns.Name,
+			},
+		}
+		DeferCleanup(k8sClient.Delete, ipClaim)
+
+		By("creating the IPAddressClaim of the second machine with a colliding name")
+		Expect(d.createIPAddressClaims(ctx, "machine-collide-a", nil, newProviderSpec("pool"))).To(MatchError(
+			fmt.Sprintf(`IPAddressClaim "%s/machine-collide-a-pool" already exists for machine "machine-collide" in namespace %q, the name collides for machine "machine-collide-a"`, ns.Name, ns.Name)))
+
+		By("ensuring that the IPAddressClaim still belongs to the first machine")
+		Consistently(Object(ipClaim)).Should(HaveField("ObjectMeta.Labels", HaveKeyWithValue(validation.LabelKeyServerClaimName, "machine-collide")))
+
+		By("ensuring that the first machine can still apply its IPAddressClaim")
+		Expect(d.createIPAddressClaims(ctx, "machine-collide", nil, newProviderSpec("a-pool"))).To(Succeed())
+	})
+})
+
+var _ = Describe("IPAM pre-flight check", func() {
+	providerSpec := &v1alpha1.ProviderSpec{IPAMConfig: []v1alpha1.IPAMConfig{{
+		MetadataKey: "pool",
+		IPAMRef: &v1alpha1.IPAMObjectReference{
+			APIGroup: "ipam.cluster.x-k8s.io",
+			Kind:     "GlobalInClusterIPPool",
+			Name:     "pool",
+		},
+	}}}
+
+	It("should fail with a descriptive error if the IPAddressClaim CRD is not installed", func(ctx SpecContext) {
+		By("creating a client whose discovery does not know the IPAM API")
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(fake.NewClientBuilder().
+			WithScheme(k8sClient.Scheme()).
+			WithRESTMapper(meta.NewDefaultRESTMapper(nil)).
+			Build())
+		d := &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: "default",
+		}
+
+		Expect(d.createIPAddressClaims(ctx, "machine-preflight", nil, providerSpec)).To(MatchError(
+			"IPAM is configured but the CRD ipaddressclaims.ipam.cluster.x-k8s.io/v1beta1 is not installed in the metal cluster"))
+		Expect(d.ipamAvailable.Load()).To(BeFalse())
+	})
+
+	It("should remember that the IPAddressClaim CRD is installed", func() {
+		clientProvider := &mcmclient.Provider{}
+		clientProvider.SetClient(k8sClient)
+		d := &metalDriver{
+			clientProvider: clientProvider,
+			metalNamespace: "default",
+		}
+
+		Expect(d.ensureIPAMAvailable()).To(Succeed())
+		Expect(d.ipamAvailable.Load()).To(BeTrue())
+	})
+})
+
+var _ = Describe("Ignition secret apply conflicts", func() {
+	ns, _, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should handle a conflicting field manager of the ignition secret",
+		func(ctx SpecContext, conflictDetection bool, name string) {
+			By("applying the ignition secret with another field manager")
+			foreign := &corev1.Secret{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: corev1.SchemeGroupVersion.String(),
+					Kind:       "Secret",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ns.Name,
+				},
+				Data: map[string][]byte{"ignition": []byte("foreign")},
+			}
+			Expect(k8sClient.Patch(ctx, foreign, client.Apply, client.FieldOwner("other-manager"))).To(Succeed())
+
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+				options:        Options{IgnitionSecretConflictDetection: conflictDetection},
+			}
+
+			By("applying the ignition secret with the driver")
+			ignitionSecret := &corev1.Secret{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: corev1.SchemeGroupVersion.String(),
+					Kind:       "Secret",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ns.Name,
+				},
+				Data: map[string][]byte{"ignition": []byte("driver")},
+			}
+			err := d.applyIgnitionSecret(ctx, ignitionSecret)
+
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns.Name}}
+			if conflictDetection {
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("ignition Secret \"%s/%s\" is co-managed and conflicts with another field manager", ns.Name, name))))
+				Expect(apierrors.IsConflict(errors.Unwrap(err))).To(BeTrue())
+				Eventually(Object(secret)).Should(HaveField("Data", HaveKeyWithValue("ignition", []byte("foreign"))))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(Object(secret)).Should(HaveField("Data", HaveKeyWithValue("ignition", []byte("driver"))))
+		},
+		Entry("forces the ownership by default", false, "ignition-conflict-force"),
+		Entry("surfaces the conflict if the conflict detection is enabled", true, "ignition-conflict-detect"),
+	)
+})
+
+var _ = DescribeTable("validatePrefix",
+	func(address string, prefix int, expectedErr string) {
+		err := validatePrefix(address, prefix)
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(expectedErr))
+		}
+	},
+	Entry("should accept a valid IPv4 prefix", "10.0.0.1", 24, ""),
+	Entry("should accept a valid IPv6 prefix", "2001:db8::1", 64, ""),
+	Entry("should accept a host prefix", "2001:db8::1", 128, ""),
+	Entry("should accept an IPv4 prefix of an IPv4-mapped IPv6 address", "::ffff:10.0.0.1", 32, ""),
+	Entry("should reject a zero prefix", "10.0.0.1", 0, "prefix 0 of address 10.0.0.1 is out of the range 1-32, the IPAM pool may be misconfigured"),
+	Entry("should reject an IPv4 prefix above 32", "10.0.0.1", 64, "prefix 64 of address 10.0.0.1 is out of the range 1-32, the IPAM pool may be misconfigured"),
+	Entry("should reject an IPv6 prefix above 128", "2001:db8::1", 129, "prefix 129 of address 2001:db8::1 is out of the range 1-128, the IPAM pool may be misconfigured"),
+)
+
+var _ = Describe("InitializeMachine with initialize retries", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-init"
+
+	DescribeTable("should retry a step failing with a transient error",
+		func(ctx SpecContext, machineIndex, retries int, expectSuccess bool) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+			By("creating a driver with a client failing to power on the server once")
+			watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+			Expect(err).NotTo(HaveOccurred())
+			var failed atomic.Bool
+			failingClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if serverClaim, ok := obj.(*metalv1alpha1.ServerClaim); ok && serverClaim.Spec.Power == metalv1alpha1.PowerOn && failed.CompareAndSwap(false, true) {
+						return apierrors.NewConflict(metalv1alpha1.GroupVersion.WithResource("serverclaims").GroupResource(), serverClaim.Name, errors.New("injected conflict"))
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			})
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(failingClient)
+			drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerClaimName, Options{InitializeRetries: retries})
+
+			By("creating a server")
+			server := &metalv1alpha1.Server{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("retry-server-%d", machineIndex),
+				},
+				Spec: metalv1alpha1.ServerSpec{
+					SystemUUID: "retry",
+				},
+			}
+			Expect(k8sClient.Create(ctx, server)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, server)
+
+			By("creating the machine")
+			_, err = drv.CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(drv.DeleteMachine, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+
+			By("patching ServerClaim with ServerRef")
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			Eventually(Update(serverClaim, func() {
+				serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+			})).Should(Succeed())
+
+			By("initializing the machine")
+			_, err = drv.InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(failed.Load()).To(BeTrue())
+			if !expectSuccess {
+				Expect(err).To(MatchError(ContainSubstring("failed to update ignition and power on server")))
+				Expect(err).To(MatchError(ContainSubstring("injected conflict")))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(Object(serverClaim)).Should(HaveField("Spec.Power", metalv1alpha1.PowerOn))
+		},
+		Entry("without retries", 22, 0, false),
+		Entry("with a retry", 23, 1, true),
+	)
+})
+
+var _ = Describe("InitializeMachine with server annotations", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-init"
+	serverAnnotations := map[string]string{"example.org/provisioned-by": "mcm"}
+
+	DescribeTable("should annotate the Server if permitted",
+		func(ctx SpecContext, machineIndex int, forbidden bool) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+			By("creating a driver with a client which may be forbidden to patch Servers")
+			watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme.Scheme})
+			Expect(err).NotTo(HaveOccurred())
+			restrictedClient := interceptor.NewClient(watchClient, interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if _, ok := obj.(*metalv1alpha1.Server); ok && forbidden {
+						return apierrors.NewForbidden(metalv1alpha1.GroupVersion.WithResource("servers").GroupResource(), obj.GetName(), errors.New("injected forbidden"))
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			})
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(restrictedClient)
+			drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerClaimName, Options{ServerAnnotations: serverAnnotations})
+
+			By("creating a server")
+			server := &metalv1alpha1.Server{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("annotated-server-%d", machineIndex),
+				},
+				Spec: metalv1alpha1.ServerSpec{
+					SystemUUID: "annotated",
+				},
+			}
+			Expect(k8sClient.Create(ctx, server)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, server)
+
+			By("creating the machine")
+			_, err = drv.CreateMachine(ctx, &driver.CreateMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(drv.DeleteMachine, &driver.DeleteMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+
+			By("patching ServerClaim with ServerRef")
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+				},
+			}
+			Eventually(Update(serverClaim, func() {
+				serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+			})).Should(Succeed())
+
+			By("initializing the machine")
+			_, err = drv.InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			if forbidden {
+				Expect(Object(server)()).To(HaveField("ObjectMeta.Annotations", Not(HaveKey("example.org/provisioned-by"))))
+				return
+			}
+			Eventually(Object(server)).Should(HaveField("ObjectMeta.Annotations", HaveKeyWithValue("example.org/provisioned-by", "mcm")))
+		},
+		Entry("with permission to patch Servers", 24, false),
+		Entry("without permission to patch Servers", 25, true),
+	)
+})
+
+var _ = Describe("InitializeMachine with ignition secret owner references", func() {
+	ns, providerSecret, drv := SetupTestWithOptions(cmd.NodeNamePolicyServerClaimName, Options{IgnitionSecretOwnerReference: true})
+	machineNamePrefix := "machine-init"
+
+	It("should let the ServerClaim own the ignition secret", func(ctx SpecContext) {
+		machineIndex := 26
+		machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+		By("creating a server")
+		server := &metalv1alpha1.Server{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "owned-ignition-server",
+			},
+			Spec: metalv1alpha1.ServerSpec{
+				SystemUUID: "owned-ignition",
+			},
+		}
+		Expect(k8sClient.Create(ctx, server)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, server)
+
+		By("creating the machine")
+		Expect((*drv).CreateMachine(ctx, &driver.CreateMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})).NotTo(BeNil())
+		DeferCleanup((*drv).DeleteMachine, &driver.DeleteMachineRequest{
+			Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+			MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+			Secret:       providerSecret,
+		})
+
+		By("patching ServerClaim with ServerRef")
+		serverClaim := &metalv1alpha1.ServerClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Update(serverClaim, func() {
+			serverClaim.Spec.ServerRef = &corev1.LocalObjectReference{Name: server.Name}
+		})).Should(Succeed())
+
+		By("initializing the machine")
+		Eventually(func(g Gomega) {
+			_, err := (*drv).InitializeMachine(ctx, &driver.InitializeMachineRequest{
+				Machine:      newMachine(ns, machineNamePrefix, machineIndex, nil),
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+		}).Should(Succeed())
+
+		By("ensuring that the ignition secret is owned by the ServerClaim")
+		ignition := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      machineName,
+			},
+		}
+		Eventually(Object(ignition)).Should(HaveField("ObjectMeta.OwnerReferences", ConsistOf(
+			metav1.OwnerReference{
+				APIVersion: metalv1alpha1.GroupVersion.String(),
+				Kind:       "ServerClaim",
+				Name:       serverClaim.Name,
+				UID:        serverClaim.UID,
+			},
+		)))
+	})
+})
+
+var _ = Describe("IPAM metadata defaults", func() {
+	ns, _, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+
+	DescribeTable("should fill in the gateway and prefix the IPAddress does not specify",
+		func(ctx SpecContext, machineIndex int, prefix int, gateway string, expected map[string]any) {
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			d := &metalDriver{
+				clientProvider: clientProvider,
+				metalNamespace: ns.Name,
+			}
+
+			By("creating a bound IPAddressClaim")
+			machine := newMachine(ns, "machine-init", machineIndex, nil)
+			ip, ipClaim := newIPRef(machine.Name, ns.Name, "pool-f", nil, "10.11.27.27", gateway)
+			ip.Name = fmt.Sprintf("%s-%d", ip.Name, machineIndex)
+			ip.Spec.Prefix = prefix
+			Expect(k8sClient.Create(ctx, ip)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ip)
+			Expect(k8sClient.Create(ctx, ipClaim)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ipClaim)
+			Eventually(UpdateStatus(ipClaim, func() {
+				ipClaim.Status.AddressRef.Name = ip.Name
+			})).Should(Succeed())
+
+			By("collecting the IP address metadata")
+			addressesMetaData, err := d.collectIPAddressClaimsMetadata(ctx, &driver.InitializeMachineRequest{Machine: machine}, &v1alpha1.ProviderSpec{
+				IPAMConfig: []v1alpha1.IPAMConfig{{
+					MetadataKey: "pool-f",
+					IPAMRef: &v1alpha1.IPAMObjectReference{
+						APIGroup: "ipam.cluster.x-k8s.io",
+						Kind:     "GlobalInClusterIPPool",
+						Name:     "my-pool",
+					},
+					DefaultGateway: "10.11.27.254",
+					DefaultPrefix:  22,
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addressesMetaData).To(HaveKeyWithValue("pool-f", expected))
+		},
+		Entry("if both are missing", 27, 0, "", map[string]any{"ip": "10.11.27.27", "prefix": 22, "gateway": "10.11.27.254"}),
+		Entry("not if both are specified", 28, 24, "10.11.27.1", map[string]any{"ip": "10.11.27.27", "prefix": 24, "gateway": "10.11.27.1"}),
+	)
+})
@@ -7,11 +7,13 @@ import (
 	"context"
 	"fmt"
 	"maps"
+	"slices"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	apiv1alpha1 "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -29,23 +31,36 @@ func (d *metalDriver) ListMachines(ctx context.Context, req *driver.ListMachines
 	klog.V(3).Infof("Machine list request has been received for %q", req.MachineClass.Name)
 	defer klog.V(3).Infof("Machine list request has been processed for %q", req.MachineClass.Name)
 
-	providerSpec, err := GetProviderSpec(req.MachineClass, req.Secret)
+	providerSpec, err := GetProviderSpec(req.MachineClass, req.Secret, d.options)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get provider spec: %v", err))
 	}
 
-	serverClaimList := &metalv1alpha1.ServerClaimList{}
 	matchingLabels := client.MatchingLabels{}
 	maps.Copy(matchingLabels, providerSpec.Labels)
+	// only list ServerClaims created by the driver to protect foreign ServerClaims from the orphan collection
+	matchingLabels[validation.LabelKeyManagedBy] = d.getManagedByLabelValue()
 
-	if err = d.clientProvider.SyncClient(func(metalClient client.Client) error {
-		return metalClient.List(ctx, serverClaimList, client.InNamespace(d.metalNamespace), matchingLabels)
-	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	// Machines may override the metal namespace, so the ServerClaims of all allowed metal namespaces are listed
+	namespaces := append([]string{d.metalNamespace}, d.options.AllowedMetalNamespaces...)
+	slices.Sort(namespaces)
+	var serverClaims []metalv1alpha1.ServerClaim
+	for _, namespace := range slices.Compact(namespaces) {
+		serverClaimList := &metalv1alpha1.ServerClaimList{}
+		if err = d.clientProvider.SyncClient(func(metalClient client.Client) error {
+			return metalClient.List(ctx, serverClaimList, client.InNamespace(namespace), matchingLabels)
+		}); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		serverClaims = append(serverClaims, serverClaimList.Items...)
 	}
 
-	machineList := make(map[string]string, len(serverClaimList.Items))
-	for _, machine := range serverClaimList.Items {
+	machineList := make(map[string]string, len(serverClaims))
+	for _, machine := range serverClaims {
+		if d.options.ExcludeDeletingServerClaims && !machine.DeletionTimestamp.IsZero() {
+			klog.V(3).Infof("Excluding ServerClaim %q in namespace %q from the machine list as it is being deleted", machine.Name, machine.Namespace)
+			continue
+		}
 		machineID := getProviderIDForServerClaim(&machine)
 		machineList[machineID] = machine.Name
 	}
@@ -8,15 +8,19 @@ import (
 
 	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/driver"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
 	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/v1alpha1"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/api/validation"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
 	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/metal/testing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
 var _ = Describe("ListMachines", func() {
@@ -168,3 +172,60 @@ var _ = Describe("ListMachines", func() {
 		})
 	})
 })
+
+var _ = Describe("ListMachines with a deleting ServerClaim", func() {
+	ns, providerSecret, _ := SetupTest(cmd.NodeNamePolicyServerClaimName)
+	machineNamePrefix := "machine-list"
+
+	DescribeTable("should list a ServerClaim whose deletion is in progress depending on the options",
+		func(ctx SpecContext, machineIndex int, options Options, expectListed bool) {
+			machineName := fmt.Sprintf("%s-%d", machineNamePrefix, machineIndex)
+
+			By("creating a ServerClaim with a finalizer")
+			serverClaim := &metalv1alpha1.ServerClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.Name,
+					Name:      machineName,
+					Labels: map[string]string{
+						"shoot-name":                 "my-shoot",
+						"shoot-namespace":            "my-shoot-namespace",
+						validation.LabelKeyManagedBy: ManagedByLabelValue,
+					},
+					Finalizers: []string{"example.org/test"},
+				},
+				Spec: metalv1alpha1.ServerClaimSpec{
+					Power: metalv1alpha1.PowerOff,
+				},
+			}
+			Expect(k8sClient.Create(ctx, serverClaim)).To(Succeed())
+			DeferCleanup(func(ctx SpecContext) {
+				Expect(Update(serverClaim, func() {
+					controllerutil.RemoveFinalizer(serverClaim, "example.org/test")
+				})()).To(Succeed())
+			})
+
+			By("deleting the ServerClaim")
+			Expect(k8sClient.Delete(ctx, serverClaim)).To(Succeed())
+			Eventually(Object(serverClaim)).Should(HaveField("DeletionTimestamp", Not(BeNil())))
+
+			By("listing the machines")
+			clientProvider := &mcmclient.Provider{}
+			clientProvider.SetClient(k8sClient)
+			drv := NewDriver(clientProvider, ns.Name, cmd.NodeNamePolicyServerClaimName, options)
+			listMachineResponse, err := drv.ListMachines(ctx, &driver.ListMachinesRequest{
+				MachineClass: newMachineClass(v1alpha1.ProviderName, testing.SampleProviderSpec),
+				Secret:       providerSecret,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			providerID := fmt.Sprintf("%s://%s/%s", v1alpha1.ProviderName, ns.Name, machineName)
+			if expectListed {
+				Expect(listMachineResponse.MachineList).To(HaveKeyWithValue(providerID, machineName))
+			} else {
+				Expect(listMachineResponse.MachineList).NotTo(HaveKey(providerID))
+			}
+		},
+		Entry("should include the deleting ServerClaim by default", 4, Options{}, true),
+		Entry("should exclude the deleting ServerClaim if enabled", 5, Options{ExcludeDeletingServerClaims: true}, false),
+	)
+})
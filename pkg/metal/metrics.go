@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/codes"
+	"github.com/gardener/machine-controller-manager/pkg/util/provider/machinecodes/status"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DeletionReasonRecreate marks the deletion of a machine which is recreated by the machine controller,
+	// e.g. because its ServerClaim could not be bound
+	DeletionReasonRecreate = "recreate"
+	// DeletionReasonScaleIn marks the deletion of a machine which is not recreated, e.g. on a scale-in
+	DeletionReasonScaleIn = "scale-in"
+
+	// OperationCreate is the CreateMachine operation of the driver
+	OperationCreate = "create"
+	// OperationInitialize is the InitializeMachine operation of the driver
+	OperationInitialize = "initialize"
+	// OperationDelete is the DeleteMachine operation of the driver
+	OperationDelete = "delete"
+	// OperationGetStatus is the GetMachineStatus operation of the driver
+	OperationGetStatus = "get_status"
+)
+
+// machineDeletions counts the deleted machines partitioned by the deletion reason.
+// It is registered at the default registry which is served by the machine controller manager.
+var machineDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mcm",
+	Subsystem: "metal",
+	Name:      "machine_deletions_total",
+	Help:      "Number of deleted machines, partitioned by the deletion reason (recreate or scale-in).",
+}, []string{"reason"})
+
+// machineProvisioningDuration observes the time from the creation of a machine until it is reported ready for the first time
+var machineProvisioningDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "mcm",
+	Subsystem: "metal",
+	Name:      "machine_provisioning_duration_seconds",
+	Help:      "Time from the creation of a machine until it is reported ready for the first time.",
+	Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+})
+
+// machineOperations counts the operations of the driver partitioned by the operation, the returned code and the node name
+// policy of the machine
+var machineOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mcm",
+	Subsystem: "metal",
+	Name:      "machine_operations_total",
+	Help:      "Number of machine operations, partitioned by the operation, the returned code and the node name policy.",
+}, []string{"operation", "code", "node_name_policy"})
+
+// machineOperationDuration observes the duration of the operations of the driver
+var machineOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "mcm",
+	Subsystem: "metal",
+	Name:      "machine_operation_duration_seconds",
+	Help:      "Duration of machine operations, partitioned by the operation, the returned code and the node name policy.",
+	Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+}, []string{"operation", "code", "node_name_policy"})
+
+// pendingServerClaimsGauge reports the number of ServerClaims which await the binding of a server
+var pendingServerClaimsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "mcm",
+	Subsystem: "metal",
+	Name:      "pending_server_claims",
+	Help:      "Number of ServerClaims which await the binding of a server.",
+})
+
+// pendingServerClaims are the namespaced names of the ServerClaims which await the binding of a server
+var pendingServerClaims = struct {
+	sync.Mutex
+	keys sets.Set[client.ObjectKey]
+}{keys: sets.New[client.ObjectKey]()}
+
+func init() {
+	prometheus.MustRegister(machineDeletions, machineProvisioningDuration, machineOperations, machineOperationDuration, pendingServerClaimsGauge)
+}
+
+// observeOperation records the code returned by an operation of the driver and its duration since start
+func (d *metalDriver) observeOperation(operation string, start time.Time, policy cmd.NodeNamePolicy, err error) {
+	code := codes.OK.String()
+	if err != nil {
+		s, _ := status.FromError(err)
+		code = s.Code().String()
+	}
+	machineOperations.WithLabelValues(operation, code, string(policy)).Inc()
+	machineOperationDuration.WithLabelValues(operation, code, string(policy)).Observe(time.Since(start).Seconds())
+}
+
+// setServerClaimPending marks the ServerClaim as awaiting the binding of a server or not and updates the gauge
+func setServerClaimPending(key client.ObjectKey, pending bool) {
+	pendingServerClaims.Lock()
+	defer pendingServerClaims.Unlock()
+
+	if pending {
+		pendingServerClaims.keys.Insert(key)
+	} else {
+		pendingServerClaims.keys.Delete(key)
+	}
+	pendingServerClaimsGauge.Set(float64(pendingServerClaims.keys.Len()))
+}
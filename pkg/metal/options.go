@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/configz"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// configzName is the name under which the driver configuration is exposed on the /configz endpoint
+const configzName = "metal-driver"
+
+// maxFieldOwnerLength is the maximum length of a field manager accepted by the API server
+const maxFieldOwnerLength = 128
+
+// Options contains the optional settings of the metal driver
+type Options struct {
+	// IPAddressClaimBindGracePeriod is the time an IPAddressClaim may stay unbound after its creation before
+	// GetMachineStatus deletes it and triggers a recreation of the machine. Until then the machine is reinitialized.
+	// A zero value disables the recreation and unbound IPAddressClaims always lead to a reinitialization.
+	IPAddressClaimBindGracePeriod time.Duration `json:"ipAddressClaimBindGracePeriod"`
+	// ExposeConfig exposes the effective driver configuration on the /configz endpoint
+	ExposeConfig bool `json:"exposeConfig"`
+	// AdoptForeignServerClaims allows CreateMachine to adopt an existing ServerClaim which is not managed by the driver
+	AdoptForeignServerClaims bool `json:"adoptForeignServerClaims"`
+	// IgnitionCompressionThreshold is the size in bytes above which file contents are gzip-compressed in the ignition.
+	// A zero value disables the compression.
+	IgnitionCompressionThreshold int `json:"ignitionCompressionThreshold"`
+	// AllowDiskless allows MachineClasses without an image for servers which boot without a disk
+	AllowDiskless bool `json:"allowDiskless"`
+	// IgnitionSecretNamePrefixLabel is the key of the provider spec label whose value prefixes the ignition secret name,
+	// e.g. to avoid name collisions of different tenants in a shared namespace
+	IgnitionSecretNamePrefixLabel string `json:"ignitionSecretNamePrefixLabel"`
+	// IPAddressClaimNamespace is the namespace of the IPAddressClaims, which defaults to the metal namespace.
+	// Owner references can not cross namespaces, so IPAddressClaims in a separate namespace are bound to their
+	// ServerClaim by labels only and are deleted explicitly on machine deletion. ServerClaims and ignition secrets
+	// always share the metal namespace, as ServerClaims reference their ignition secret locally.
+	IPAddressClaimNamespace string `json:"ipAddressClaimNamespace"`
+	// ImageFallback sources the image from the MachineClass annotation or the provider secret if it is not set in the provider spec
+	ImageFallback bool `json:"imageFallback"`
+	// ManagedBy is the value of the managed-by label set on all objects created by the driver, which defaults to ManagedByLabelValue
+	ManagedBy string `json:"managedBy"`
+	// FieldOwner is the field owner of the objects applied by the driver, which defaults to DefaultFieldOwner. Distinct
+	// field owners allow several driver instances to apply objects in one metal cluster, e.g. for blue/green testing.
+	// The effective field owner is exposed as FieldOwner of the Config.
+	FieldOwner string `json:"-"`
+	// DeleteDryRun makes DeleteMachine only report the objects which would be deleted without deleting them.
+	// A dry-run can also be requested per machine with the delete-dry-run annotation.
+	DeleteDryRun bool `json:"deleteDryRun"`
+	// ServerSelectorDiagnostics logs the number of free servers matching the selector of ServerClaims which are still pending
+	ServerSelectorDiagnostics bool `json:"serverSelectorDiagnostics"`
+	// ServerClaimCreateTimeout is the time the creation of a ServerClaim may take before the machine creation fails,
+	// a zero value disables the timeout
+	ServerClaimCreateTimeout time.Duration `json:"serverClaimCreateTimeout"`
+	// UserMetadataPrecedence lets colliding keys of the provider spec metadata take precedence over the computed server
+	// and IPAM metadata, by default the computed metadata overrides them
+	UserMetadataPrecedence bool `json:"userMetadataPrecedence"`
+	// ReadyConditionType is the type of a condition of the bound Server which has to be true, in addition to the
+	// ServerClaim being powered on, before the machine is reported as ready. A Server transitioning its power state,
+	// e.g. while rebooting, is reported as ready to not reinitialize the machine.
+	ReadyConditionType string `json:"readyConditionType"`
+	// DefaultServerClaimLabels are set on all ServerClaims, the labels of the provider spec take precedence on colliding keys
+	DefaultServerClaimLabels map[string]string `json:"defaultServerClaimLabels"`
+	// ImageAliasConfigMap is the name of a ConfigMap in the metal namespace mapping image aliases, e.g. stable, to
+	// image references. Images of the provider spec without a matching alias are used literally.
+	ImageAliasConfigMap string `json:"imageAliasConfigMap"`
+	// MetadataEnvFile additionally renders the metadata as KEY=value lines of the environment file /etc/metal-metadata.env
+	MetadataEnvFile bool `json:"metadataEnvFile"`
+	// ValidationMode controls whether non-critical findings of the provider spec validation fail the validation (strict)
+	// or are logged as warnings (lenient), which is the default
+	ValidationMode cmd.ValidationMode `json:"validationMode"`
+	// AllowedMetadataKeys are the only keys which may be used in the provider spec metadata if set
+	AllowedMetadataKeys []string `json:"allowedMetadataKeys"`
+	// DeniedMetadataKeys are keys which must not be used in the provider spec metadata, e.g. reserved or sensitive keys
+	DeniedMetadataKeys []string `json:"deniedMetadataKeys"`
+	// NodeNameFallback uses the ServerClaim name as node name if the node name can not be resolved with the node name
+	// policy, e.g. because the BMC of the server is temporarily missing, instead of failing the operation
+	NodeNameFallback bool `json:"nodeNameFallback"`
+	// ServerReleaseTimeout is the time DeleteMachine waits after the deletion of the ServerClaim until the server is
+	// available and no longer claimed. A zero value disables the wait.
+	ServerReleaseTimeout time.Duration `json:"serverReleaseTimeout"`
+	// ShootHostnameDomain is the domain the hostname is qualified with together with the shoot name taken from the
+	// shoot-name label of the provider spec, e.g. <node>.<shoot-name>.<domain>. An empty value keeps the plain hostname.
+	ShootHostnameDomain string `json:"shootHostnameDomain"`
+	// IgnitionSecretConflictDetection applies the ignition secret without forcing the ownership of fields managed by another
+	// field manager, so that conflicts of a co-managed ignition secret are reported instead of overwritten
+	IgnitionSecretConflictDetection bool `json:"ignitionSecretConflictDetection"`
+	// MaxMetadataSize is the maximum size in bytes of the JSON serialized metadata rendered into the ignition.
+	// A zero value disables the limit.
+	MaxMetadataSize int `json:"maxMetadataSize"`
+	// ServerClaimSpecTemplate is a YAML or JSON template of the ServerClaim spec to adapt the ServerClaims to the fields
+	// accepted by the metal-operator version. The placeholders {{ .Image }}, {{ .ServerSelector }} and {{ .Power }}
+	// are substituted with the values computed by the driver, string values should be quoted, e.g. {{ .Power | quote }},
+	// as YAML reads Off as boolean. An empty template uses the built-in ServerClaim spec.
+	ServerClaimSpecTemplate string `json:"serverClaimSpecTemplate"`
+	// DetectIgnitionDrift compares the content hash of the ignition secret with the ignition rendered from the current
+	// provider spec in GetMachineStatus and reinitializes the machine on a mismatch. The rendered hash is cached per
+	// generation of the MachineClass.
+	DetectIgnitionDrift bool `json:"detectIgnitionDrift"`
+	// ImageUpdatePolicy controls whether GetMachineStatus recreates a machine whose ServerClaim image differs from the
+	// image of the MachineClass (Recreate) or keeps the image of existing machines (Ignore), which is the default. The
+	// ServerClaim is deleted and created again by the machine creation flow, which is the only flow requesting the
+	// status of a machine which is not being deleted.
+	ImageUpdatePolicy cmd.ImageUpdatePolicy `json:"imageUpdatePolicy"`
+	// VerifyServerImage compares the image of the boot configuration of the bound Server with the image of the ServerClaim
+	// in GetMachineStatus and logs a warning on a mismatch, e.g. if the server still boots a previous image
+	VerifyServerImage bool `json:"verifyServerImage"`
+	// VerifyServerSelector makes CreateMachine fail if no server at all matches the server labels of the provider spec,
+	// regardless of whether the servers are free, to surface misconfigured selectors early
+	VerifyServerSelector bool `json:"verifyServerSelector"`
+	// IPAMPoolMetadata adds the name of the IPAM pool as pool to the metadata entry of each allocated IP address
+	IPAMPoolMetadata bool `json:"ipamPoolMetadata"`
+	// InitializeRetries is the number of in-place retries of an InitializeMachine step failing with a transient metal
+	// API error, e.g. a conflict, before the initialization fails
+	InitializeRetries int `json:"initializeRetries"`
+	// ServerAnnotations are set on the Server bound to a machine on initialization, e.g. to mark servers provisioned by
+	// the driver. A failure to annotate the Server, e.g. due to missing permissions, does not fail the initialization.
+	ServerAnnotations map[string]string `json:"serverAnnotations"`
+	// ZoneLabelKey is the key of the server label selecting servers in the zone of the node template of the MachineClass.
+	// If set, MachineClasses without a zone are rejected. An empty key disables the zone-aware server selection.
+	ZoneLabelKey string `json:"zoneLabelKey"`
+	// ExcludeDeletingServerClaims leaves ServerClaims whose deletion is in progress out of ListMachines, so that
+	// machines which are already being deleted, e.g. during a rapid scale-in, are not reported to the machine-controller-manager
+	ExcludeDeletingServerClaims bool `json:"excludeDeletingServerClaims"`
+	// UserDataIgnitionPolicy controls whether a userData which is a complete ignition or butane config is rendered as
+	// init script (Script), which is the default, or merged into the ignition appending to (Merge) or overriding (Override)
+	// colliding fields. A userData which is no ignition is always rendered as init script.
+	UserDataIgnitionPolicy cmd.UserDataIgnitionPolicy `json:"userDataIgnitionPolicy"`
+	// IgnitionSecretOwnerReference sets an owner reference of the ServerClaim on the ignition secret, so that the ignition
+	// secret is garbage collected with its ServerClaim even if the ServerClaim is not deleted by the driver. Objects in
+	// another namespace than the metal namespace, e.g. IPAddressClaims in a separate IPAM namespace, can not be owned and
+	// outlive the deletion of the metal namespace.
+	IgnitionSecretOwnerReference bool `json:"ignitionSecretOwnerReference"`
+	// NodeNameLabelKey is the key of the label of the bound Server whose value is used as node name with the
+	// ServerLabel node name policy, e.g. an asset id stamped by a CMDB
+	NodeNameLabelKey string `json:"nodeNameLabelKey"`
+	// DeleteOwnedIPAddressClaims makes DeleteMachine also delete the IPAddressClaims owned by the ServerClaim instead of
+	// leaving them to the garbage collection, so that pool addresses are released even if the garbage collection lags
+	DeleteOwnedIPAddressClaims bool `json:"deleteOwnedIPAddressClaims"`
+	// DryRun makes CreateMachine only apply the IPAddressClaims and the ServerClaim in dry-run mode, e.g. to validate
+	// MachineClasses for capacity planning. As nothing is persisted, all subsequent calls of the machine lifecycle fail.
+	DryRun bool `json:"dryRun"`
+	// VerifySecretNamespace rejects provider secrets which are neither located in the namespace of the MachineClass nor
+	// in one of the AllowedSecretNamespaces, so that a misrouted secret of another namespace is not used
+	VerifySecretNamespace bool `json:"verifySecretNamespace"`
+	// AllowedSecretNamespaces are further namespaces the provider secret may be located in if VerifySecretNamespace is set
+	AllowedSecretNamespaces []string `json:"allowedSecretNamespaces"`
+	// MaxConcurrentDeletes limits the DeleteMachine calls concurrently waiting for the deletion of their ServerClaim,
+	// further calls are retried by the machine controller. Zero does not limit the deletions.
+	MaxConcurrentDeletes int `json:"maxConcurrentDeletes"`
+	// AllowedMetalNamespaces are the metal namespaces a Machine may target with the metal namespace annotation instead
+	// of the metal namespace of the driver, e.g. for multi-tenant setups. The annotation is rejected if it is empty.
+	AllowedMetalNamespaces []string `json:"allowedMetalNamespaces"`
+	// MetalAPIRetries is the number of retries of metal API reads and server-side apply patches failing with a server
+	// timeout or too many requests. It is applied to the client provider, other writes are never retried.
+	MetalAPIRetries int `json:"metalAPIRetries"`
+	// MetalClientLockTimeout is the time a metal API operation waits for the client lock held by another operation
+	// before failing. It is applied to the client provider, a zero value waits without a timeout.
+	MetalClientLockTimeout time.Duration `json:"metalClientLockTimeout"`
+}
+
+// Validate validates the driver options
+func (o Options) Validate() error {
+	if o.IPAddressClaimBindGracePeriod < 0 {
+		return fmt.Errorf("IPAddressClaim bind grace period must not be negative: %s", o.IPAddressClaimBindGracePeriod)
+	}
+	if o.IgnitionCompressionThreshold < 0 {
+		return fmt.Errorf("ignition compression threshold must not be negative: %d", o.IgnitionCompressionThreshold)
+	}
+	if o.MaxMetadataSize < 0 {
+		return fmt.Errorf("maximum metadata size must not be negative: %d", o.MaxMetadataSize)
+	}
+	if o.ServerClaimCreateTimeout < 0 {
+		return fmt.Errorf("ServerClaim create timeout must not be negative: %s", o.ServerClaimCreateTimeout)
+	}
+	if o.MaxConcurrentDeletes < 0 {
+		return fmt.Errorf("maximum concurrent deletes must not be negative: %d", o.MaxConcurrentDeletes)
+	}
+	if o.InitializeRetries < 0 {
+		return fmt.Errorf("initialize retries must not be negative: %d", o.InitializeRetries)
+	}
+	if o.ServerReleaseTimeout < 0 {
+		return fmt.Errorf("server release timeout must not be negative: %s", o.ServerReleaseTimeout)
+	}
+	if o.ShootHostnameDomain != "" {
+		if msgs := utilvalidation.IsDNS1123Subdomain(o.ShootHostnameDomain); len(msgs) > 0 {
+			return fmt.Errorf("invalid shoot hostname domain %q: %s", o.ShootHostnameDomain, strings.Join(msgs, ", "))
+		}
+	}
+	if o.ServerClaimSpecTemplate != "" {
+		if err := validateServerClaimSpecTemplate(o.ServerClaimSpecTemplate); err != nil {
+			return fmt.Errorf("invalid ServerClaim spec template: %w", err)
+		}
+	}
+	if len(o.FieldOwner) > maxFieldOwnerLength {
+		return fmt.Errorf("field owner %q must not be longer than %d characters", o.FieldOwner, maxFieldOwnerLength)
+	}
+	if errs := utilvalidation.IsValidLabelValue(o.ManagedBy); len(errs) > 0 {
+		return fmt.Errorf("managed-by label value %q is invalid: %s", o.ManagedBy, strings.Join(errs, ", "))
+	}
+	for _, key := range slices.Sorted(maps.Keys(o.DefaultServerClaimLabels)) {
+		if errs := utilvalidation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("default ServerClaim label key %q is invalid: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := utilvalidation.IsValidLabelValue(o.DefaultServerClaimLabels[key]); len(errs) > 0 {
+			return fmt.Errorf("default ServerClaim label value %q of key %q is invalid: %s", o.DefaultServerClaimLabels[key], key, strings.Join(errs, ", "))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(o.ServerAnnotations)) {
+		if errs := utilvalidation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("server annotation key %q is invalid: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	if o.NodeNameLabelKey != "" {
+		if errs := utilvalidation.IsQualifiedName(o.NodeNameLabelKey); len(errs) > 0 {
+			return fmt.Errorf("node name label key %q is invalid: %s", o.NodeNameLabelKey, strings.Join(errs, ", "))
+		}
+	}
+	for _, namespace := range o.AllowedMetalNamespaces {
+		if errs := utilvalidation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("allowed metal namespace %q is invalid: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	for _, namespace := range o.AllowedSecretNamespaces {
+		if errs := utilvalidation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("allowed secret namespace %q is invalid: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	if o.ZoneLabelKey != "" {
+		if errs := utilvalidation.IsQualifiedName(o.ZoneLabelKey); len(errs) > 0 {
+			return fmt.Errorf("zone label key %q is invalid: %s", o.ZoneLabelKey, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateNodeNamePolicy validates the driver options for the node name policy of the driver
+func (o Options) ValidateNodeNamePolicy(policy cmd.NodeNamePolicy) error {
+	if policy == cmd.NodeNamePolicyServerLabel && o.NodeNameLabelKey == "" {
+		return fmt.Errorf("node name policy %s requires a node name label key", policy)
+	}
+	return nil
+}
+
+// Config is the effective configuration of the metal driver
+type Config struct {
+	MetalNamespace string             `json:"metalNamespace"`
+	NodeNamePolicy cmd.NodeNamePolicy `json:"nodeNamePolicy"`
+	FieldOwner     string             `json:"fieldOwner"`
+	Options
+}
+
+// config returns the effective configuration of the driver
+func (d *metalDriver) config() Config {
+	return Config{
+		MetalNamespace: d.metalNamespace,
+		NodeNamePolicy: d.nodeNamePolicy,
+		FieldOwner:     string(d.getFieldOwner()),
+		Options:        d.options,
+	}
+}
+
+// exposeConfig logs the effective configuration of the driver and registers it on the /configz endpoint if enabled
+func (d *metalDriver) exposeConfig() {
+	config := d.config()
+	klog.InfoS("Metal driver configuration", "config", config)
+
+	if !config.ExposeConfig {
+		return
+	}
+
+	// the registration is replaced to allow recreating the driver within the same process
+	configz.Delete(configzName)
+	cz, err := configz.New(configzName)
+	if err != nil {
+		klog.Warningf("Failed to expose driver configuration: %v", err)
+		return
+	}
+	cz.Set(config)
+}
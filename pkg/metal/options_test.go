@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gardener/machine-controller-manager/pkg/util/configz"
+	mcmclient "github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/client"
+	"github.com/ironcore-dev/machine-controller-manager-provider-ironcore-metal/pkg/cmd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Driver configuration", func() {
+	options := Options{
+		IPAddressClaimBindGracePeriod: 5 * time.Minute,
+		ExposeConfig:                  true,
+		MetalAPIRetries:               3,
+		MetalClientLockTimeout:        10 * time.Second,
+	}
+
+	It("should log the effective configuration on driver creation", func() {
+		By("redirecting the log output")
+		buf := &bytes.Buffer{}
+		klog.LogToStderr(false)
+		klog.SetOutput(buf)
+		DeferCleanup(func() {
+			klog.SetOutput(os.Stderr)
+			klog.LogToStderr(true)
+		})
+
+		By("creating the driver")
+		NewDriver(&mcmclient.Provider{}, "metal-ns", cmd.NodeNamePolicyServerName, options)
+		klog.Flush()
+
+		By("ensuring the logged configuration reflects the provided settings")
+		Expect(buf.String()).To(SatisfyAll(
+			ContainSubstring(`"Metal driver configuration"`),
+			ContainSubstring(`"metalNamespace":"metal-ns"`),
+			ContainSubstring(`"nodeNamePolicy":"ServerName"`),
+			ContainSubstring(`"fieldOwner":"mcm.ironcore.dev/field-owner"`),
+			ContainSubstring(`"ipAddressClaimBindGracePeriod":300000000000`),
+			ContainSubstring(`"exposeConfig":true`),
+			ContainSubstring(`"metalAPIRetries":3`),
+			ContainSubstring(`"metalClientLockTimeout":10000000000`),
+		))
+	})
+
+	It("should expose the effective configuration on the configz endpoint", func() {
+		By("creating the driver")
+		NewDriver(&mcmclient.Provider{}, "metal-ns", cmd.NodeNamePolicyBMCName, options)
+		DeferCleanup(configz.Delete, configzName)
+
+		By("requesting the configz endpoint")
+		mux := http.NewServeMux()
+		configz.InstallHandler(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configz", nil))
+
+		By("ensuring the served configuration reflects the provided settings")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{
+			"metal-driver": {
+				"metalNamespace": "metal-ns",
+				"nodeNamePolicy": "BMCName",
+				"fieldOwner": "mcm.ironcore.dev/field-owner",
+				"ipAddressClaimBindGracePeriod": 300000000000,
+				"exposeConfig": true,
+				"adoptForeignServerClaims": false,
+				"ignitionCompressionThreshold": 0,
+				"allowDiskless": false,
+				"ignitionSecretNamePrefixLabel": "",
+				"ipAddressClaimNamespace": "",
+				"imageFallback": false,
+				"managedBy": "",
+				"deleteDryRun": false,
+				"serverSelectorDiagnostics": false,
+				"serverClaimCreateTimeout": 0,
+				"userMetadataPrecedence": false,
+				"readyConditionType": "",
+				"defaultServerClaimLabels": null,
+				"imageAliasConfigMap": "",
+				"metadataEnvFile": false,
+				"validationMode": "",
+				"allowedMetadataKeys": null,
+				"deniedMetadataKeys": null,
+				"nodeNameFallback": false,
+				"serverReleaseTimeout": 0,
+				"shootHostnameDomain": "",
+				"ignitionSecretConflictDetection": false,
+				"maxMetadataSize": 0,
+				"serverClaimSpecTemplate": "",
+				"detectIgnitionDrift": false,
+				"imageUpdatePolicy": "",
+				"verifyServerImage": false,
+				"verifyServerSelector": false,
+				"ipamPoolMetadata": false,
+				"initializeRetries": 0,
+				"serverAnnotations": null,
+				"zoneLabelKey": "",
+				"excludeDeletingServerClaims": false,
+				"userDataIgnitionPolicy": "",
+				"ignitionSecretOwnerReference": false,
+				"nodeNameLabelKey": "",
+				"deleteOwnedIPAddressClaims": false,
+				"dryRun": false,
+				"verifySecretNamespace": false,
+				"allowedSecretNamespaces": null,
+				"maxConcurrentDeletes": 0,
+				"allowedMetalNamespaces": null,
+				"metalAPIRetries": 3,
+				"metalClientLockTimeout": 10000000000
+			}
+		}`))
+	})
+})
+
+var _ = DescribeTable("Options validation",
+	func(options Options, expectedErr string) {
+		err := options.Validate()
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(expectedErr))
+		}
+	},
+	Entry("should accept the default options", Options{}, ""),
+	Entry("should accept a positive compression threshold", Options{IgnitionCompressionThreshold: 1024}, ""),
+	Entry("should reject a negative compression threshold", Options{IgnitionCompressionThreshold: -1}, "ignition compression threshold must not be negative: -1"),
+	Entry("should accept a custom managed-by label value", Options{ManagedBy: "my-driver"}, ""),
+	Entry("should reject an invalid managed-by label value", Options{ManagedBy: "my driver"}, `managed-by label value "my driver" is invalid: a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')`),
+	Entry("should reject an invalid node name label key", Options{NodeNameLabelKey: "asset id"}, `node name label key "asset id" is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`),
+	Entry("should reject an invalid allowed metal namespace", Options{AllowedMetalNamespaces: []string{"Tenant"}}, `allowed metal namespace "Tenant" is invalid: a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`),
+	Entry("should reject an invalid allowed secret namespace", Options{AllowedSecretNamespaces: []string{"Garden"}}, `allowed secret namespace "Garden" is invalid: a lowercase RFC 1123 label must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character (e.g. 'my-name',  or '123-abc', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?')`),
+	Entry("should reject a field owner longer than 128 characters", Options{FieldOwner: strings.Repeat("a", 129)}, fmt.Sprintf("field owner %q must not be longer than 128 characters", strings.Repeat("a", 129))),
+	Entry("should reject negative maximum concurrent deletes", Options{MaxConcurrentDeletes: -1}, "maximum concurrent deletes must not be negative: -1"),
+	Entry("should reject negative initialize retries", Options{InitializeRetries: -1}, "initialize retries must not be negative: -1"),
+	Entry("should reject a negative bind grace period", Options{IPAddressClaimBindGracePeriod: -time.Second}, "IPAddressClaim bind grace period must not be negative: -1s"),
+	Entry("should reject an invalid server annotation key", Options{ServerAnnotations: map[string]string{"provisioned by": "mcm"}}, `server annotation key "provisioned by" is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`),
+	Entry("should accept valid default ServerClaim labels", Options{DefaultServerClaimLabels: map[string]string{"example.org/team": "infra"}}, ""),
+	Entry("should reject an invalid default ServerClaim label key", Options{DefaultServerClaimLabels: map[string]string{"team infra": "infra"}}, `default ServerClaim label key "team infra" is invalid: name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')`),
+	Entry("should reject a ServerClaim spec template which does not render to a valid spec", Options{ServerClaimSpecTemplate: "power: {{ .Power }}"},
+		"invalid ServerClaim spec template: rendered ServerClaim spec is invalid: json: cannot unmarshal bool into Go struct field ServerClaimSpec.power of type v1alpha1.Power"),
+	Entry("should reject a negative maximum metadata size", Options{MaxMetadataSize: -1}, "maximum metadata size must not be negative: -1"),
+	Entry("should reject a negative ServerClaim create timeout", Options{ServerClaimCreateTimeout: -time.Second}, "ServerClaim create timeout must not be negative: -1s"),
+	Entry("should reject a negative server release timeout", Options{ServerReleaseTimeout: -time.Second}, "server release timeout must not be negative: -1s"),
+	Entry("should reject an invalid shoot hostname domain", Options{ShootHostnameDomain: "Internal"}, `invalid shoot hostname domain "Internal": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`),
+)
+
+var _ = DescribeTable("Options validation for the node name policy",
+	func(options Options, policy cmd.NodeNamePolicy, expectedErr string) {
+		err := options.ValidateNodeNamePolicy(policy)
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(expectedErr))
+		}
+	},
+	Entry("should accept the ServerClaimName policy without a node name label key", Options{}, cmd.NodeNamePolicyServerClaimName, ""),
+	Entry("should accept the ServerLabel policy with a node name label key", Options{NodeNameLabelKey: "asset-id"}, cmd.NodeNamePolicyServerLabel, ""),
+	Entry("should reject the ServerLabel policy without a node name label key", Options{}, cmd.NodeNamePolicyServerLabel, "node name policy ServerLabel requires a node name label key"),
+)
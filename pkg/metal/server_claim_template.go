@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+
+	"github.com/Masterminds/sprig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// ServerClaimTemplateData are the values substituted in the ServerClaim spec template
+type ServerClaimTemplateData struct {
+	// Image is the operating system image of the machine
+	Image string
+	// ServerSelector is the label selector of the servers which can be claimed
+	ServerSelector *metav1.LabelSelector
+	// Power is the power state of the server
+	Power metalv1alpha1.Power
+}
+
+// sampleServerClaimTemplateData is used to validate that the ServerClaim spec template renders to a valid spec
+var sampleServerClaimTemplateData = ServerClaimTemplateData{
+	Image:          "ghcr.io/ironcore-dev/os-images/gardenlinux:1443.3",
+	ServerSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"instance-type": "bx2-metal"}},
+	Power:          metalv1alpha1.PowerOff,
+}
+
+// renderServerClaimSpec renders the YAML or JSON ServerClaim spec template with the given values. The rendered spec
+// must be an object whose known fields match the ServerClaim spec, fields unknown to the driver are kept.
+func renderServerClaimSpec(specTemplate string, data ServerClaimTemplateData) (map[string]any, error) {
+	tmpl, err := template.New("serverClaimSpec").Funcs(sprig.HermeticTxtFuncMap()).Option("missingkey=error").Parse(specTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ServerClaim spec template: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute ServerClaim spec template: %w", err)
+	}
+
+	var spec map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &spec); err != nil {
+		return nil, fmt.Errorf("rendered ServerClaim spec is not an object: %w", err)
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("rendered ServerClaim spec is empty")
+	}
+	// the known fields are validated by decoding the rendered spec as it is applied, unknown fields are ignored.
+	// This also catches unquoted YAML values like Off which are rendered as booleans.
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rendered ServerClaim spec: %w", err)
+	}
+	if err := json.Unmarshal(specJSON, &metalv1alpha1.ServerClaimSpec{}); err != nil {
+		return nil, fmt.Errorf("rendered ServerClaim spec is invalid: %w", err)
+	}
+	return spec, nil
+}
+
+// validateServerClaimSpecTemplate validates that the ServerClaim spec template renders to a valid spec
+func validateServerClaimSpecTemplate(specTemplate string) error {
+	_, err := renderServerClaimSpec(specTemplate, sampleServerClaimTemplateData)
+	return err
+}
+
+// applyServerClaimSpecTemplate returns the ServerClaim as unstructured object with the spec rendered from the
+// ServerClaim spec template, the values are taken from the spec computed by the driver
+func applyServerClaimSpecTemplate(serverClaim *metalv1alpha1.ServerClaim, specTemplate string) (*unstructured.Unstructured, error) {
+	spec, err := renderServerClaimSpec(specTemplate, ServerClaimTemplateData{
+		Image:          serverClaim.Spec.Image,
+		ServerSelector: serverClaim.Spec.ServerSelector,
+		Power:          serverClaim.Spec.Power,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(serverClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert ServerClaim: %w", err)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.Object["spec"] = spec
+	delete(obj.Object, "status")
+	return obj, nil
+}
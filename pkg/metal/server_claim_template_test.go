@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	metalv1alpha1 "github.com/ironcore-dev/metal-operator/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = DescribeTable("renderServerClaimSpec",
+	func(specTemplate string, expected map[string]any, expectedErr string) {
+		spec, err := renderServerClaimSpec(specTemplate, ServerClaimTemplateData{
+			Image:          "registry.example.com/os:1.2.3",
+			ServerSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"instance-type": "bx2-metal"}},
+			Power:          metalv1alpha1.PowerOff,
+		})
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec).To(Equal(expected))
+	},
+	Entry("substitutes the values in a YAML template",
+		"image: {{ .Image | quote }}\nserverSelector: {{ toJson .ServerSelector }}\npower: {{ .Power | quote }}\n",
+		map[string]any{
+			"image":          "registry.example.com/os:1.2.3",
+			"serverSelector": map[string]any{"matchLabels": map[string]any{"instance-type": "bx2-metal"}},
+			"power":          "Off",
+		}, ""),
+	Entry("substitutes the values in a JSON template",
+		`{"image": "{{ .Image }}", "power": "{{ .Power }}"}`,
+		map[string]any{
+			"image": "registry.example.com/os:1.2.3",
+			"power": "Off",
+		}, ""),
+	Entry("keeps fields unknown to the driver",
+		"image: {{ .Image | quote }}\npower: {{ .Power | quote }}\nbootProfile: default\n",
+		map[string]any{
+			"image":       "registry.example.com/os:1.2.3",
+			"power":       "Off",
+			"bootProfile": "default",
+		}, ""),
+	Entry("rejects an unparsable template", "image: {{ .Image", nil, "failed to parse ServerClaim spec template"),
+	Entry("rejects an unknown placeholder", "image: {{ .Tag }}", nil, "failed to execute ServerClaim spec template"),
+	Entry("rejects a spec which is not an object", "- {{ .Image }}", nil, "rendered ServerClaim spec is not an object"),
+	Entry("rejects an empty spec", "{{/* nothing */}}", nil, "rendered ServerClaim spec is empty"),
+	Entry("rejects a spec with a mistyped field", "image: [{{ .Image | quote }}]", nil, "rendered ServerClaim spec is invalid"),
+	Entry("rejects an unquoted power state rendered as boolean", "power: {{ .Power }}", nil, "rendered ServerClaim spec is invalid"),
+)
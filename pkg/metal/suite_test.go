@@ -102,6 +102,10 @@ var _ = BeforeSuite(func() {
 })
 
 func SetupTest(nodeNamePolicy cmd.NodeNamePolicy) (*corev1.Namespace, *corev1.Secret, *driver.Driver) {
+	return SetupTestWithOptions(nodeNamePolicy, Options{})
+}
+
+func SetupTestWithOptions(nodeNamePolicy cmd.NodeNamePolicy, options Options) (*corev1.Namespace, *corev1.Secret, *driver.Driver) {
 	var (
 		drv driver.Driver
 	)
@@ -144,7 +148,7 @@ func SetupTest(nodeNamePolicy cmd.NodeNamePolicy) (*corev1.Namespace, *corev1.Se
 		clientProvider := &mcmclient.Provider{}
 		clientProvider.SetClient(userClient)
 
-		drv = NewDriver(clientProvider, ns.Name, nodeNamePolicy)
+		drv = NewDriver(clientProvider, ns.Name, nodeNamePolicy, options)
 	})
 
 	return ns, secret, &drv
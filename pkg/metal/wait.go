@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// pollJitterFactor is the maximum factor by which polling intervals are extended to spread the API load of concurrent reconciles
+const pollJitterFactor = 0.5
+
+// jitteredBackoff returns a backoff with a constant base interval, which is extended by a random jitter on every step
+func jitteredBackoff(interval time.Duration) wait.Backoff {
+	return wait.Backoff{
+		Duration: interval,
+		Factor:   1.0,
+		Jitter:   pollJitterFactor,
+		Steps:    math.MaxInt32,
+	}
+}
+
+// pollUntilContextTimeoutWithJitter immediately checks the condition and polls it with jittered intervals until it is done,
+// returns an error or the timeout is reached
+func pollUntilContextTimeoutWithJitter(ctx context.Context, interval, timeout time.Duration, condition wait.ConditionWithContextFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return wait.ExponentialBackoffWithContext(ctx, jitteredBackoff(interval), condition)
+}
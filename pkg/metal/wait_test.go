@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package metal
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Polling with jitter", func() {
+	It("should vary the intervals within the jitter band", func() {
+		interval := 100 * time.Millisecond
+		backoff := jitteredBackoff(interval)
+
+		intervals := map[time.Duration]bool{}
+		for range 50 {
+			step := backoff.Step()
+			Expect(step).To(BeNumerically(">=", interval))
+			Expect(step).To(BeNumerically("<", time.Duration(float64(interval)*(1+pollJitterFactor))))
+			intervals[step] = true
+		}
+		Expect(len(intervals)).To(BeNumerically(">", 1))
+	})
+
+	It("should poll until the condition is done", func(ctx SpecContext) {
+		calls := 0
+		Expect(pollUntilContextTimeoutWithJitter(ctx, time.Millisecond, time.Second, func(context.Context) (bool, error) {
+			calls++
+			return calls == 3, nil
+		})).To(Succeed())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("should fail once the timeout is reached", func(ctx SpecContext) {
+		Expect(pollUntilContextTimeoutWithJitter(ctx, time.Millisecond, 10*time.Millisecond, func(context.Context) (bool, error) {
+			return false, nil
+		})).To(MatchError(context.DeadlineExceeded))
+	})
+})